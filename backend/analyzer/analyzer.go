@@ -61,6 +61,42 @@ func Analyzer(input string) string {
 			result, err = commands.ParserMkFile(tokens[1:])
 		case "cat":
 			result, err = commands.ParserCat(tokens[1:])
+		case "chmod":
+			result, err = commands.ParserChmod(tokens[1:])
+		case "recovery":
+			result, err = commands.ParserRecovery(tokens[1:])
+		case "loss":
+			result, err = commands.ParserLoss(tokens[1:])
+		case "fsck":
+			result, err = commands.ParserFsck(tokens[1:])
+		case "ln":
+			result, err = commands.ParserLn(tokens[1:])
+		case "migrate":
+			result, err = commands.ParserMigrate(tokens[1:])
+		case "setxattr":
+			result, err = commands.ParserSetXattr(tokens[1:])
+		case "getxattr":
+			result, err = commands.ParserGetXattr(tokens[1:])
+		case "listxattr":
+			result, err = commands.ParserListXattr(tokens[1:])
+		case "rmxattr":
+			result, err = commands.ParserRmXattr(tokens[1:])
+		case "quota":
+			result, err = commands.ParserQuota(tokens[1:])
+		case "resizefs":
+			result, err = commands.ParserResizeFs(tokens[1:])
+		case "df":
+			result, err = commands.ParserDf(tokens[1:])
+		case "du":
+			result, err = commands.ParserDu(tokens[1:])
+		case "remove":
+			result, err = commands.ParserRemove(tokens[1:])
+		case "trash":
+			result, err = commands.ParserTrash(tokens[1:])
+		case "fssnap":
+			result, err = commands.ParserFsSnap(tokens[1:])
+		case "chattr":
+			result, err = commands.ParserChattr(tokens[1:])
 		default:
 			err = fmt.Errorf("Error: command not found: %s", tokens[0])
 		}
@@ -44,7 +44,8 @@ func ParserCat(tokens []string) (string, error) {
 }
 
 func (cmd *Cat) commandCat() (string, error) {
-	if !global.IsUserLogged() {
+	creds, err := global.GetLoggedCredentials()
+	if err != nil {
 		return "", fmt.Errorf("you must be logged")
 	}
 
@@ -68,6 +69,10 @@ func (cmd *Cat) commandCat() (string, error) {
 				result = append(result, part)
 			}
 		}
+		if err := sb.CheckAccess(partitionPath, result, creds, structures.PermRead); err != nil {
+			return "", err
+		}
+
 		response := sb.GetFile(partitionPath, 0, result)
 		if response != "" {
 			sb2.WriteString(response)
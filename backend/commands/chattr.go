@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"backend/global"
+	"backend/structures"
+	"backend/utils"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type Chattr struct {
+	Path     string
+	Compress bool
+}
+
+func ParserChattr(tokens []string) (string, error) {
+	cmd := &Chattr{}
+
+	args := strings.Join(tokens, " ")
+	re := regexp.MustCompile(`(?i)-path(?-i)="[^"]+"|(?i)-path(?-i)=\S+|(?i)-compress|(?i)-decompress`)
+	matches := re.FindAllString(args, -1)
+
+	actions := 0
+	for _, match := range matches {
+		var key, value string
+		var err error
+
+		if flag := strings.ToLower(match); flag == "-compress" || flag == "-decompress" {
+			key = flag
+			value = ""
+		} else {
+			key, value, err = utils.ParseToken(match)
+			if err != nil {
+				return "", err
+			}
+
+			if strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
+				value = strings.Trim(value, "\"")
+			}
+		}
+
+		switch key {
+		case "-path":
+			if value == "" {
+				return "", fmt.Errorf("invalid path: %s", value)
+			}
+			cmd.Path = value
+		case "-compress":
+			cmd.Compress = true
+			actions++
+		case "-decompress":
+			actions++
+		}
+	}
+
+	if cmd.Path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+
+	if actions != 1 {
+		return "", fmt.Errorf("use one of -compress or -decompress")
+	}
+
+	if err := cmd.commandChattr(); err != nil {
+		return "", err
+	}
+
+	return cmd.Print(), nil
+}
+
+// commandChattr compresses or decompresses a file in place, it needs write access
+// because the content is written again
+func (cmd *Chattr) commandChattr() error {
+	creds, err := global.GetLoggedCredentials()
+	if err != nil {
+		return fmt.Errorf("you must be logged in")
+	}
+
+	mountedPartition, partitionPath, err := global.GetMountedPartition(global.LoggedPartition)
+	if err != nil {
+		return err
+	}
+
+	sb := &structures.SuperBlock{}
+	if err := sb.ReadSuperBlock(partitionPath, int64(mountedPartition.PartStart)); err != nil {
+		return err
+	}
+
+	result := structures.SplitPath(cmd.Path)
+	if err := sb.CheckAccess(partitionPath, result, creds, structures.PermWrite); err != nil {
+		return err
+	}
+
+	release, err := sb.StartQuota(partitionPath, creds)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	content := "-decompress"
+	if cmd.Compress {
+		content = "-compress"
+	}
+	if err := sb.AddJournal(partitionPath, structures.JournalEntry{Operation: "chattr", Path: cmd.Path, Content: content, Owner: creds}); err != nil {
+		return err
+	}
+
+	// the superblock is written even when rewriting fails, blocks may already be allocated
+	err = sb.SetCompression(partitionPath, result, cmd.Compress)
+
+	if err := sb.WriteSuperBlock(partitionPath, int64(mountedPartition.PartStart), int64(mountedPartition.PartStart+sb.Size())); err != nil {
+		return err
+	}
+
+	return err
+}
+
+func (cmd *Chattr) Print() string {
+	if cmd.Compress {
+		return fmt.Sprintf("%s is now stored compressed", cmd.Path)
+	}
+
+	return fmt.Sprintf("%s is now stored uncompressed", cmd.Path)
+}
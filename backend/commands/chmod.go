@@ -0,0 +1,138 @@
+package commands
+
+import (
+	"backend/global"
+	"backend/structures"
+	"backend/utils"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type Chmod struct {
+	Path string
+	Ugo  string
+	R    bool
+}
+
+func ParserChmod(tokens []string) (string, error) {
+	cmd := &Chmod{}
+
+	args := strings.Join(tokens, " ")
+	re := regexp.MustCompile(`(?i)-path(?-i)="[^"]+"|(?i)-path(?-i)=\S+|(?i)-ugo(?-i)=\S+|(?i)-r`)
+	matches := re.FindAllString(args, -1)
+
+	for _, match := range matches {
+		var key, value string
+		var err error
+
+		if strings.ToLower(match) == "-r" {
+			key = "-r"
+			value = ""
+		} else {
+			key, value, err = utils.ParseToken(match)
+			if err != nil {
+				return "", err
+			}
+
+			if strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
+				value = strings.Trim(value, "\"")
+			}
+		}
+
+		switch key {
+		case "-path":
+			if value == "" {
+				return "", fmt.Errorf("invalid path: %s", value)
+			}
+			cmd.Path = value
+		case "-ugo":
+			if len(value) != 3 {
+				return "", fmt.Errorf("invalid ugo: %s", value)
+			}
+			for _, digit := range value {
+				if digit < '0' || digit > '7' {
+					return "", fmt.Errorf("invalid ugo: %s, each digit must be between 0 and 7", value)
+				}
+			}
+			cmd.Ugo = value
+		case "-r":
+			cmd.R = true
+		}
+	}
+
+	if cmd.Path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+
+	if cmd.Ugo == "" {
+		return "", fmt.Errorf("ugo is required")
+	}
+
+	if err := cmd.commandChmod(); err != nil {
+		return "", err
+	}
+
+	return cmd.Print(), nil
+}
+
+func (cmd *Chmod) commandChmod() error {
+	creds, err := global.GetLoggedCredentials()
+	if err != nil {
+		return fmt.Errorf("you must be logged in")
+	}
+
+	mountedPartition, partitionPath, err := global.GetMountedPartition(global.LoggedPartition)
+	if err != nil {
+		return err
+	}
+
+	sb := &structures.SuperBlock{}
+	if err := sb.ReadSuperBlock(partitionPath, int64(mountedPartition.PartStart)); err != nil {
+		return err
+	}
+
+	array := strings.Split(cmd.Path, "/")
+	var result []string
+	for _, part := range array {
+		if part != "" {
+			result = append(result, part)
+		}
+	}
+
+	if err := sb.CheckAccess(partitionPath, result, creds, 0); err != nil {
+		return err
+	}
+
+	indexInode := sb.GetInodeReference(partitionPath, 0, result)
+	if indexInode == -1 {
+		return fmt.Errorf("path not found: %s", cmd.Path)
+	}
+
+	inode := &structures.Inode{}
+	if err := inode.ReadInode(partitionPath, int64(sb.SInodeStart+indexInode*sb.SInodeSize)); err != nil {
+		return err
+	}
+
+	if creds.UID != structures.RootUID && inode.IuId != creds.UID {
+		return fmt.Errorf("permission denied: only root or the owner can change permissions of %s", cmd.Path)
+	}
+
+	content := cmd.Ugo
+	if cmd.R {
+		content += " -r"
+	}
+
+	if err := sb.AddJournal(partitionPath, structures.JournalEntry{Operation: "chmod", Path: cmd.Path, Content: content, Owner: creds}); err != nil {
+		return err
+	}
+
+	var perm [3]byte
+	copy(perm[:], cmd.Ugo)
+
+	return sb.ChangePermissions(partitionPath, indexInode, perm, creds.UID, cmd.R)
+}
+
+func (cmd *Chmod) Print() string {
+	return fmt.Sprintf("permissions of %s changed to %s", cmd.Path, cmd.Ugo)
+}
@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"backend/global"
+	"backend/structures"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type Df struct {
+	Usage []structures.FsUsage
+}
+
+func ParserDf(tokens []string) (string, error) {
+	cmd := &Df{}
+
+	usage, err := DiskFree()
+	if err != nil {
+		return "", err
+	}
+	cmd.Usage = usage
+
+	return cmd.Print(), nil
+}
+
+// DiskFree returns the space of every mounted partition, partitions that are not
+// formatted or need migrate are left out
+func DiskFree() ([]structures.FsUsage, error) {
+	var ids []string
+	for id := range global.MountedPartitions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	usage := []structures.FsUsage{}
+	for _, id := range ids {
+		mountedPartition, partitionPath, err := global.GetMountedPartition(id)
+		if err != nil {
+			return nil, err
+		}
+
+		sb := &structures.SuperBlock{}
+		if err := sb.ReadSuperBlock(partitionPath, int64(mountedPartition.PartStart)); err != nil || sb.SMagic != 0xEF53 {
+			continue
+		}
+
+		usage = append(usage, sb.Usage(id))
+	}
+
+	return usage, nil
+}
+
+func (cmd *Df) Print() string {
+	if len(cmd.Usage) == 0 {
+		return "no formatted partitions mounted"
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("%-8s %10s %10s %10s %5s %8s %8s %8s %5s", "id", "bytes", "used", "free", "use", "inodes", "iused", "ifree", "iuse"))
+	for _, usage := range cmd.Usage {
+		b.WriteString(fmt.Sprintf("\n%-8s %10d %10d %10d %4.0f%% %8d %8d %8d %4.0f%%",
+			usage.Id, usage.Bytes, usage.UsedBytes, usage.FreeBytes, usage.BlockUse,
+			usage.Inodes, usage.UsedInodes, usage.FreeInodes, usage.InodeUse))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,98 @@
+package commands
+
+import (
+	"backend/global"
+	"backend/structures"
+	"backend/utils"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type Du struct {
+	Path  string
+	Depth int
+	Usage []structures.DiskUsage
+}
+
+func ParserDu(tokens []string) (string, error) {
+	cmd := &Du{}
+
+	args := strings.Join(tokens, " ")
+	re := regexp.MustCompile(`(?i)-path(?-i)="[^"]+"|(?i)-path(?-i)=\S+|(?i)-depth(?-i)=\S+`)
+	matches := re.FindAllString(args, -1)
+
+	for _, match := range matches {
+		key, value, err := utils.ParseToken(match)
+		if err != nil {
+			return "", err
+		}
+
+		switch key {
+		case "-path":
+			if value == "" {
+				return "", fmt.Errorf("invalid path: %s", value)
+			}
+			cmd.Path = value
+		case "-depth":
+			depth, err := strconv.Atoi(value)
+			if err != nil || depth < 0 {
+				return "", fmt.Errorf("invalid depth: %s, must be 0 or a positive number", value)
+			}
+			cmd.Depth = depth
+		}
+	}
+
+	if cmd.Path == "" {
+		return "", fmt.Errorf("missing path")
+	}
+
+	usage, err := DiskUsage(cmd.Path, cmd.Depth)
+	if err != nil {
+		return "", err
+	}
+	cmd.Usage = usage
+
+	return cmd.Print(), nil
+}
+
+// DiskUsage returns the blocks allocated and the size of the files below filePath and
+// below every folder up to depth levels under it, the path needs read access
+func DiskUsage(filePath string, depth int) ([]structures.DiskUsage, error) {
+	creds, err := global.GetLoggedCredentials()
+	if err != nil {
+		return nil, fmt.Errorf("you must be logged in")
+	}
+
+	mountedPartition, partitionPath, err := global.GetMountedPartition(global.LoggedPartition)
+	if err != nil {
+		return nil, err
+	}
+
+	sb := &structures.SuperBlock{}
+	if err := sb.ReadSuperBlock(partitionPath, int64(mountedPartition.PartStart)); err != nil {
+		return nil, err
+	}
+
+	result := structures.SplitPath(filePath)
+	if err := sb.CheckAccess(partitionPath, result, creds, structures.PermRead); err != nil {
+		return nil, err
+	}
+
+	index := sb.GetInodeReference(partitionPath, 0, result)
+	if index == -1 {
+		return nil, fmt.Errorf("path not found: %s", filePath)
+	}
+
+	return sb.DiskUsage(partitionPath, index, "/"+strings.Join(result, "/"), depth, creds)
+}
+
+func (cmd *Du) Print() string {
+	var lines []string
+	for _, usage := range cmd.Usage {
+		lines = append(lines, fmt.Sprintf("%8d %8d %6d\t%s", usage.Size, usage.Bytes, usage.Blocks, usage.Path))
+	}
+
+	return strings.Join(lines, "\n")
+}
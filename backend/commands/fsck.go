@@ -0,0 +1,119 @@
+package commands
+
+import (
+	"backend/global"
+	"backend/structures"
+	"backend/utils"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type Fsck struct {
+	Id     string
+	Repair bool
+	Report *structures.FsckReport
+}
+
+func ParserFsck(tokens []string) (string, error) {
+	cmd := &Fsck{}
+
+	args := strings.Join(tokens, " ")
+	re := regexp.MustCompile(`(?i)-id(?-i)=\S+|(?i)-repair`)
+	matches := re.FindAllString(args, -1)
+
+	for _, match := range matches {
+		var key, value string
+		var err error
+
+		if strings.ToLower(match) == "-repair" {
+			key = "-repair"
+			value = ""
+		} else {
+			key, value, err = utils.ParseToken(match)
+			if err != nil {
+				return "", err
+			}
+		}
+
+		switch key {
+		case "-id":
+			if value == "" {
+				return "", fmt.Errorf("invalid id: %s", value)
+			}
+			cmd.Id = value
+		case "-repair":
+			cmd.Repair = true
+		}
+	}
+
+	if cmd.Id == "" {
+		return "", fmt.Errorf("missing id")
+	}
+
+	if err := cmd.commandFsck(); err != nil {
+		return "", err
+	}
+
+	return cmd.Print(), nil
+}
+
+func (cmd *Fsck) commandFsck() error {
+	if user, _, err := global.GetLoggedUser(); user != "root" || err != nil {
+		return fmt.Errorf("permission denied")
+	}
+
+	mountedPartition, partitionPath, err := global.GetMountedPartition(cmd.Id)
+	if err != nil {
+		return err
+	}
+
+	// a superblock with a bad checksum is still checked, repairing writes it back
+	sb := &structures.SuperBlock{}
+	readErr := sb.ReadSuperBlock(partitionPath, int64(mountedPartition.PartStart))
+	var corruption *structures.CorruptionError
+	if readErr != nil && !errors.As(readErr, &corruption) {
+		return readErr
+	}
+
+	if sb.SMagic != 0xEF53 {
+		return fmt.Errorf("partition %s is not formatted", cmd.Id)
+	}
+
+	cmd.Report, err = sb.CheckFilesystem(partitionPath, cmd.Repair)
+	if err != nil {
+		return err
+	}
+
+	if corruption != nil {
+		cmd.Report.Problems = append([]string{corruption.Error()}, cmd.Report.Problems...)
+	}
+
+	// a consistent filesystem no longer needs the journal entries written so far
+	if len(cmd.Report.Problems) == 0 || cmd.Report.Repaired {
+		if err := sb.CheckpointJournal(partitionPath); err != nil {
+			return err
+		}
+	}
+
+	if !cmd.Report.Repaired {
+		return nil
+	}
+
+	return sb.WriteSuperBlock(partitionPath, int64(mountedPartition.PartStart), int64(mountedPartition.PartStart+sb.Size()))
+}
+
+func (cmd *Fsck) Print() string {
+	if len(cmd.Report.Problems) == 0 {
+		return fmt.Sprintf("fsck of partition %s: no problems found", cmd.Id)
+	}
+
+	status := "found"
+	if cmd.Report.Repaired {
+		status = "found and repaired"
+	}
+
+	return fmt.Sprintf("fsck of partition %s: %d problems %s:\n%s",
+		cmd.Id, len(cmd.Report.Problems), status, strings.Join(cmd.Report.Problems, "\n"))
+}
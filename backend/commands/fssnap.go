@@ -0,0 +1,197 @@
+package commands
+
+import (
+	"backend/global"
+	"backend/structures"
+	"backend/utils"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type FsSnap struct {
+	Id       string
+	Create   string
+	List     bool
+	Rollback string
+	Delete   string
+	Lines    []string
+}
+
+func ParserFsSnap(tokens []string) (string, error) {
+	cmd := &FsSnap{}
+
+	args := strings.Join(tokens, " ")
+	re := regexp.MustCompile(`(?i)-id(?-i)=\S+|(?i)-create(?-i)=\S+|(?i)-rollback(?-i)=\S+|(?i)-delete(?-i)=\S+|(?i)-list`)
+	matches := re.FindAllString(args, -1)
+
+	actions := 0
+	for _, match := range matches {
+		var key, value string
+		var err error
+
+		if strings.ToLower(match) == "-list" {
+			key = "-list"
+			value = ""
+		} else {
+			key, value, err = utils.ParseToken(match)
+			if err != nil {
+				return "", err
+			}
+		}
+
+		switch key {
+		case "-id":
+			if value == "" {
+				return "", fmt.Errorf("invalid id: %s", value)
+			}
+			cmd.Id = value
+			continue
+		case "-list":
+			cmd.List = true
+		case "-create", "-rollback", "-delete":
+			if value == "" || len(value) > structures.SnapshotNameSize {
+				return "", fmt.Errorf("invalid %s: %s, must be 1 to %d characters", key[1:], value, structures.SnapshotNameSize)
+			}
+
+			switch key {
+			case "-create":
+				cmd.Create = value
+			case "-rollback":
+				cmd.Rollback = value
+			default:
+				cmd.Delete = value
+			}
+		}
+		actions++
+	}
+
+	if cmd.Id == "" {
+		return "", fmt.Errorf("missing id")
+	}
+
+	if actions != 1 {
+		return "", fmt.Errorf("use one of -create, -list, -rollback or -delete")
+	}
+
+	var err error
+	if cmd.List {
+		err = cmd.commandList()
+	} else {
+		err = cmd.commandFsSnap()
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return cmd.Print(), nil
+}
+
+// commandFsSnap creates, rolls back or deletes a snapshot of the partition
+func (cmd *FsSnap) commandFsSnap() error {
+	if user, _, err := global.GetLoggedUser(); user != "root" || err != nil {
+		return fmt.Errorf("permission denied")
+	}
+
+	creds, err := global.GetLoggedCredentials()
+	if err != nil {
+		return err
+	}
+
+	mountedPartition, partitionPath, err := global.GetMountedPartition(cmd.Id)
+	if err != nil {
+		return err
+	}
+
+	sb := &structures.SuperBlock{}
+	if err := sb.ReadSuperBlock(partitionPath, int64(mountedPartition.PartStart)); err != nil {
+		return err
+	}
+
+	if sb.SMagic != 0xEF53 {
+		return fmt.Errorf("partition %s is not formatted", cmd.Id)
+	}
+
+	var content string
+	switch {
+	case cmd.Create != "":
+		content = "-create=" + cmd.Create
+	case cmd.Rollback != "":
+		content = "-rollback=" + cmd.Rollback
+	default:
+		content = "-delete=" + cmd.Delete
+	}
+
+	if err := sb.AddJournal(partitionPath, structures.JournalEntry{Operation: "fssnap", Path: "/" + structures.SnapshotFile, Content: content, Owner: creds}); err != nil {
+		return err
+	}
+
+	// the superblock is written even when the operation fails, blocks may already be allocated
+	switch {
+	case cmd.Create != "":
+		var snapshot *structures.Snapshot
+		if snapshot, err = sb.CreateSnapshot(partitionPath, cmd.Create); err == nil {
+			cmd.Lines = append(cmd.Lines, fmt.Sprintf("snapshot %s of partition %s created with %d inodes and %d blocks",
+				snapshot.Name, cmd.Id, snapshot.Inodes(), snapshot.Blocks()))
+		}
+	case cmd.Rollback != "":
+		if err = sb.RollbackSnapshot(partitionPath, cmd.Rollback); err == nil {
+			cmd.Lines = append(cmd.Lines, fmt.Sprintf("partition %s rolled back to snapshot %s", cmd.Id, cmd.Rollback))
+		}
+	default:
+		if err = sb.DeleteSnapshot(partitionPath, cmd.Delete); err == nil {
+			cmd.Lines = append(cmd.Lines, fmt.Sprintf("snapshot %s of partition %s deleted", cmd.Delete, cmd.Id))
+		}
+	}
+
+	if err := sb.WriteSuperBlock(partitionPath, int64(mountedPartition.PartStart), int64(mountedPartition.PartStart+sb.Size())); err != nil {
+		return err
+	}
+
+	// users.txt may be back to an older version
+	if err == nil && cmd.Rollback != "" && cmd.Id == global.LoggedPartition {
+		global.ParserUserData(sb.GetFile(partitionPath, 0, []string{"users.txt"}))
+	}
+
+	return err
+}
+
+// commandList shows the snapshots of the partition, oldest first
+func (cmd *FsSnap) commandList() error {
+	if _, _, err := global.GetLoggedUser(); err != nil {
+		return fmt.Errorf("you must be logged in")
+	}
+
+	mountedPartition, partitionPath, err := global.GetMountedPartition(cmd.Id)
+	if err != nil {
+		return err
+	}
+
+	sb := &structures.SuperBlock{}
+	if err := sb.ReadSuperBlock(partitionPath, int64(mountedPartition.PartStart)); err != nil {
+		return err
+	}
+
+	snapshots, err := sb.ListSnapshots(partitionPath)
+	if err != nil {
+		return err
+	}
+
+	for _, snapshot := range snapshots {
+		cmd.Lines = append(cmd.Lines, fmt.Sprintf("%s taken on %s: %d inodes, %d blocks shared, %d copied since",
+			snapshot.Name, time.Unix(0, snapshot.Time).Format("02-Jan-2006 03:04 PM"),
+			snapshot.Inodes(), snapshot.Blocks(), snapshot.Saved()))
+	}
+
+	return nil
+}
+
+func (cmd *FsSnap) Print() string {
+	if cmd.List && len(cmd.Lines) == 0 {
+		return fmt.Sprintf("partition %s has no snapshots", cmd.Id)
+	}
+
+	return strings.Join(cmd.Lines, "\n")
+}
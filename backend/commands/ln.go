@@ -0,0 +1,152 @@
+package commands
+
+import (
+	"backend/global"
+	"backend/structures"
+	"backend/utils"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type Ln struct {
+	Path string
+	Dest string
+	S    bool
+}
+
+func ParserLn(tokens []string) (string, error) {
+	cmd := &Ln{}
+
+	args := strings.Join(tokens, " ")
+	re := regexp.MustCompile(`(?i)-path(?-i)="[^"]+"|(?i)-path(?-i)=\S+|(?i)-dest(?-i)="[^"]+"|(?i)-dest(?-i)=\S+|(?i)-s`)
+	matches := re.FindAllString(args, -1)
+
+	for _, match := range matches {
+		var key, value string
+		var err error
+
+		if strings.ToLower(match) == "-s" {
+			key = "-s"
+			value = ""
+		} else {
+			key, value, err = utils.ParseToken(match)
+			if err != nil {
+				return "", err
+			}
+
+			if strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
+				value = strings.Trim(value, "\"")
+			}
+		}
+
+		switch key {
+		case "-path":
+			if value == "" {
+				return "", fmt.Errorf("invalid path: %s", value)
+			}
+			cmd.Path = value
+		case "-dest":
+			if value == "" {
+				return "", fmt.Errorf("invalid dest: %s", value)
+			}
+			cmd.Dest = value
+		case "-s":
+			cmd.S = true
+		}
+	}
+
+	if cmd.Path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+
+	if cmd.Dest == "" {
+		return "", fmt.Errorf("dest is required")
+	}
+
+	if err := cmd.commandLn(); err != nil {
+		return "", err
+	}
+
+	return cmd.Print(), nil
+}
+
+func (cmd *Ln) commandLn() error {
+	creds, err := global.GetLoggedCredentials()
+	if err != nil {
+		return fmt.Errorf("you must be logged in")
+	}
+
+	mountedPartition, partitionPath, err := global.GetMountedPartition(global.LoggedPartition)
+	if err != nil {
+		return err
+	}
+
+	sb := &structures.SuperBlock{}
+	if err := sb.ReadSuperBlock(partitionPath, int64(mountedPartition.PartStart)); err != nil {
+		return err
+	}
+
+	dest, err := sb.ResolvePath(partitionPath, structures.SplitPath(cmd.Dest), false)
+	if err != nil {
+		return err
+	}
+
+	if err := sb.CheckCreate(partitionPath, dest, creds); err != nil {
+		return err
+	}
+
+	var target []string
+	if !cmd.S {
+		target, err = sb.ResolvePath(partitionPath, structures.SplitPath(cmd.Path), false)
+		if err != nil {
+			return err
+		}
+
+		if err := sb.CheckAccess(partitionPath, target, creds, 0); err != nil {
+			return err
+		}
+	}
+
+	entry := structures.JournalEntry{Operation: "ln", Path: cmd.Dest, Content: cmd.Path, Owner: creds}
+	if cmd.S {
+		entry.Flags |= structures.JournalSymbolic
+	}
+
+	release, err := sb.StartQuota(partitionPath, creds)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := sb.AddJournal(partitionPath, entry); err != nil {
+		return err
+	}
+
+	// a symbolic link whose target can not be written is removed again, the superblock
+	// is written in any case
+	if cmd.S {
+		missing := sb.MissingPath(partitionPath, dest)
+		err = sb.CreateSymlink(partitionPath, cmd.Path, dest, creds)
+		if err != nil {
+			if undoErr := sb.UndoCreate(partitionPath, missing); undoErr != nil {
+				err = undoErr
+			}
+		}
+	} else {
+		err = sb.CreateHardLink(partitionPath, target, dest)
+	}
+
+	if err := sb.WriteSuperBlock(partitionPath, int64(mountedPartition.PartStart), int64(mountedPartition.PartStart+sb.Size())); err != nil {
+		return err
+	}
+
+	return err
+}
+
+func (cmd *Ln) Print() string {
+	if cmd.S {
+		return fmt.Sprintf("symbolic link %s -> %s created successfully", cmd.Dest, cmd.Path)
+	}
+	return fmt.Sprintf("hard link %s -> %s created successfully", cmd.Dest, cmd.Path)
+}
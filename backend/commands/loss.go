@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"backend/global"
+	"backend/structures"
+	"backend/utils"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type Loss struct {
+	Id string
+}
+
+func ParserLoss(tokens []string) (string, error) {
+	cmd := &Loss{}
+
+	args := strings.Join(tokens, " ")
+	re := regexp.MustCompile(`(?i)-id(?-i)=\S+`)
+	matches := re.FindAllString(args, -1)
+
+	for _, match := range matches {
+		key, value, err := utils.ParseToken(match)
+		if err != nil {
+			return "", err
+		}
+
+		switch key {
+		case "-id":
+			if value == "" {
+				return "", fmt.Errorf("invalid id: %s", value)
+			}
+			cmd.Id = value
+		}
+	}
+
+	if cmd.Id == "" {
+		return "", fmt.Errorf("missing id")
+	}
+
+	if err := cmd.commandLoss(); err != nil {
+		return "", err
+	}
+
+	return cmd.Print(), nil
+}
+
+func (cmd *Loss) commandLoss() error {
+	if user, _, err := global.GetLoggedUser(); user != "root" || err != nil {
+		return fmt.Errorf("permission denied")
+	}
+
+	mountedPartition, partitionPath, err := global.GetMountedPartition(cmd.Id)
+	if err != nil {
+		return err
+	}
+
+	sb := &structures.SuperBlock{}
+	if err := sb.ReadSuperBlock(partitionPath, int64(mountedPartition.PartStart)); err != nil {
+		return err
+	}
+
+	if sb.SMagic != 0xEF53 {
+		return fmt.Errorf("partition %s is not formatted", cmd.Id)
+	}
+
+	return sb.SimulateLoss(partitionPath)
+}
+
+func (cmd *Loss) Print() string {
+	return fmt.Sprintf("bitmaps, inodes and blocks of partition %s were cleared", cmd.Id)
+}
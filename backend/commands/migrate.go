@@ -0,0 +1,85 @@
+package commands
+
+import (
+	"backend/global"
+	"backend/structures"
+	"backend/utils"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type Migrate struct {
+	Id string
+}
+
+func ParserMigrate(tokens []string) (string, error) {
+	cmd := &Migrate{}
+
+	args := strings.Join(tokens, " ")
+	re := regexp.MustCompile(`(?i)-id(?-i)=\S+`)
+	matches := re.FindAllString(args, -1)
+
+	for _, match := range matches {
+		key, value, err := utils.ParseToken(match)
+		if err != nil {
+			return "", err
+		}
+
+		switch key {
+		case "-id":
+			if value == "" {
+				return "", fmt.Errorf("invalid id: %s", value)
+			}
+			cmd.Id = value
+		}
+	}
+
+	if cmd.Id == "" {
+		return "", fmt.Errorf("missing id")
+	}
+
+	if err := cmd.commandMigrate(); err != nil {
+		return "", err
+	}
+
+	return cmd.Print(), nil
+}
+
+// commandMigrate does not require a session, users.txt can not be read
+// until the partition uses the current format
+func (cmd *Migrate) commandMigrate() error {
+	mountedPartition, partitionPath, err := global.GetMountedPartition(cmd.Id)
+	if err != nil {
+		return err
+	}
+
+	sb := &structures.SuperBlock{}
+	err = sb.ReadSuperBlock(partitionPath, int64(mountedPartition.PartStart))
+	if err == nil {
+		if sb.SMagic != 0xEF53 {
+			return fmt.Errorf("partition %s is not formatted", cmd.Id)
+		}
+		return fmt.Errorf("partition %s already uses revision %d", cmd.Id, sb.SRevision)
+	}
+
+	if !errors.Is(err, structures.ErrLegacyFormat) {
+		return err
+	}
+
+	sb, err = structures.MigratePartition(partitionPath, mountedPartition)
+	if err != nil {
+		return err
+	}
+
+	if err := sb.WriteSuperBlock(partitionPath, int64(mountedPartition.PartStart), int64(mountedPartition.PartStart+sb.Size())); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cmd *Migrate) Print() string {
+	return fmt.Sprintf("partition %s migrated to revision %d", cmd.Id, structures.CurrentRevision)
+}
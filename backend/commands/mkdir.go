@@ -4,7 +4,6 @@ import (
 	"backend/global"
 	"backend/structures"
 	"backend/utils"
-	"encoding/binary"
 	"fmt"
 	"regexp"
 	"strings"
@@ -63,7 +62,7 @@ func ParserMkDIR(tokens []string) (string, error) {
 }
 
 func (cmd *MkDIR) commandMkDIR() error {
-	_, _, err := global.GetLoggedUser()
+	creds, err := global.GetLoggedCredentials()
 	if err != nil {
 		return fmt.Errorf("you must be logged in")
 	}
@@ -86,15 +85,40 @@ func (cmd *MkDIR) commandMkDIR() error {
 		}
 	}
 
-	if err := sb.CreateNewInode(partitionPath, result, 0, false, cmd.P); err != nil {
+	if err := sb.CheckCreate(partitionPath, result, creds); err != nil {
 		return err
 	}
 
-	if err := sb.WriteSuperBlock(partitionPath, int64(mountedPartition.PartStart), int64(mountedPartition.PartStart+int32(binary.Size(sb)))); err != nil {
+	release, err := sb.StartQuota(partitionPath, creds)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := sb.AddJournal(partitionPath, structures.JournalEntry{Operation: "mkdir", Path: cmd.Path, Owner: creds}); err != nil {
+		return err
+	}
+
+	result, err = sb.ResolvePath(partitionPath, result, true)
+	if err != nil {
+		return err
+	}
+
+	// folders created before a failure are removed again, the superblock is written in
+	// any case
+	missing := sb.MissingPath(partitionPath, result)
+	err = sb.CreateNewInode(partitionPath, result, 0, false, cmd.P, creds)
+	if err != nil {
+		if undoErr := sb.UndoCreate(partitionPath, missing); undoErr != nil {
+			err = undoErr
+		}
+	}
+
+	if err := sb.WriteSuperBlock(partitionPath, int64(mountedPartition.PartStart), int64(mountedPartition.PartStart+sb.Size())); err != nil {
 		return err
 	}
 
-	return nil
+	return err
 }
 
 func (cmd *MkDIR) Print() string {
@@ -4,35 +4,36 @@ import (
 	"backend/global"
 	"backend/structures"
 	"backend/utils"
-	"encoding/binary"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"math"
 	"regexp"
 	"strconv"
 	"strings"
 )
 
 type MkFile struct {
-	Path string
-	R    bool
-	Size int
-	Cont string
+	Path     string
+	R        bool
+	Size     int
+	Cont     string
+	Sparse   bool
+	Compress bool
 }
 
 func ParserMkFile(tokens []string) (string, error) {
 	cmd := &MkFile{}
 
 	args := strings.Join(tokens, " ")
-	re := regexp.MustCompile(`(?i)-path(?-i)="[^"]+"|(?i)-path(?-i)=\S+|(?i)-r|(?i)-size(?-i)=\d+|(?i)-cont(?-i)="[^"]+"|(?i)-cont(?-i)=\S+`)
+	re := regexp.MustCompile(`(?i)-path(?-i)="[^"]+"|(?i)-path(?-i)=\S+|(?i)-r|(?i)-sparse|(?i)-compress|(?i)-size(?-i)=\d+|(?i)-cont(?-i)="[^"]+"|(?i)-cont(?-i)=\S+`)
 	matches := re.FindAllString(args, -1)
 
 	for _, match := range matches {
 		var key, value string
 		var err error
 
-		if match == "-r" {
-			key = "-r"
+		if lower := strings.ToLower(match); lower == "-r" || lower == "-sparse" || lower == "-compress" {
+			key = lower
 			value = ""
 		} else {
 			key, value, err = utils.ParseToken(match)
@@ -53,9 +54,13 @@ func ParserMkFile(tokens []string) (string, error) {
 			cmd.Path = value
 		case "-r":
 			cmd.R = true
+		case "-sparse":
+			cmd.Sparse = true
+		case "-compress":
+			cmd.Compress = true
 		case "-size":
 			num, err := strconv.Atoi(value)
-			if err != nil || num < 0 {
+			if err != nil || num < 0 || num > math.MaxInt32 {
 				return "", fmt.Errorf("invalid size: %d", num)
 			}
 			cmd.Size = num
@@ -71,6 +76,10 @@ func ParserMkFile(tokens []string) (string, error) {
 		return "", fmt.Errorf("path is required")
 	}
 
+	if cmd.Sparse && cmd.Cont != "" {
+		return "", fmt.Errorf("sparse files can not be created from cont")
+	}
+
 	if err := cmd.commandMkFile(); err != nil {
 		return "", err
 	}
@@ -79,7 +88,27 @@ func ParserMkFile(tokens []string) (string, error) {
 }
 
 func (cmd *MkFile) commandMkFile() error {
-	_, _, err := global.GetLoggedUser()
+	if cmd.Sparse {
+		return cmd.createFile("")
+	}
+
+	fileContent := generateNumberString(cmd.Size)
+	if cmd.Cont != "" {
+		content, err := ioutil.ReadFile(cmd.Cont)
+		if err != nil {
+			return fmt.Errorf("error reading file %s: %v", cmd.Cont, err)
+		}
+		fileContent = string(content)
+	}
+
+	return cmd.createFile(fileContent)
+}
+
+// createFile creates the file at cmd.Path with the given content, a sparse file
+// gets no content and cmd.Size bytes of hole and a compressed file is marked before
+// anything is written
+func (cmd *MkFile) createFile(fileContent string) error {
+	creds, err := global.GetLoggedCredentials()
 	if err != nil {
 		return fmt.Errorf("you must be logged in")
 	}
@@ -102,32 +131,61 @@ func (cmd *MkFile) commandMkFile() error {
 		}
 	}
 
-	if err := sb.CreateNewInode(partitionPath, result, 0, true, cmd.R); err != nil {
+	if err := sb.CheckCreate(partitionPath, result, creds); err != nil {
+		return err
+	}
+
+	release, err := sb.StartQuota(partitionPath, creds)
+	if err != nil {
 		return err
 	}
+	defer release()
+
+	// content generated from -size is journaled as its size, recovery generates it again
+	entry := structures.JournalEntry{Operation: "mkfile", Path: cmd.Path, Content: fileContent, Owner: creds}
+	if cmd.Sparse {
+		entry.Flags |= structures.JournalSparse
+		entry.Size = int32(cmd.Size)
+	} else if cmd.Cont == "" && cmd.Size > 0 {
+		entry.Content = ""
+		entry.Size = int32(cmd.Size)
+	}
+	if cmd.Compress {
+		entry.Flags |= structures.JournalCompress
+	}
 
-	cont := generateNumberString(cmd.Size)
-	if _, err := sb.WriteFile(partitionPath, int32(0), result, cont); err != nil {
+	if err := sb.AddJournal(partitionPath, entry); err != nil {
 		return err
 	}
 
-	if cmd.Cont != "" {
-		content, err := ioutil.ReadFile(cmd.Cont)
-		if err != nil {
-			log.Fatalf("Error al leer el archivo: %v", err)
-		}
+	result, err = sb.ResolvePath(partitionPath, result, true)
+	if err != nil {
+		return err
+	}
 
-		fileContent := string(content)
-		if _, err := sb.WriteFile(partitionPath, int32(0), result, fileContent); err != nil {
-			return err
+	// a file that can not be written completely is removed again with the folders created
+	// for it, the superblock is written in any case
+	missing := sb.MissingPath(partitionPath, result)
+	err = sb.CreateNewInode(partitionPath, result, 0, true, cmd.R, creds)
+	if err == nil && cmd.Compress {
+		err = sb.SetCompression(partitionPath, result, true)
+	}
+	if err == nil && cmd.Sparse {
+		err = sb.ExtendFile(partitionPath, result, int32(cmd.Size))
+	} else if err == nil {
+		_, err = sb.WriteFile(partitionPath, int32(0), result, fileContent)
+	}
+	if err != nil {
+		if undoErr := sb.UndoCreate(partitionPath, missing); undoErr != nil {
+			err = undoErr
 		}
 	}
 
-	if err := sb.WriteSuperBlock(partitionPath, int64(mountedPartition.PartStart), int64(mountedPartition.PartStart+int32(binary.Size(sb)))); err != nil {
+	if err := sb.WriteSuperBlock(partitionPath, int64(mountedPartition.PartStart), int64(mountedPartition.PartStart+sb.Size())); err != nil {
 		return err
 	}
 
-	return nil
+	return err
 }
 
 func generateNumberString(n int) string {
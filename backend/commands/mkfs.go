@@ -4,28 +4,45 @@ import (
 	"backend/global"
 	"backend/structures"
 	"backend/utils"
-	"encoding/binary"
+	"errors"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
 type MkFs struct {
-	Id   string
-	Type string
+	Id       string
+	Type     string
+	Fs       string
+	Names    string
+	Bs       int
+	Ratio    int
+	DirIndex bool
+	Inline   bool
+	Trash    bool
+	Force    bool
 }
 
 func ParserMkFs(tokens []string) (string, error) {
 	cmd := &MkFs{}
 
 	args := strings.Join(tokens, " ")
-	re := regexp.MustCompile(`(?i)-id(?-i)=\S+|(?i)-type(?-i)=\S+`)
+	re := regexp.MustCompile(`(?i)-id(?-i)=\S+|(?i)-type(?-i)=\S+|(?i)-fs(?-i)=\S+|(?i)-names(?-i)=\S+|(?i)-bs(?-i)=\S+|(?i)-ratio(?-i)=\S+|(?i)-dirindex|(?i)-inline|(?i)-trash|(?i)-force`)
 	matches := re.FindAllString(args, -1)
 
 	for _, match := range matches {
-		key, value, err := utils.ParseToken(match)
-		if err != nil {
-			return "", err
+		var key, value string
+		var err error
+
+		if flag := strings.ToLower(match); flag == "-force" || flag == "-dirindex" || flag == "-inline" || flag == "-trash" {
+			key = flag
+			value = ""
+		} else {
+			key, value, err = utils.ParseToken(match)
+			if err != nil {
+				return "", err
+			}
 		}
 
 		switch key {
@@ -35,10 +52,43 @@ func ParserMkFs(tokens []string) (string, error) {
 			}
 			cmd.Id = value
 		case "-type":
-			if strings.ToLower(value) != "full" {
+			value = strings.ToLower(value)
+			if value != "full" && value != "fast" {
 				return "", fmt.Errorf("invalid type: %s", value)
 			}
 			cmd.Type = value
+		case "-fs":
+			value = strings.ToLower(value)
+			if value != "2fs" && value != "3fs" {
+				return "", fmt.Errorf("invalid fs: %s", value)
+			}
+			cmd.Fs = value
+		case "-names":
+			value = strings.ToLower(value)
+			if value != "short" && value != "long" {
+				return "", fmt.Errorf("invalid names: %s", value)
+			}
+			cmd.Names = value
+		case "-bs":
+			num, err := strconv.Atoi(value)
+			if err != nil || (num != 64 && num != 128 && num != 256 && num != 512 && num != 1024) {
+				return "", fmt.Errorf("invalid bs: %s, must be 64, 128, 256, 512 or 1024", value)
+			}
+			cmd.Bs = num
+		case "-ratio":
+			num, err := strconv.Atoi(value)
+			if err != nil || num < 1 {
+				return "", fmt.Errorf("invalid ratio: %s, must be a positive number of blocks per inode", value)
+			}
+			cmd.Ratio = num
+		case "-dirindex":
+			cmd.DirIndex = true
+		case "-inline":
+			cmd.Inline = true
+		case "-trash":
+			cmd.Trash = true
+		case "-force":
+			cmd.Force = true
 		}
 	}
 
@@ -50,6 +100,22 @@ func ParserMkFs(tokens []string) (string, error) {
 		cmd.Type = "full"
 	}
 
+	if cmd.Fs == "" {
+		cmd.Fs = "2fs"
+	}
+
+	if cmd.Names == "" {
+		cmd.Names = "short"
+	}
+
+	if cmd.Bs == 0 {
+		cmd.Bs = 64
+	}
+
+	if cmd.Ratio == 0 {
+		cmd.Ratio = 3
+	}
+
 	if err := cmd.commandMkFs(); err != nil {
 		return "", err
 	}
@@ -67,15 +133,57 @@ func (cmd *MkFs) commandMkFs() error {
 	fmt.Println("MOUNTED PARTITION: ")
 	mountedPartition.Print()
 
-	n := mountedPartition.CalculateN()
+	current := &structures.SuperBlock{}
+	err = current.ReadSuperBlock(partitionPath, int64(mountedPartition.PartStart))
+	formatted := errors.Is(err, structures.ErrLegacyFormat) || current.SMagic == 0xEF53
+	if formatted && !cmd.Force {
+		return fmt.Errorf("partition %s is already formatted, use -force to reformat it", cmd.Id)
+	}
+
+	opts := structures.DefaultFormatOptions()
+	opts.BlockSize = int32(cmd.Bs)
+	opts.Ratio = int32(cmd.Ratio)
+	if cmd.Fs == "3fs" {
+		opts.FsType = 3
+	}
+	if cmd.Names == "long" {
+		opts.Features |= structures.FeatureLongNames
+	}
+	if cmd.DirIndex {
+		opts.Features |= structures.FeatureDirIndex
+	}
+	if cmd.Inline {
+		opts.Features |= structures.FeatureInlineData
+	}
+	if cmd.Trash {
+		opts.Features |= structures.FeatureTrash
+	}
+
+	n := mountedPartition.CalculateN(opts)
 	fmt.Println("N: ", n)
 
+	if n < 2 {
+		return fmt.Errorf("partition %s is too small for bs=%d and ratio=%d", cmd.Id, cmd.Bs, cmd.Ratio)
+	}
+
+	// full clears the old contents, fast only rewrites the metadata (the journal
+	// is part of it, stale entries must never be replayed)
+	if cmd.Type == "full" {
+		if err := utils.ZeroFill(partitionPath, int64(mountedPartition.PartStart), int64(mountedPartition.PartStart+mountedPartition.PartSize)); err != nil {
+			return err
+		}
+	}
+
 	superBlock := structures.SuperBlock{}
-	superBlock.CreateSuperBlock(mountedPartition.PartStart, n)
+	superBlock.CreateSuperBlock(mountedPartition.PartStart, n, opts)
 
 	fmt.Println("SUPER BLOCK: ")
 	superBlock.Print()
 
+	if err := superBlock.CreateJournal(partitionPath); err != nil {
+		return err
+	}
+
 	if err := superBlock.CreateBitMaps(partitionPath); err != nil {
 		return err
 	}
@@ -86,7 +194,7 @@ func (cmd *MkFs) commandMkFs() error {
 
 	superBlock.Print()
 
-	if err := superBlock.WriteSuperBlock(partitionPath, int64(mountedPartition.PartStart), int64(mountedPartition.PartStart+int32(binary.Size(superBlock)))); err != nil {
+	if err := superBlock.WriteSuperBlock(partitionPath, int64(mountedPartition.PartStart), int64(mountedPartition.PartStart+superBlock.Size())); err != nil {
 		return err
 	}
 
@@ -4,7 +4,6 @@ import (
 	"backend/global"
 	"backend/structures"
 	"backend/utils"
-	"encoding/binary"
 	"fmt"
 	"regexp"
 	"strings"
@@ -80,6 +79,11 @@ func (cmd *MkUSR) commandMkUSR() error {
 		return fmt.Errorf("permission denied")
 	}
 
+	creds, err := global.GetLoggedCredentials()
+	if err != nil {
+		return err
+	}
+
 	mountedPartition, partitionPath, err := global.GetMountedPartition(global.LoggedPartition)
 	if err != nil {
 		return err
@@ -100,11 +104,15 @@ func (cmd *MkUSR) commandMkUSR() error {
 		return err
 	}
 
+	if err := sb.AddJournal(partitionPath, structures.JournalEntry{Operation: "mkusr", Path: "/users.txt", Content: strings.Join([]string{cmd.User, cmd.Pass, cmd.Grp}, ","), Owner: creds}); err != nil {
+		return err
+	}
+
 	if _, err := sb.WriteFile(partitionPath, int32(0), array, global.ConvertToString()); err != nil {
 		return err
 	}
 
-	if err := sb.WriteSuperBlock(partitionPath, int64(mountedPartition.PartStart), int64(mountedPartition.PartStart+int32(binary.Size(sb)))); err != nil {
+	if err := sb.WriteSuperBlock(partitionPath, int64(mountedPartition.PartStart), int64(mountedPartition.PartStart+sb.Size())); err != nil {
 		return err
 	}
 
@@ -0,0 +1,281 @@
+package commands
+
+import (
+	"backend/global"
+	"backend/structures"
+	"backend/utils"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Quota struct {
+	User   string
+	Grp    string
+	Limits map[string]int32 // -isoft, -ihard, -bsoft and -bhard given on the command line
+	Lines  []string
+}
+
+func ParserQuota(tokens []string) (string, error) {
+	cmd := &Quota{Limits: make(map[string]int32)}
+
+	args := strings.Join(tokens, " ")
+	re := regexp.MustCompile(`(?i)-user(?-i)=\S+|(?i)-grp(?-i)=\S+|(?i)-isoft(?-i)=\S+|(?i)-ihard(?-i)=\S+|(?i)-bsoft(?-i)=\S+|(?i)-bhard(?-i)=\S+`)
+	matches := re.FindAllString(args, -1)
+
+	for _, match := range matches {
+		key, value, err := utils.ParseToken(match)
+		if err != nil {
+			return "", err
+		}
+
+		switch key {
+		case "-user":
+			if value == "" {
+				return "", fmt.Errorf("invalid user: %s", value)
+			}
+			cmd.User = value
+		case "-grp":
+			if value == "" {
+				return "", fmt.Errorf("invalid grp: %s", value)
+			}
+			cmd.Grp = value
+		case "-isoft", "-ihard", "-bsoft", "-bhard":
+			num, err := strconv.Atoi(value)
+			if err != nil || num < 0 {
+				return "", fmt.Errorf("invalid %s: %s, must be 0 (unlimited) or a positive number", key[1:], value)
+			}
+			cmd.Limits[key] = int32(num)
+		}
+	}
+
+	if cmd.User != "" && cmd.Grp != "" {
+		return "", fmt.Errorf("use either user or grp, not both")
+	}
+
+	if len(cmd.Limits) > 0 {
+		if cmd.User == "" && cmd.Grp == "" {
+			return "", fmt.Errorf("user or grp is required to set limits")
+		}
+
+		if err := cmd.commandSetQuota(); err != nil {
+			return "", err
+		}
+	}
+
+	if err := cmd.commandShowQuota(); err != nil {
+		return "", err
+	}
+
+	return cmd.Print(), nil
+}
+
+// target resolves -user or -grp to the record type and id
+func (cmd *Quota) target() (byte, int32, error) {
+	if cmd.User != "" {
+		user := global.GetInfoUser(cmd.User)
+		id, err := strconv.Atoi(user.ID)
+		if user.ID == "" || err != nil {
+			return 0, 0, fmt.Errorf("user does not exist: %s", cmd.User)
+		}
+		return 'U', int32(id), nil
+	}
+
+	group := global.GetInfoGroup(cmd.Grp)
+	id, err := strconv.Atoi(group.ID)
+	if group.ID == "" || err != nil {
+		return 0, 0, fmt.Errorf("group does not exist: %s", cmd.Grp)
+	}
+	return 'G', int32(id), nil
+}
+
+func (cmd *Quota) commandSetQuota() error {
+	if user, _, err := global.GetLoggedUser(); user != "root" || err != nil {
+		return fmt.Errorf("permission denied")
+	}
+
+	creds, err := global.GetLoggedCredentials()
+	if err != nil {
+		return err
+	}
+
+	mountedPartition, partitionPath, err := global.GetMountedPartition(global.LoggedPartition)
+	if err != nil {
+		return err
+	}
+
+	sb := &structures.SuperBlock{}
+	if err := sb.ReadSuperBlock(partitionPath, int64(mountedPartition.PartStart)); err != nil {
+		return err
+	}
+
+	kind, id, err := cmd.target()
+	if err != nil {
+		return err
+	}
+
+	records := sb.ReadQuotaRecords(partitionPath)
+	record := structures.FindQuotaRecord(records, kind, id)
+	if record == nil {
+		records = append(records, structures.QuotaRecord{Type: kind, ID: id})
+		record = &records[len(records)-1]
+	}
+
+	for key, value := range cmd.Limits {
+		switch key {
+		case "-isoft":
+			record.InodeSoft = value
+		case "-ihard":
+			record.InodeHard = value
+		case "-bsoft":
+			record.BlockSoft = value
+		case "-bhard":
+			record.BlockHard = value
+		}
+	}
+
+	name := cmd.User + cmd.Grp
+	content := fmt.Sprintf("%c,%s,%d,%d,%d,%d", kind, name, record.InodeSoft, record.InodeHard, record.BlockSoft, record.BlockHard)
+	if err := sb.AddJournal(partitionPath, structures.JournalEntry{Operation: "quota", Path: "/" + structures.QuotaFile, Content: content, Owner: creds}); err != nil {
+		return err
+	}
+
+	if err := sb.WriteQuotaRecords(partitionPath, records); err != nil {
+		return err
+	}
+
+	if err := sb.WriteSuperBlock(partitionPath, int64(mountedPartition.PartStart), int64(mountedPartition.PartStart+sb.Size())); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// commandShowQuota lists usage and limits, root sees every record and other
+// users only their own user and group
+func (cmd *Quota) commandShowQuota() error {
+	user, _, err := global.GetLoggedUser()
+	if err != nil {
+		return fmt.Errorf("you must be logged in")
+	}
+
+	uid, gid, err := global.GetLoggedUserIDs()
+	if err != nil {
+		return err
+	}
+
+	mountedPartition, partitionPath, err := global.GetMountedPartition(global.LoggedPartition)
+	if err != nil {
+		return err
+	}
+
+	sb := &structures.SuperBlock{}
+	if err := sb.ReadSuperBlock(partitionPath, int64(mountedPartition.PartStart)); err != nil {
+		return err
+	}
+
+	records := sb.ReadQuotaRecords(partitionPath)
+	if cmd.User != "" || cmd.Grp != "" {
+		kind, id, err := cmd.target()
+		if err != nil {
+			return err
+		}
+
+		record := structures.FindQuotaRecord(records, kind, id)
+		if record == nil {
+			return fmt.Errorf("no quota set for %s", cmd.User+cmd.Grp)
+		}
+		records = []structures.QuotaRecord{*record}
+	}
+
+	if user != "root" {
+		var own []structures.QuotaRecord
+		for _, record := range records {
+			if (record.Type == 'U' && record.ID == uid) || (record.Type == 'G' && record.ID == gid) {
+				own = append(own, record)
+			}
+		}
+
+		if len(own) < len(records) && (cmd.User != "" || cmd.Grp != "") {
+			return fmt.Errorf("permission denied")
+		}
+		records = own
+	}
+
+	users, groups, err := sb.QuotaUsage(partitionPath)
+	if err != nil {
+		return err
+	}
+
+	names := quotaNames()
+	for _, record := range records {
+		usage := users[record.ID]
+		label := "user"
+		if record.Type == 'G' {
+			usage = groups[record.ID]
+			label = "group"
+		}
+
+		name := names[fmt.Sprintf("%c%d", record.Type, record.ID)]
+		if name == "" {
+			name = fmt.Sprintf("#%d", record.ID)
+		}
+
+		cmd.Lines = append(cmd.Lines, fmt.Sprintf("%s %s: inodes %s, blocks %s", label, name,
+			quotaField(usage.Inodes, record.InodeSoft, record.InodeHard),
+			quotaField(usage.Blocks, record.BlockSoft, record.BlockHard)))
+	}
+
+	return nil
+}
+
+// quotaNames maps "U<uid>" and "G<gid>" to the names in users.txt
+func quotaNames() map[string]string {
+	names := make(map[string]string)
+
+	for name, groups := range global.Groups {
+		for _, group := range groups {
+			if group.ID != "0" {
+				names["G"+group.ID] = name
+			}
+		}
+	}
+
+	for name, users := range global.Users {
+		for _, user := range users {
+			if user.UserGroup.ID != "0" {
+				names["U"+user.ID] = name
+			}
+		}
+	}
+
+	return names
+}
+
+// quotaField formats usage and limits, a * marks usage over the soft limit
+func quotaField(used, soft, hard int32) string {
+	mark := ""
+	if soft > 0 && used > soft {
+		mark = "*"
+	}
+
+	limit := func(value int32) string {
+		if value == 0 {
+			return "none"
+		}
+		return strconv.Itoa(int(value))
+	}
+
+	return fmt.Sprintf("%d%s (soft %s, hard %s)", used, mark, limit(soft), limit(hard))
+}
+
+func (cmd *Quota) Print() string {
+	if len(cmd.Lines) == 0 {
+		return "no quotas set"
+	}
+
+	sort.Strings(cmd.Lines)
+	return strings.Join(cmd.Lines, "\n")
+}
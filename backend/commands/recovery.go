@@ -0,0 +1,253 @@
+package commands
+
+import (
+	"backend/global"
+	"backend/structures"
+	"backend/utils"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type Recovery struct {
+	Id     string
+	Failed []string
+}
+
+func ParserRecovery(tokens []string) (string, error) {
+	cmd := &Recovery{}
+
+	args := strings.Join(tokens, " ")
+	re := regexp.MustCompile(`(?i)-id(?-i)=\S+`)
+	matches := re.FindAllString(args, -1)
+
+	for _, match := range matches {
+		key, value, err := utils.ParseToken(match)
+		if err != nil {
+			return "", err
+		}
+
+		switch key {
+		case "-id":
+			if value == "" {
+				return "", fmt.Errorf("invalid id: %s", value)
+			}
+			cmd.Id = value
+		}
+	}
+
+	if cmd.Id == "" {
+		return "", fmt.Errorf("missing id")
+	}
+
+	if err := cmd.commandRecovery(); err != nil {
+		return "", err
+	}
+
+	return cmd.Print(), nil
+}
+
+func (cmd *Recovery) commandRecovery() error {
+	if user, _, err := global.GetLoggedUser(); user != "root" || err != nil {
+		return fmt.Errorf("permission denied")
+	}
+
+	mountedPartition, partitionPath, err := global.GetMountedPartition(cmd.Id)
+	if err != nil {
+		return err
+	}
+
+	sb := &structures.SuperBlock{}
+	if err := sb.ReadSuperBlock(partitionPath, int64(mountedPartition.PartStart)); err != nil {
+		return err
+	}
+
+	if !sb.IsJournaling() {
+		return fmt.Errorf("partition %s is not an EXT3 filesystem", cmd.Id)
+	}
+
+	journals, err := sb.GetJournals(partitionPath)
+	if err != nil {
+		return err
+	}
+
+	if err := sb.Reinitialize(partitionPath); err != nil {
+		return err
+	}
+
+	// snapshots are taken again by their entries, the trash may have been toggled after
+	// earlier entries were written so replay starts from the state before the first toggle
+	sb.SFeatures &^= structures.FeatureSnapshots
+	for i, journal := range journals {
+		if content := structures.JournalContent(journals[i:]); journal.GetOperation() == "trash" && (content == "-enable" || content == "-disable") {
+			if content == "-enable" {
+				sb.SFeatures &^= structures.FeatureTrash
+			} else {
+				sb.SFeatures |= structures.FeatureTrash
+			}
+			break
+		}
+	}
+
+	// replayed commands journal themselves again from the first slot, they write the same
+	// entries the journal held and the original journal is written back at the end
+	sb.SJournalNext = 0
+
+	if err := sb.WriteSuperBlock(partitionPath, int64(mountedPartition.PartStart), int64(mountedPartition.PartStart+sb.Size())); err != nil {
+		return err
+	}
+
+	// Entries are replayed on the recovered partition as the users that wrote them, the
+	// session is restored afterwards
+	loggedUser, loggedPartition := global.LoggedUser, global.LoggedPartition
+	users, groups := global.Users, global.Groups
+	defer func() {
+		global.LoggedUser, global.LoggedPartition = loggedUser, loggedPartition
+		global.Users, global.Groups = users, groups
+	}()
+
+	global.LoggedPartition = cmd.Id
+	global.ParserUserData(sb.GetFile(partitionPath, 0, []string{"users.txt"}))
+
+	for i, journal := range journals {
+		if journal.IsContinuation() {
+			continue
+		}
+
+		if err := replayJournal(journal, structures.JournalContent(journals[i:])); err != nil {
+			cmd.Failed = append(cmd.Failed, fmt.Sprintf("entry %d (%s %s): %s",
+				journal.JCount, journal.GetOperation(), journal.GetPath(), err.Error()))
+		}
+	}
+
+	// the original journal is written back over the entries of the replayed commands
+	if err := sb.ReadSuperBlock(partitionPath, int64(mountedPartition.PartStart)); err != nil {
+		return err
+	}
+
+	return sb.WriteJournals(partitionPath, journals)
+}
+
+// replayJournal executes a journal entry through the command that created it, logged in
+// with the uid and gid stored in the entry. content is the entry joined with its
+// continuation records. An entry whose path or content was cut to fit the journal is not
+// replayed
+func replayJournal(journal structures.Journal, content string) error {
+	if journal.IsTruncated(content) {
+		return fmt.Errorf("entry was truncated in the journal")
+	}
+
+	uid, gid := strconv.Itoa(int(journal.JContent.IUid)), strconv.Itoa(int(journal.JContent.IGid))
+	user := global.GetInfoUserByID(uid)
+	if user.Username == "" {
+		return fmt.Errorf("no user has uid %s", uid)
+	}
+	if user.UserGroup.ID != gid {
+		return fmt.Errorf("user %s is not in group %s", user.Username, gid)
+	}
+	global.LoggedUser = user.Username
+
+	path := journal.GetPath()
+	fields := strings.Split(content, ",")
+
+	switch journal.GetOperation() {
+	case "mkdir":
+		return (&MkDIR{Path: path, P: true}).commandMkDIR()
+	case "mkfile":
+		cmd := &MkFile{Path: path, R: true, Compress: journal.HasFlag(structures.JournalCompress)}
+		cmd.Size = int(journal.JContent.ISize)
+		if journal.HasFlag(structures.JournalSparse) {
+			cmd.Sparse = true
+			return cmd.createFile("")
+		}
+		if cmd.Size > 0 {
+			return cmd.createFile(generateNumberString(cmd.Size))
+		}
+		return cmd.createFile(content)
+	case "mkgrp":
+		return (&MkGRP{Name: content}).commandMkGRP()
+	case "rmgrp":
+		return (&RmGRP{Name: content}).commandRmGRP()
+	case "mkusr":
+		if len(fields) != 3 {
+			return fmt.Errorf("invalid content: %s", content)
+		}
+		return (&MkUSR{User: fields[0], Pass: fields[1], Grp: fields[2]}).commandMkUSR()
+	case "rmusr":
+		return (&RmUSR{User: content}).commandRmUSR()
+	case "chgrp":
+		if len(fields) != 2 {
+			return fmt.Errorf("invalid content: %s", content)
+		}
+		return (&ChGRP{User: fields[0], GRP: fields[1]}).commandChGRP()
+	case "chmod":
+		options := strings.Fields(content)
+		if len(options) == 0 {
+			return fmt.Errorf("invalid content: %s", content)
+		}
+		return (&Chmod{Path: path, Ugo: options[0], R: len(options) > 1}).commandChmod()
+	case "ln":
+		return (&Ln{Path: content, Dest: path, S: journal.HasFlag(structures.JournalSymbolic)}).commandLn()
+	case "setxattr":
+		name, value, ok := strings.Cut(content, "=")
+		if !ok {
+			return fmt.Errorf("invalid content: %s", content)
+		}
+		return (&SetXattr{Path: path, Name: name, Value: value}).commandSetXattr()
+	case "rmxattr":
+		return (&RmXattr{Path: path, Name: content}).commandRmXattr()
+	case "quota":
+		if len(fields) != 6 {
+			return fmt.Errorf("invalid content: %s", content)
+		}
+		cmd := &Quota{Limits: make(map[string]int32)}
+		if fields[0] == "U" {
+			cmd.User = fields[1]
+		} else {
+			cmd.Grp = fields[1]
+		}
+		for i, key := range []string{"-isoft", "-ihard", "-bsoft", "-bhard"} {
+			value, err := strconv.Atoi(fields[i+2])
+			if err != nil {
+				return fmt.Errorf("invalid content: %s", content)
+			}
+			cmd.Limits[key] = int32(value)
+		}
+		return cmd.commandSetQuota()
+	case "remove":
+		return (&Remove{Path: path}).commandRemove()
+	case "trash":
+		return replayTrash(content)
+	case "chattr":
+		if content != "-compress" && content != "-decompress" {
+			return fmt.Errorf("invalid content: %s", content)
+		}
+		return (&Chattr{Path: path, Compress: content == "-compress"}).commandChattr()
+	case "fssnap":
+		cmd := &FsSnap{Id: global.LoggedPartition}
+		option, name, _ := strings.Cut(content, "=")
+		switch option {
+		case "-create":
+			cmd.Create = name
+		case "-rollback":
+			cmd.Rollback = name
+		case "-delete":
+			cmd.Delete = name
+		default:
+			return fmt.Errorf("invalid content: %s", content)
+		}
+		return cmd.commandFsSnap()
+	default:
+		return fmt.Errorf("unknown operation: %s", journal.GetOperation())
+	}
+}
+
+func (cmd *Recovery) Print() string {
+	if len(cmd.Failed) == 0 {
+		return fmt.Sprintf("partition %s recovered successfully", cmd.Id)
+	}
+
+	return fmt.Sprintf("partition %s recovered, %d entries could not be replayed:\n%s",
+		cmd.Id, len(cmd.Failed), strings.Join(cmd.Failed, "\n"))
+}
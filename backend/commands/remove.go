@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"backend/global"
+	"backend/structures"
+	"backend/utils"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type Remove struct {
+	Path    string
+	TrashID int32 // id of the trash record when the entry was moved to the trash
+}
+
+func ParserRemove(tokens []string) (string, error) {
+	cmd := &Remove{}
+
+	args := strings.Join(tokens, " ")
+	re := regexp.MustCompile(`(?i)-path(?-i)="[^"]+"|(?i)-path(?-i)=\S+`)
+	matches := re.FindAllString(args, -1)
+
+	for _, match := range matches {
+		key, value, err := utils.ParseToken(match)
+		if err != nil {
+			return "", err
+		}
+
+		if strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
+			value = strings.Trim(value, "\"")
+		}
+
+		switch key {
+		case "-path":
+			if value == "" {
+				return "", fmt.Errorf("invalid path: %s", value)
+			}
+			cmd.Path = value
+		}
+	}
+
+	if cmd.Path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+
+	if err := cmd.commandRemove(); err != nil {
+		return "", err
+	}
+
+	return cmd.Print(), nil
+}
+
+// commandRemove unlinks the path, moving it to the trash when the filesystem has one.
+// Write access on the folder holding it is required, like for creating it, and on every
+// folder below it that is not empty
+func (cmd *Remove) commandRemove() error {
+	creds, err := global.GetLoggedCredentials()
+	if err != nil {
+		return fmt.Errorf("you must be logged in")
+	}
+
+	mountedPartition, partitionPath, err := global.GetMountedPartition(global.LoggedPartition)
+	if err != nil {
+		return err
+	}
+
+	sb := &structures.SuperBlock{}
+	if err := sb.ReadSuperBlock(partitionPath, int64(mountedPartition.PartStart)); err != nil {
+		return err
+	}
+
+	filePath, err := sb.ResolvePath(partitionPath, structures.SplitPath(cmd.Path), false)
+	if err != nil {
+		return err
+	}
+
+	if err := sb.CheckRemove(partitionPath, filePath, creds); err != nil {
+		return err
+	}
+
+	release, err := sb.StartQuota(partitionPath, creds)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := sb.AddJournal(partitionPath, structures.JournalEntry{Operation: "remove", Path: cmd.Path, Owner: creds}); err != nil {
+		return err
+	}
+
+	// the superblock is written even when removing fails, blocks may already be freed
+	if sb.HasFeature(structures.FeatureTrash) {
+		var record structures.TrashRecord
+		record, err = sb.TrashPath(partitionPath, filePath, creds.UID)
+		cmd.TrashID = record.ID
+	} else {
+		err = sb.RemovePath(partitionPath, filePath)
+	}
+
+	if err := sb.WriteSuperBlock(partitionPath, int64(mountedPartition.PartStart), int64(mountedPartition.PartStart+sb.Size())); err != nil {
+		return err
+	}
+
+	return err
+}
+
+func (cmd *Remove) Print() string {
+	if cmd.TrashID != 0 {
+		return fmt.Sprintf("%s moved to trash with id %d", cmd.Path, cmd.TrashID)
+	}
+	return fmt.Sprintf("%s removed successfully", cmd.Path)
+}
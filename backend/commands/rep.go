@@ -6,11 +6,14 @@ import (
 	"backend/utils"
 	"fmt"
 	"github.com/goccy/go-graphviz"
+	"html"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type REP struct {
@@ -112,12 +115,15 @@ func (cmd *REP) commandREP() error {
 		return cmd.repSB()
 	case "file":
 		return cmd.repFile()
+	case "tree":
+		return cmd.repTree()
 	case "ls":
-		//return cmd.repLS()
+		return cmd.repLS()
+	case "journaling":
+		return cmd.repJournaling()
 	default:
 		return fmt.Errorf("invalid name: %s", cmd.Name)
 	}
-	return nil
 }
 
 func (cmd *REP) repMBR() error {
@@ -293,15 +299,20 @@ func (cmd *REP) repInode() error {
 	sb.WriteString("\tnode [shape=plaintext];\n")
 	sb.WriteString("\trankdir=LR;\n")
 
+	usedInodes, err := superBlock.GetUsedInodes(path)
+	if err != nil {
+		return err
+	}
+
 	inode := &structures.Inode{}
-	for i := int32(0); i < superBlock.SInodesCount; i++ {
+	for j, i := range usedInodes {
 		if err := inode.ReadInode(path, int64(superBlock.SInodeStart+(i*superBlock.SInodeSize))); err != nil {
 			return err
 		}
 		sb.WriteString(inode.GetStringBuilder(fmt.Sprintf("Inodo_%d", i)))
 
-		if i < superBlock.SInodesCount-1 {
-			sb.WriteString(fmt.Sprintf("Inodo_%d -> Inodo_%d\n", i, i+1))
+		if j < len(usedInodes)-1 {
+			sb.WriteString(fmt.Sprintf("Inodo_%d -> Inodo_%d\n", i, usedInodes[j+1]))
 		}
 	}
 
@@ -327,14 +338,24 @@ func (cmd *REP) repBlock() error {
 	sb.WriteString("\tnode [shape=plaintext];\n")
 	sb.WriteString("\trankdir=LR;\n")
 
+	usedInodes, err := superBlock.GetUsedInodes(path)
+	if err != nil {
+		return err
+	}
+
 	inode := &structures.Inode{}
-	for i := int32(0); i < superBlock.SInodesCount; i++ {
+	for _, i := range usedInodes {
 		if err := inode.ReadInode(path, int64(superBlock.SInodeStart+(i*superBlock.SInodeSize))); err != nil {
 			return err
 		}
 
 		sb.WriteString(inode.GetStringBuilder(fmt.Sprintf("Inodo_%d", i)))
 
+		// inline files keep their content in the inode
+		if inode.IsInline() {
+			continue
+		}
+
 		// Determine the block type and its corresponding handler
 		blockType := inode.IType
 		var readBlock func(path string, blockIndex int64) (string, error)
@@ -342,19 +363,19 @@ func (cmd *REP) repBlock() error {
 		switch blockType {
 		case '0': // FolderBlock
 			readBlock = func(path string, blockIndex int64) (string, error) {
-				block := &structures.FolderBlock{}
+				block := superBlock.NewFolderBlock()
 				if err := block.ReadFolderBlock(path, blockIndex); err != nil {
 					return "", err
 				}
-				return block.GetStringBuilder(fmt.Sprintf("Bloque_%d", (blockIndex-int64(superBlock.SBlockStart))/64)), nil
+				return block.GetStringBuilder(fmt.Sprintf("Bloque_%d", (blockIndex-int64(superBlock.SBlockStart))/int64(superBlock.SBlockSize))), nil
 			}
-		case '1': // FileBlock
+		case '1', '2': // FileBlock, symbolic links keep their target as file content
 			readBlock = func(path string, blockIndex int64) (string, error) {
-				block := &structures.FileBlock{}
+				block := superBlock.NewFileBlock()
 				if err := block.ReadFileBlock(path, blockIndex); err != nil {
 					return "", err
 				}
-				return block.GetStringBuilder(fmt.Sprintf("Bloque_%d", (blockIndex-int64(superBlock.SBlockStart))/64)), nil
+				return block.GetStringBuilder(fmt.Sprintf("Bloque_%d", (blockIndex-int64(superBlock.SBlockStart))/int64(superBlock.SBlockSize))), nil
 			}
 		default:
 			return fmt.Errorf("unknown inode type: %c", blockType)
@@ -364,7 +385,7 @@ func (cmd *REP) repBlock() error {
 		for j := 0; j < 12; j++ {
 			blockIndex := inode.IBlock[j]
 			if blockIndex == -1 {
-				break
+				continue
 			}
 			blockStart := int64(superBlock.SBlockStart + (blockIndex * superBlock.SBlockSize))
 			blockString, err := readBlock(path, blockStart)
@@ -378,17 +399,17 @@ func (cmd *REP) repBlock() error {
 
 		// Process indirect blocks
 		if inode.IBlock[12] != -1 {
-			indirectBlock := &structures.PointerBlock{}
+			indirectBlock := superBlock.NewPointerBlock()
 			if err := indirectBlock.ReadPointerBlock(path, int64(superBlock.SBlockStart+(inode.IBlock[12]*superBlock.SBlockSize))); err != nil {
 				return err
 			}
 			sb.WriteString(indirectBlock.GetStringBuilder(fmt.Sprintf("Bloque_%d", inode.IBlock[12])))
 			sb.WriteString(fmt.Sprintf("Inodo_%d -> Bloque_%d\n", i, inode.IBlock[12]))
 
-			for j := 0; j < 16; j++ {
+			for j := 0; j < len(indirectBlock.PPointers); j++ {
 				blockIndex := indirectBlock.PPointers[j]
 				if blockIndex == -1 {
-					break
+					continue
 				}
 				blockStart := int64(superBlock.SBlockStart + (blockIndex * superBlock.SBlockSize))
 				blockString, err := readBlock(path, blockStart)
@@ -403,15 +424,15 @@ func (cmd *REP) repBlock() error {
 
 		// Process double indirect blocks
 		if inode.IBlock[13] != -1 {
-			doubleIndirectBlock := &structures.PointerBlock{}
+			doubleIndirectBlock := superBlock.NewPointerBlock()
 			if err := doubleIndirectBlock.ReadPointerBlock(path, int64(superBlock.SBlockStart+(inode.IBlock[13]*superBlock.SBlockSize))); err != nil {
 				return err
 			}
 			sb.WriteString(doubleIndirectBlock.GetStringBuilder(fmt.Sprintf("Bloque_%d", inode.IBlock[13])))
 			sb.WriteString(fmt.Sprintf("Inodo_%d -> Bloque_%d\n", i, inode.IBlock[13]))
 
-			for j := 0; j < 16; j++ {
-				indirectBlock := &structures.PointerBlock{}
+			for j := 0; j < len(doubleIndirectBlock.PPointers); j++ {
+				indirectBlock := superBlock.NewPointerBlock()
 				if doubleIndirectBlock.PPointers[j] == -1 {
 					continue
 				}
@@ -422,7 +443,7 @@ func (cmd *REP) repBlock() error {
 				sb.WriteString(indirectBlock.GetStringBuilder(fmt.Sprintf("Bloque_%d", doubleIndirectBlock.PPointers[j])))
 				sb.WriteString(fmt.Sprintf("Bloque_%d -> Bloque_%d\n", inode.IBlock[13], doubleIndirectBlock.PPointers[j]))
 
-				for k := 0; k < 16; k++ {
+				for k := 0; k < len(indirectBlock.PPointers); k++ {
 					blockIndex := indirectBlock.PPointers[k]
 					if blockIndex == -1 {
 						continue
@@ -441,15 +462,15 @@ func (cmd *REP) repBlock() error {
 
 		// Process triple indirect blocks
 		if inode.IBlock[14] != -1 {
-			tripleIndirectBlock := &structures.PointerBlock{}
+			tripleIndirectBlock := superBlock.NewPointerBlock()
 			if err := tripleIndirectBlock.ReadPointerBlock(path, int64(superBlock.SBlockStart+(inode.IBlock[14]*superBlock.SBlockSize))); err != nil {
 				return err
 			}
 			sb.WriteString(tripleIndirectBlock.GetStringBuilder(fmt.Sprintf("Bloque_%d", inode.IBlock[14])))
 			sb.WriteString(fmt.Sprintf("Inodo_%d -> Bloque_%d\n", i, inode.IBlock[14]))
 
-			for j := 0; j < 16; j++ {
-				doubleIndirectBlock := &structures.PointerBlock{}
+			for j := 0; j < len(tripleIndirectBlock.PPointers); j++ {
+				doubleIndirectBlock := superBlock.NewPointerBlock()
 				if tripleIndirectBlock.PPointers[j] == -1 {
 					continue
 				}
@@ -460,8 +481,8 @@ func (cmd *REP) repBlock() error {
 				sb.WriteString(doubleIndirectBlock.GetStringBuilder(fmt.Sprintf("Bloque_%d", tripleIndirectBlock.PPointers[j])))
 				sb.WriteString(fmt.Sprintf("Bloque_%d -> Bloque_%d\n", inode.IBlock[14], tripleIndirectBlock.PPointers[j]))
 
-				for k := 0; k < 16; k++ {
-					indirectBlock := &structures.PointerBlock{}
+				for k := 0; k < len(doubleIndirectBlock.PPointers); k++ {
+					indirectBlock := superBlock.NewPointerBlock()
 					if doubleIndirectBlock.PPointers[k] == -1 {
 						continue
 					}
@@ -473,7 +494,7 @@ func (cmd *REP) repBlock() error {
 					sb.WriteString(indirectBlock.GetStringBuilder(fmt.Sprintf("Bloque_%d", doubleIndirectBlock.PPointers[k])))
 					sb.WriteString(fmt.Sprintf("Bloque_%d -> Bloque_%d\n", tripleIndirectBlock.PPointers[j], doubleIndirectBlock.PPointers[k]))
 
-					for l := 0; l < 16; l++ {
+					for l := 0; l < len(indirectBlock.PPointers); l++ {
 						blockIndex := indirectBlock.PPointers[l]
 						if blockIndex == -1 {
 							continue
@@ -496,6 +517,142 @@ func (cmd *REP) repBlock() error {
 	return cmd.generateImage(sb.String())
 }
 
+// repTree draws every inode reachable from root with the blocks it references,
+// folder entries link their block to the inode they name
+func (cmd *REP) repTree() error {
+	partition, path, err := global.GetMountedPartition(cmd.Id)
+	if err != nil {
+		return err
+	}
+
+	superBlock := &structures.SuperBlock{}
+	if err := superBlock.ReadSuperBlock(path, int64(partition.PartStart)); err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString("digraph G {\n")
+	sb.WriteString("\tnode [shape=plaintext];\n")
+	sb.WriteString("\trankdir=LR;\n")
+
+	tree := &treeReport{
+		superBlock: superBlock,
+		path:       path,
+		out:        &sb,
+		inodes:     make(map[int32]bool),
+		blocks:     make(map[int32]bool),
+	}
+	if err := tree.walkInode(0); err != nil {
+		return err
+	}
+
+	sb.WriteString("}")
+	return cmd.generateImage(sb.String())
+}
+
+// treeReport keeps the nodes already drawn, hard links and the . and .. entries
+// would draw them again
+type treeReport struct {
+	superBlock *structures.SuperBlock
+	path       string
+	out        *strings.Builder
+	inodes     map[int32]bool
+	blocks     map[int32]bool
+}
+
+func (t *treeReport) walkInode(index int32) error {
+	if t.inodes[index] {
+		return nil
+	}
+	t.inodes[index] = true
+
+	inode := &structures.Inode{}
+	if err := inode.ReadInode(t.path, int64(t.superBlock.SInodeStart+index*t.superBlock.SInodeSize)); err != nil {
+		return err
+	}
+	t.out.WriteString(inode.GetStringBuilder(fmt.Sprintf("Inodo_%d", index)))
+
+	// inline files keep their content in the inode
+	if inode.IsInline() {
+		return nil
+	}
+
+	for i, blockIndex := range inode.IBlock {
+		if blockIndex == -1 {
+			continue
+		}
+
+		t.out.WriteString(fmt.Sprintf("Inodo_%d -> Bloque_%d\n", index, blockIndex))
+
+		// IBlock 12, 13 and 14 are the simple, double and triple indirect blocks
+		if err := t.walkBlock(blockIndex, max(i-11, 0), inode.IType); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// walkBlock draws a block, level is the number of pointer blocks left above the data block
+func (t *treeReport) walkBlock(blockIndex int32, level int, inodeType byte) error {
+	if t.blocks[blockIndex] {
+		return nil
+	}
+	t.blocks[blockIndex] = true
+
+	nodeName := fmt.Sprintf("Bloque_%d", blockIndex)
+	blockStart := int64(t.superBlock.SBlockStart + blockIndex*t.superBlock.SBlockSize)
+
+	if level > 0 {
+		block := t.superBlock.NewPointerBlock()
+		if err := block.ReadPointerBlock(t.path, blockStart); err != nil {
+			return err
+		}
+		t.out.WriteString(block.GetStringBuilder(nodeName))
+
+		for _, pointer := range block.PPointers {
+			if pointer == -1 {
+				continue
+			}
+
+			t.out.WriteString(fmt.Sprintf("%s -> Bloque_%d\n", nodeName, pointer))
+			if err := t.walkBlock(pointer, level-1, inodeType); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if inodeType != '0' {
+		block := t.superBlock.NewFileBlock()
+		if err := block.ReadFileBlock(t.path, blockStart); err != nil {
+			return err
+		}
+		t.out.WriteString(block.GetStringBuilder(nodeName))
+		return nil
+	}
+
+	block := t.superBlock.NewFolderBlock()
+	if err := block.ReadFolderBlock(t.path, blockStart); err != nil {
+		return err
+	}
+	// the folder block draws the links to its entries
+	t.out.WriteString(block.GetStringBuilder(nodeName))
+
+	for _, entry := range block.BContent[2:] {
+		if entry.BInode == -1 {
+			continue
+		}
+
+		if err := t.walkInode(entry.BInode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (cmd *REP) repBMInode() error {
 	partition, path, err := global.GetMountedPartition(cmd.Id)
 	if err != nil {
@@ -583,8 +740,9 @@ func escapeDotString(s string) string {
 	return strings.ReplaceAll(strings.ReplaceAll(s, "\"", "\\\""), "\n", "\\n")
 }
 
-func (cmd *REP) repLS() error {
-	/*partition, path, err := global.GetMountedPartition(cmd.Id)
+// repJournaling draws a table with every entry of the journal of an EXT3 partition
+func (cmd *REP) repJournaling() error {
+	partition, path, err := global.GetMountedPartition(cmd.Id)
 	if err != nil {
 		return err
 	}
@@ -594,21 +752,193 @@ func (cmd *REP) repLS() error {
 		return err
 	}
 
-	filePath := strings.Split(cmd.PathFileLs, "/")
-	var filteredFilePath []string
-	for _, part := range filePath {
-		if part != "" {
-			filteredFilePath = append(filteredFilePath, part)
+	if !superBlock.IsJournaling() {
+		return fmt.Errorf("partition %s is not an EXT3 filesystem", cmd.Id)
+	}
+
+	journals, err := superBlock.GetJournals(path)
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString("digraph G {\n")
+	sb.WriteString("\tnode [shape=plaintext];\n")
+	sb.WriteString("\tReporteJournaling [label=<\n")
+	sb.WriteString("\t<TABLE BORDER=\"1\" CELLBORDER=\"1\" CELLSPACING=\"0\" CELLPADDING=\"4\">\n")
+	sb.WriteString(fmt.Sprintf("\t<TR><TD COLSPAN=\"5\" BGCOLOR=\"%s\"><B>Journaling %s</B></TD></TR>\n", "#333333", cmd.Id))
+	sb.WriteString("\t<TR>")
+	for _, title := range []string{"#", "Operación", "Ruta", "Contenido", "Fecha"} {
+		sb.WriteString(fmt.Sprintf("<TD BGCOLOR=\"%s\"><B>%s</B></TD>", "#AAAAAA", title))
+	}
+	sb.WriteString("</TR>\n")
+
+	for _, journal := range journals {
+		if !journal.IsContinuation() {
+			sb.WriteString(journal.GetStringBuilder())
 		}
 	}
-	fileName := filePath[len(filePath)-1]
 
-	sb := &structures.SuperBlock{}
-	if err := sb.ReadSuperBlock(path, int64(partition.PartStart)); err != nil {
+	if len(journals) == 0 {
+		sb.WriteString(fmt.Sprintf("\t<TR><TD COLSPAN=\"5\" BGCOLOR=\"%s\">Sin entradas</TD></TR>\n", "#FFFFFF"))
+	}
+
+	sb.WriteString("\t</TABLE>>];\n")
+	sb.WriteString("}")
+
+	return cmd.generateImage(sb.String())
+}
+
+// repLS draws a table with the entries of the folder at PathFileLs, owners and groups
+// are resolved with the users.txt of the partition
+func (cmd *REP) repLS() error {
+	partition, path, err := global.GetMountedPartition(cmd.Id)
+	if err != nil {
+		return err
+	}
+
+	superBlock := &structures.SuperBlock{}
+	if err := superBlock.ReadSuperBlock(path, int64(partition.PartStart)); err != nil {
 		return err
 	}
-	*/
-	return nil //cmd.generateImage(content)
+
+	filePath, err := superBlock.ResolvePath(path, structures.SplitPath(cmd.PathFileLs), true)
+	if err != nil {
+		return err
+	}
+
+	index := superBlock.GetInodeReference(path, 0, filePath)
+	if index == -1 {
+		return fmt.Errorf("path not found: %s", cmd.PathFileLs)
+	}
+
+	folder := &structures.Inode{}
+	if err := folder.ReadInode(path, int64(superBlock.SInodeStart+index*superBlock.SInodeSize)); err != nil {
+		return err
+	}
+
+	if folder.IType != '0' {
+		return fmt.Errorf("not a folder: %s", cmd.PathFileLs)
+	}
+
+	users, groups := lsOwnerNames(superBlock.GetFile(path, 0, []string{"users.txt"}))
+
+	var sb strings.Builder
+
+	sb.WriteString("digraph G {\n")
+	sb.WriteString("\tnode [shape=plaintext];\n")
+	sb.WriteString("\tReporteLS [label=<\n")
+	sb.WriteString("\t<TABLE BORDER=\"1\" CELLBORDER=\"1\" CELLSPACING=\"0\" CELLPADDING=\"4\">\n")
+	sb.WriteString(fmt.Sprintf("\t<TR><TD COLSPAN=\"8\" BGCOLOR=\"%s\"><B>/%s</B></TD></TR>\n", "#333333", strings.Join(filePath, "/")))
+	sb.WriteString("\t<TR>")
+	for _, title := range []string{"Permisos", "Propietario", "Grupo", "Tamaño", "Creación", "Modificación", "Tipo", "Nombre"} {
+		sb.WriteString(fmt.Sprintf("<TD BGCOLOR=\"%s\"><B>%s</B></TD>", "#AAAAAA", title))
+	}
+	sb.WriteString("</TR>\n")
+
+	inode := &structures.Inode{}
+	for i, entry := range superBlock.GetFolderEntries(path, folder) {
+		if err := inode.ReadInode(path, int64(superBlock.SInodeStart+entry.BInode*superBlock.SInodeSize)); err != nil {
+			return err
+		}
+
+		bgColor := "#FFFFFF"
+		if i%2 == 0 {
+			bgColor = "#DDDDDD"
+		}
+
+		kind := "Archivo"
+		switch inode.IType {
+		case '0':
+			kind = "Carpeta"
+		case '2':
+			kind = "Enlace"
+		}
+
+		cells := []string{
+			lsPermissions(inode),
+			lsName(users, inode.IuId),
+			lsName(groups, inode.IGid),
+			fmt.Sprintf("%d", inode.ISize),
+			time.Unix(0, inode.ICTime).Format("02-Jan-2006 03:04 PM"),
+			time.Unix(0, inode.IMTime).Format("02-Jan-2006 03:04 PM"),
+			kind,
+			html.EscapeString(superBlock.EntryName(path, entry)),
+		}
+
+		sb.WriteString("\t<TR>")
+		for _, cell := range cells {
+			sb.WriteString(fmt.Sprintf("<TD BGCOLOR=\"%s\">%s</TD>", bgColor, cell))
+		}
+		sb.WriteString("</TR>\n")
+	}
+
+	sb.WriteString("\t</TABLE>>];\n")
+	sb.WriteString("}")
+
+	return cmd.generateImage(sb.String())
+}
+
+// lsPermissions returns the type and IPerm of inode as in ls -l, for example drwxrwxr-x
+func lsPermissions(inode *structures.Inode) string {
+	var perm strings.Builder
+
+	switch inode.IType {
+	case '0':
+		perm.WriteByte('d')
+	case '2':
+		perm.WriteByte('l')
+	default:
+		perm.WriteByte('-')
+	}
+
+	for _, digit := range inode.IPerm {
+		value := digit - '0'
+		for j, letter := range "rwx" {
+			if value&(4>>j) != 0 {
+				perm.WriteRune(letter)
+			} else {
+				perm.WriteByte('-')
+			}
+		}
+	}
+
+	return perm.String()
+}
+
+// lsOwnerNames maps the user and group ids in users.txt to their names, removed
+// entries are left out
+func lsOwnerNames(content string) (map[int32]string, map[int32]string) {
+	users := make(map[int32]string)
+	groups := make(map[int32]string)
+
+	userList, groupList := global.ParseUsers(content)
+	for name, list := range groupList {
+		for _, group := range list {
+			if id, err := strconv.Atoi(group.ID); err == nil && id > 0 {
+				groups[int32(id)] = name
+			}
+		}
+	}
+
+	for name, list := range userList {
+		for _, user := range list {
+			if id, err := strconv.Atoi(user.ID); err == nil && id > 0 && user.UserGroup.ID != "0" {
+				users[int32(id)] = name
+			}
+		}
+	}
+
+	return users, groups
+}
+
+// lsName returns the name of id, or #id when users.txt does not have it
+func lsName(names map[int32]string, id int32) string {
+	if name, ok := names[id]; ok {
+		return html.EscapeString(name)
+	}
+	return fmt.Sprintf("#%d", id)
 }
 
 func (cmd *REP) generateImage(content string) error {
@@ -0,0 +1,85 @@
+package commands
+
+import (
+	"backend/global"
+	"backend/structures"
+	"backend/utils"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type ResizeFs struct {
+	Id     string
+	Inodes int32
+	Blocks int32
+}
+
+func ParserResizeFs(tokens []string) (string, error) {
+	cmd := &ResizeFs{}
+
+	args := strings.Join(tokens, " ")
+	re := regexp.MustCompile(`(?i)-id(?-i)=\S+`)
+	matches := re.FindAllString(args, -1)
+
+	for _, match := range matches {
+		key, value, err := utils.ParseToken(match)
+		if err != nil {
+			return "", err
+		}
+
+		switch key {
+		case "-id":
+			if value == "" {
+				return "", fmt.Errorf("invalid id: %s", value)
+			}
+			cmd.Id = value
+		}
+	}
+
+	if cmd.Id == "" {
+		return "", fmt.Errorf("missing id")
+	}
+
+	if err := cmd.commandResizeFs(); err != nil {
+		return "", err
+	}
+
+	return cmd.Print(), nil
+}
+
+func (cmd *ResizeFs) commandResizeFs() error {
+	if user, _, err := global.GetLoggedUser(); user != "root" || err != nil {
+		return fmt.Errorf("permission denied")
+	}
+
+	mountedPartition, partitionPath, err := global.GetMountedPartition(cmd.Id)
+	if err != nil {
+		return err
+	}
+
+	sb := &structures.SuperBlock{}
+	if err := sb.ReadSuperBlock(partitionPath, int64(mountedPartition.PartStart)); err != nil {
+		return err
+	}
+
+	if sb.SMagic != 0xEF53 {
+		return fmt.Errorf("partition %s is not formatted", cmd.Id)
+	}
+
+	if err := sb.ResizePartition(partitionPath, mountedPartition); err != nil {
+		return err
+	}
+
+	if err := sb.WriteSuperBlock(partitionPath, int64(mountedPartition.PartStart), int64(mountedPartition.PartStart+sb.Size())); err != nil {
+		return err
+	}
+
+	cmd.Inodes = sb.InodeCapacity()
+	cmd.Blocks = sb.BlockCapacity()
+	return nil
+}
+
+func (cmd *ResizeFs) Print() string {
+	return fmt.Sprintf("partition %s resized to %d inodes and %d blocks", cmd.Id, cmd.Inodes, cmd.Blocks)
+}
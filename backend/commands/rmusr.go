@@ -4,7 +4,6 @@ import (
 	"backend/global"
 	"backend/structures"
 	"backend/utils"
-	"encoding/binary"
 	"fmt"
 	"regexp"
 	"strings"
@@ -44,18 +43,23 @@ func ParserRmUSR(tokens []string) (string, error) {
 		return "", fmt.Errorf("name is required")
 	}
 
-	if err := cmd.commandRmGRP(); err != nil {
+	if err := cmd.commandRmUSR(); err != nil {
 		return "", err
 	}
 
 	return cmd.Print(), nil
 }
 
-func (cmd *RmUSR) commandRmGRP() error {
+func (cmd *RmUSR) commandRmUSR() error {
 	if user, _, err := global.GetLoggedUser(); user != "root" || err != nil {
 		return fmt.Errorf("permission denied")
 	}
 
+	creds, err := global.GetLoggedCredentials()
+	if err != nil {
+		return err
+	}
+
 	mountedPartition, partitionPath, err := global.GetMountedPartition(global.LoggedPartition)
 	if err != nil {
 		return err
@@ -76,11 +80,15 @@ func (cmd *RmUSR) commandRmGRP() error {
 		return err
 	}
 
+	if err := sb.AddJournal(partitionPath, structures.JournalEntry{Operation: "rmusr", Path: "/users.txt", Content: cmd.User, Owner: creds}); err != nil {
+		return err
+	}
+
 	if _, err := sb.WriteFile(partitionPath, int32(0), array, global.ConvertToString()); err != nil {
 		return err
 	}
 
-	if err := sb.WriteSuperBlock(partitionPath, int64(mountedPartition.PartStart), int64(mountedPartition.PartStart+int32(binary.Size(sb)))); err != nil {
+	if err := sb.WriteSuperBlock(partitionPath, int64(mountedPartition.PartStart), int64(mountedPartition.PartStart+sb.Size())); err != nil {
 		return err
 	}
 
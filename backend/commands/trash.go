@@ -0,0 +1,317 @@
+package commands
+
+import (
+	"backend/global"
+	"backend/structures"
+	"backend/utils"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Trash struct {
+	List    bool
+	Restore string // record id or original path
+	Empty   bool
+	Enable  bool
+	Disable bool
+	Lines   []string
+}
+
+func ParserTrash(tokens []string) (string, error) {
+	cmd := &Trash{}
+
+	args := strings.Join(tokens, " ")
+	re := regexp.MustCompile(`(?i)-restore(?-i)="[^"]+"|(?i)-restore(?-i)=\S+|(?i)-list|(?i)-empty|(?i)-enable|(?i)-disable`)
+	matches := re.FindAllString(args, -1)
+
+	actions := 0
+	for _, match := range matches {
+		var key, value string
+		var err error
+
+		if flag := strings.ToLower(match); flag == "-list" || flag == "-empty" || flag == "-enable" || flag == "-disable" {
+			key = flag
+			value = ""
+		} else {
+			key, value, err = utils.ParseToken(match)
+			if err != nil {
+				return "", err
+			}
+
+			if strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
+				value = strings.Trim(value, "\"")
+			}
+		}
+
+		actions++
+		switch key {
+		case "-list":
+			cmd.List = true
+		case "-restore":
+			if value == "" {
+				return "", fmt.Errorf("invalid restore: %s", value)
+			}
+			cmd.Restore = value
+		case "-empty":
+			cmd.Empty = true
+		case "-enable":
+			cmd.Enable = true
+		case "-disable":
+			cmd.Disable = true
+		}
+	}
+
+	if actions != 1 {
+		return "", fmt.Errorf("use one of -list, -restore, -empty, -enable or -disable")
+	}
+
+	var err error
+	switch {
+	case cmd.List:
+		err = cmd.commandList()
+	case cmd.Restore != "":
+		err = cmd.commandRestore()
+	case cmd.Empty:
+		err = cmd.commandEmpty()
+	default:
+		err = cmd.commandSetTrash(cmd.Enable)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return cmd.Print(), nil
+}
+
+// commandSetTrash turns the trash of the partition on or off, entries already in the
+// trash stay there until they are restored or emptied
+func (cmd *Trash) commandSetTrash(enable bool) error {
+	if user, _, err := global.GetLoggedUser(); user != "root" || err != nil {
+		return fmt.Errorf("permission denied")
+	}
+
+	creds, err := global.GetLoggedCredentials()
+	if err != nil {
+		return err
+	}
+
+	mountedPartition, partitionPath, err := global.GetMountedPartition(global.LoggedPartition)
+	if err != nil {
+		return err
+	}
+
+	sb := &structures.SuperBlock{}
+	if err := sb.ReadSuperBlock(partitionPath, int64(mountedPartition.PartStart)); err != nil {
+		return err
+	}
+
+	content := "-disable"
+	if enable {
+		content = "-enable"
+	}
+	if err := sb.AddJournal(partitionPath, structures.JournalEntry{Operation: "trash", Path: "/" + structures.TrashFolder, Content: content, Owner: creds}); err != nil {
+		return err
+	}
+
+	if enable {
+		sb.SFeatures |= structures.FeatureTrash
+	} else {
+		sb.SFeatures &^= structures.FeatureTrash
+	}
+
+	return sb.WriteSuperBlock(partitionPath, int64(mountedPartition.PartStart), int64(mountedPartition.PartStart+sb.Size()))
+}
+
+// commandList shows the entries in the trash, root sees every entry and other users
+// only the ones they removed
+func (cmd *Trash) commandList() error {
+	creds, err := global.GetLoggedCredentials()
+	if err != nil {
+		return fmt.Errorf("you must be logged in")
+	}
+
+	mountedPartition, partitionPath, err := global.GetMountedPartition(global.LoggedPartition)
+	if err != nil {
+		return err
+	}
+
+	sb := &structures.SuperBlock{}
+	if err := sb.ReadSuperBlock(partitionPath, int64(mountedPartition.PartStart)); err != nil {
+		return err
+	}
+
+	names := quotaNames()
+	for _, record := range sb.ReadTrash(partitionPath) {
+		if creds.UID != structures.RootUID && record.UID != creds.UID {
+			continue
+		}
+
+		name := names[fmt.Sprintf("U%d", record.UID)]
+		if record.UID == structures.RootUID {
+			name = "root"
+		} else if name == "" {
+			name = fmt.Sprintf("#%d", record.UID)
+		}
+
+		cmd.Lines = append(cmd.Lines, fmt.Sprintf("%d %s removed by %s on %s", record.ID, record.Path, name,
+			time.Unix(0, record.Time).Format("02-Jan-2006 03:04 PM")))
+	}
+
+	return nil
+}
+
+// commandRestore moves an entry back to where it was removed from, only the user that
+// removed it or root may restore it and the folder must still accept new entries
+func (cmd *Trash) commandRestore() error {
+	creds, err := global.GetLoggedCredentials()
+	if err != nil {
+		return fmt.Errorf("you must be logged in")
+	}
+
+	mountedPartition, partitionPath, err := global.GetMountedPartition(global.LoggedPartition)
+	if err != nil {
+		return err
+	}
+
+	sb := &structures.SuperBlock{}
+	if err := sb.ReadSuperBlock(partitionPath, int64(mountedPartition.PartStart)); err != nil {
+		return err
+	}
+
+	record, err := sb.FindTrashRecord(partitionPath, cmd.Restore)
+	if err != nil {
+		return err
+	}
+
+	if creds.UID != structures.RootUID && record.UID != creds.UID {
+		return fmt.Errorf("permission denied: %s was removed by another user", record.Path)
+	}
+
+	if err := sb.CheckCreate(partitionPath, structures.SplitPath(record.Path), creds); err != nil {
+		return err
+	}
+
+	release, err := sb.StartQuota(partitionPath, creds)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := sb.AddJournal(partitionPath, structures.JournalEntry{Operation: "trash", Path: record.Path, Content: fmt.Sprintf("-restore=%d", record.ID), Owner: creds}); err != nil {
+		return err
+	}
+
+	// the superblock is written even when restoring fails, blocks may already be allocated
+	err = sb.RestoreTrash(partitionPath, record.ID)
+	if err == nil {
+		cmd.Lines = append(cmd.Lines, fmt.Sprintf("%s restored successfully", record.Path))
+	}
+
+	if err := sb.WriteSuperBlock(partitionPath, int64(mountedPartition.PartStart), int64(mountedPartition.PartStart+sb.Size())); err != nil {
+		return err
+	}
+
+	return err
+}
+
+// commandEmpty frees the entries in the trash for good, root empties the whole trash
+// and other users only the entries they removed
+func (cmd *Trash) commandEmpty() error {
+	creds, err := global.GetLoggedCredentials()
+	if err != nil {
+		return fmt.Errorf("you must be logged in")
+	}
+
+	owner := int32(-1)
+	if creds.UID != structures.RootUID {
+		owner = creds.UID
+	}
+
+	return cmd.emptyTrash(owner)
+}
+
+// emptyTrash frees the entries removed by owner, every entry when owner is -1. The logged
+// user must be allowed to remove all of them
+func (cmd *Trash) emptyTrash(owner int32) error {
+	creds, err := global.GetLoggedCredentials()
+	if err != nil {
+		return fmt.Errorf("you must be logged in")
+	}
+
+	mountedPartition, partitionPath, err := global.GetMountedPartition(global.LoggedPartition)
+	if err != nil {
+		return err
+	}
+
+	sb := &structures.SuperBlock{}
+	if err := sb.ReadSuperBlock(partitionPath, int64(mountedPartition.PartStart)); err != nil {
+		return err
+	}
+
+	var ids []int32
+	for _, record := range sb.ReadTrash(partitionPath) {
+		if owner == -1 || record.UID == owner {
+			ids = append(ids, record.ID)
+		}
+	}
+
+	content := "-empty"
+	if owner != -1 {
+		content = fmt.Sprintf("-empty=%d", owner)
+	}
+	if err := sb.AddJournal(partitionPath, structures.JournalEntry{Operation: "trash", Path: "/" + structures.TrashFolder, Content: content, Owner: creds}); err != nil {
+		return err
+	}
+
+	// the superblock is written even when emptying fails, blocks may already be freed
+	err = sb.EmptyTrash(partitionPath, ids, creds)
+	if err == nil {
+		cmd.Lines = append(cmd.Lines, fmt.Sprintf("%d entries removed from trash", len(ids)))
+	}
+
+	if err := sb.WriteSuperBlock(partitionPath, int64(mountedPartition.PartStart), int64(mountedPartition.PartStart+sb.Size())); err != nil {
+		return err
+	}
+
+	return err
+}
+
+// replayTrash runs a journaled trash operation again
+func replayTrash(content string) error {
+	cmd := &Trash{}
+
+	switch {
+	case content == "-enable" || content == "-disable":
+		return cmd.commandSetTrash(content == "-enable")
+	case content == "-empty":
+		return cmd.emptyTrash(-1)
+	case strings.HasPrefix(content, "-empty="):
+		owner, err := strconv.Atoi(strings.TrimPrefix(content, "-empty="))
+		if err != nil {
+			return fmt.Errorf("invalid content: %s", content)
+		}
+		return cmd.emptyTrash(int32(owner))
+	case strings.HasPrefix(content, "-restore="):
+		cmd.Restore = strings.TrimPrefix(content, "-restore=")
+		return cmd.commandRestore()
+	}
+
+	return fmt.Errorf("invalid content: %s", content)
+}
+
+func (cmd *Trash) Print() string {
+	switch {
+	case cmd.Enable:
+		return "trash enabled"
+	case cmd.Disable:
+		return "trash disabled"
+	case cmd.List && len(cmd.Lines) == 0:
+		return "trash is empty"
+	}
+
+	return strings.Join(cmd.Lines, "\n")
+}
@@ -0,0 +1,273 @@
+package commands
+
+import (
+	"backend/global"
+	"backend/structures"
+	"backend/utils"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type SetXattr struct {
+	Path  string
+	Name  string
+	Value string
+}
+
+type GetXattr struct {
+	Path  string
+	Name  string
+	Value string
+}
+
+type ListXattr struct {
+	Path  string
+	Attrs []structures.Xattr
+}
+
+type RmXattr struct {
+	Path string
+	Name string
+}
+
+// parseXattrArgs reads -path, -name and -value, values may be empty when quoted
+func parseXattrArgs(tokens []string) (map[string]string, error) {
+	args := strings.Join(tokens, " ")
+	re := regexp.MustCompile(`(?i)-path(?-i)="[^"]+"|(?i)-path(?-i)=\S+|(?i)-name(?-i)="[^"]+"|(?i)-name(?-i)=\S+|(?i)-value(?-i)="[^"]*"|(?i)-value(?-i)=\S+`)
+	matches := re.FindAllString(args, -1)
+
+	values := make(map[string]string)
+	for _, match := range matches {
+		key, value, err := utils.ParseToken(match)
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
+			value = strings.Trim(value, "\"")
+		}
+
+		values[key] = value
+	}
+
+	if values["-path"] == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+
+	return values, nil
+}
+
+func ParserSetXattr(tokens []string) (string, error) {
+	values, err := parseXattrArgs(tokens)
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := values["-value"]
+	if !ok {
+		return "", fmt.Errorf("value is required")
+	}
+
+	cmd := &SetXattr{Path: values["-path"], Name: values["-name"], Value: value}
+	if cmd.Name == "" {
+		return "", fmt.Errorf("name is required")
+	}
+
+	if err := cmd.commandSetXattr(); err != nil {
+		return "", err
+	}
+
+	return cmd.Print(), nil
+}
+
+func ParserGetXattr(tokens []string) (string, error) {
+	values, err := parseXattrArgs(tokens)
+	if err != nil {
+		return "", err
+	}
+
+	cmd := &GetXattr{Path: values["-path"], Name: values["-name"]}
+	if cmd.Name == "" {
+		return "", fmt.Errorf("name is required")
+	}
+
+	if err := cmd.commandGetXattr(); err != nil {
+		return "", err
+	}
+
+	return cmd.Print(), nil
+}
+
+func ParserListXattr(tokens []string) (string, error) {
+	values, err := parseXattrArgs(tokens)
+	if err != nil {
+		return "", err
+	}
+
+	cmd := &ListXattr{Path: values["-path"]}
+	if cmd.Attrs, err = ListXattrs(cmd.Path); err != nil {
+		return "", err
+	}
+
+	return cmd.Print(), nil
+}
+
+func ParserRmXattr(tokens []string) (string, error) {
+	values, err := parseXattrArgs(tokens)
+	if err != nil {
+		return "", err
+	}
+
+	cmd := &RmXattr{Path: values["-path"], Name: values["-name"]}
+	if cmd.Name == "" {
+		return "", fmt.Errorf("name is required")
+	}
+
+	if err := cmd.commandRmXattr(); err != nil {
+		return "", err
+	}
+
+	return cmd.Print(), nil
+}
+
+// xattrTarget checks that the logged user has perm on filePath and returns the
+// superblock of the logged partition and the inode the path refers to
+func xattrTarget(filePath string, perm byte) (*structures.SuperBlock, *structures.Partition, string, int32, error) {
+	creds, err := global.GetLoggedCredentials()
+	if err != nil {
+		return nil, nil, "", -1, fmt.Errorf("you must be logged in")
+	}
+
+	mountedPartition, partitionPath, err := global.GetMountedPartition(global.LoggedPartition)
+	if err != nil {
+		return nil, nil, "", -1, err
+	}
+
+	sb := &structures.SuperBlock{}
+	if err := sb.ReadSuperBlock(partitionPath, int64(mountedPartition.PartStart)); err != nil {
+		return nil, nil, "", -1, err
+	}
+
+	result := structures.SplitPath(filePath)
+	if err := sb.CheckAccess(partitionPath, result, creds, perm); err != nil {
+		return nil, nil, "", -1, err
+	}
+
+	index := sb.GetInodeReference(partitionPath, 0, result)
+	if index == -1 {
+		return nil, nil, "", -1, fmt.Errorf("path not found: %s", filePath)
+	}
+
+	return sb, mountedPartition, partitionPath, index, nil
+}
+
+// ListXattrs returns the extended attributes of filePath, it needs read access
+func ListXattrs(filePath string) ([]structures.Xattr, error) {
+	sb, _, partitionPath, index, err := xattrTarget(filePath, structures.PermRead)
+	if err != nil {
+		return nil, err
+	}
+
+	return sb.ListXattrs(partitionPath, index)
+}
+
+func (cmd *SetXattr) commandSetXattr() error {
+	sb, mountedPartition, partitionPath, index, err := xattrTarget(cmd.Path, structures.PermWrite)
+	if err != nil {
+		return err
+	}
+
+	creds, err := global.GetLoggedCredentials()
+	if err != nil {
+		return err
+	}
+
+	release, err := sb.StartQuota(partitionPath, creds)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := sb.CheckXattr(partitionPath, index, cmd.Name, cmd.Value); err != nil {
+		return err
+	}
+
+	if err := sb.AddJournal(partitionPath, structures.JournalEntry{Operation: "setxattr", Path: cmd.Path, Content: cmd.Name + "=" + cmd.Value, Owner: creds}); err != nil {
+		return err
+	}
+
+	if err := sb.SetXattr(partitionPath, index, cmd.Name, cmd.Value); err != nil {
+		return err
+	}
+
+	if err := sb.WriteSuperBlock(partitionPath, int64(mountedPartition.PartStart), int64(mountedPartition.PartStart+sb.Size())); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cmd *GetXattr) commandGetXattr() error {
+	sb, _, partitionPath, index, err := xattrTarget(cmd.Path, structures.PermRead)
+	if err != nil {
+		return err
+	}
+
+	cmd.Value, err = sb.GetXattr(partitionPath, index, cmd.Name)
+	return err
+}
+
+func (cmd *RmXattr) commandRmXattr() error {
+	sb, mountedPartition, partitionPath, index, err := xattrTarget(cmd.Path, structures.PermWrite)
+	if err != nil {
+		return err
+	}
+
+	creds, err := global.GetLoggedCredentials()
+	if err != nil {
+		return err
+	}
+
+	if _, err := sb.GetXattr(partitionPath, index, cmd.Name); err != nil {
+		return err
+	}
+
+	if err := sb.AddJournal(partitionPath, structures.JournalEntry{Operation: "rmxattr", Path: cmd.Path, Content: cmd.Name, Owner: creds}); err != nil {
+		return err
+	}
+
+	if err := sb.RemoveXattr(partitionPath, index, cmd.Name); err != nil {
+		return err
+	}
+
+	if err := sb.WriteSuperBlock(partitionPath, int64(mountedPartition.PartStart), int64(mountedPartition.PartStart+sb.Size())); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (cmd *SetXattr) Print() string {
+	return fmt.Sprintf("attribute %s set on %s", cmd.Name, cmd.Path)
+}
+
+func (cmd *GetXattr) Print() string {
+	return cmd.Value
+}
+
+func (cmd *ListXattr) Print() string {
+	if len(cmd.Attrs) == 0 {
+		return fmt.Sprintf("%s has no attributes", cmd.Path)
+	}
+
+	var sb strings.Builder
+	for _, attr := range cmd.Attrs {
+		sb.WriteString(fmt.Sprintf("%s=%s\n", attr.Name, attr.Value))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+func (cmd *RmXattr) Print() string {
+	return fmt.Sprintf("attribute %s removed from %s", cmd.Name, cmd.Path)
+}
@@ -1,6 +1,7 @@
 package global
 
 import (
+	"backend/structures"
 	"fmt"
 	"sort"
 	"strconv"
@@ -14,6 +15,7 @@ type Group struct {
 }
 
 type User struct {
+	ID        string
 	UserGroup Group
 	Username  string
 	Password  string
@@ -72,6 +74,7 @@ func AddUserToGroup(username, password, groupName string) error {
 				return fmt.Errorf("no active group found")
 			}
 
+			Users[username][i].ID = getNextUserID()
 			Users[username][i].UserGroup = *activeGroup
 			Users[username][i].Password = password
 			return nil
@@ -94,7 +97,7 @@ func AddUserToGroup(username, password, groupName string) error {
 		return fmt.Errorf("no active group found")
 	}
 
-	newUser := User{UserGroup: *activeGroup, Username: username, Password: password}
+	newUser := User{ID: getNextUserID(), UserGroup: *activeGroup, Username: username, Password: password}
 	Users[username] = append(Users[username], newUser)
 	return nil
 }
@@ -198,6 +201,37 @@ func GetLoggedUser() (string, string, error) {
 	return LoggedUser, LoggedPartition, nil
 }
 
+// GetLoggedUserIDs returns the uid and gid of the logged user
+func GetLoggedUserIDs() (int32, int32, error) {
+	if LoggedUser == "" {
+		return 0, 0, fmt.Errorf("no user logged")
+	}
+
+	user := GetInfoUser(LoggedUser)
+
+	uid, err := strconv.Atoi(user.ID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid uid for user %s", LoggedUser)
+	}
+
+	gid, err := strconv.Atoi(user.UserGroup.ID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid gid for user %s", LoggedUser)
+	}
+
+	return int32(uid), int32(gid), nil
+}
+
+// GetLoggedCredentials returns the credentials used to check filesystem permissions
+func GetLoggedCredentials() (*structures.Credentials, error) {
+	uid, gid, err := GetLoggedUserIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	return &structures.Credentials{UID: uid, GID: gid}, nil
+}
+
 func GetInfoUser(username string) User {
 	for _, user := range Users[username] {
 		if user.UserGroup.ID != "0" {
@@ -208,6 +242,28 @@ func GetInfoUser(username string) User {
 	return User{}
 }
 
+// GetInfoUserByID returns the active user with the given uid, or an empty User
+func GetInfoUserByID(id string) User {
+	for _, userList := range Users {
+		for _, user := range userList {
+			if user.ID == id && user.UserGroup.ID != "0" {
+				return user
+			}
+		}
+	}
+
+	return User{}
+}
+
+// GetInfoGroup returns the active group called name, or an empty Group
+func GetInfoGroup(name string) Group {
+	if group := getActiveGroup(name); group != nil {
+		return *group
+	}
+
+	return Group{}
+}
+
 func LogUserIn(username, password, partition string) error {
 	userList, exists := Users[username]
 	if !exists {
@@ -253,11 +309,27 @@ func IsUserLogged() bool {
 	return LoggedUser != ""
 }
 
+// ParserUserData loads users.txt as the users and groups of the session
 func ParserUserData(data string) {
-	ClearData()
-	lines := strings.Split(data, "\n")
+	Users, Groups = ParseUsers(data)
+}
+
+// ParseUsers reads users.txt. A group line is GID,G,name and a user line is
+// GID,U,group,name,password,UID. A removed group or user has GID 0, a removed user keeps
+// its UID so it is never issued again. User lines written before uids were stored have
+// no UID, root gets RootUID and the other users the next free uids in the order of
+// the file
+func ParseUsers(data string) (map[string][]User, map[string][]Group) {
+	users := make(map[string][]User)
+	groups := make(map[string][]Group)
+
+	type position struct {
+		username string
+		index    int
+	}
+	var missing []position
 
-	for _, line := range lines {
+	for _, line := range strings.Split(data, "\n") {
 		line = strings.TrimSpace(line)
 		if line == "" {
 			continue
@@ -274,13 +346,39 @@ func ParserUserData(data string) {
 
 		switch len(parts) {
 		case 3:
-			Groups[name] = append(Groups[name], Group{ID: id, Type: typ, Name: name})
-		case 5:
+			groups[name] = append(groups[name], Group{ID: id, Type: typ, Name: name})
+		case 5, 6:
 			username := strings.TrimSpace(parts[3])
 			password := strings.TrimSpace(parts[4])
-			Users[username] = append(Users[username], User{UserGroup: Group{ID: id, Type: typ, Name: name}, Username: username, Password: password})
+			user := User{UserGroup: Group{ID: id, Type: typ, Name: name}, Username: username, Password: password}
+
+			if len(parts) == 6 {
+				user.ID = strings.TrimSpace(parts[5])
+			} else if username == "root" {
+				user.ID = strconv.Itoa(int(structures.RootUID))
+			} else {
+				missing = append(missing, position{username, len(users[username])})
+			}
+
+			users[username] = append(users[username], user)
 		}
 	}
+
+	for _, p := range missing {
+		users[p.username][p.index].ID = nextUserID(users)
+	}
+
+	return users, groups
+}
+
+func getActiveGroup(name string) *Group {
+	for i, group := range Groups[name] {
+		if group.ID != "0" {
+			return &Groups[name][i]
+		}
+	}
+
+	return nil
 }
 
 func getNextGroupID() string {
@@ -298,6 +396,26 @@ func getNextGroupID() string {
 	return strconv.Itoa(maxID + 1)
 }
 
+func getNextUserID() string {
+	return nextUserID(Users)
+}
+
+// nextUserID returns the uid after the highest one in users, removed users included
+func nextUserID(users map[string][]User) string {
+	maxID := 0
+
+	for _, userList := range users {
+		for _, user := range userList {
+			id, err := strconv.Atoi(user.ID)
+			if err == nil && id > maxID {
+				maxID = id
+			}
+		}
+	}
+
+	return strconv.Itoa(maxID + 1)
+}
+
 func ConvertToString() string {
 	var sb strings.Builder
 
@@ -346,6 +464,7 @@ func ConvertToString() string {
 						user.UserGroup.Name,
 						user.Username,
 						user.Password,
+						user.ID,
 					}, ",") + "\n")
 					userSet[user.Username] = true
 				}
@@ -360,6 +479,7 @@ func ConvertToString() string {
 			user.UserGroup.Name,
 			user.Username,
 			user.Password,
+			user.ID,
 		}, ",") + "\n")
 	}
 
@@ -0,0 +1,89 @@
+package global
+
+import (
+	"backend/structures"
+	"strings"
+	"testing"
+)
+
+// baselineUsers is a users.txt written before uids were stored, the first field of a
+// user line is the gid and carl shares the root group with root
+const baselineUsers = "1,G,root\n1,U,root,carl,c\n1,U,root,root,123\n2,G,devs\n2,U,devs,ana,a\n2,U,devs,bob,b\n0,U,devs,old,o\n"
+
+func TestParseBaselineUsers(t *testing.T) {
+	ParserUserData(baselineUsers)
+	defer ClearData()
+
+	gids := map[string]string{"root": "1", "carl": "1", "ana": "2", "bob": "2"}
+	uids := make(map[string]bool)
+
+	for name, gid := range gids {
+		user := GetInfoUser(name)
+		if user.UserGroup.ID != gid {
+			t.Errorf("%s has gid %q, want %s", name, user.UserGroup.ID, gid)
+		}
+
+		if uids[user.ID] {
+			t.Errorf("%s has uid %s, already given to another user", name, user.ID)
+		}
+		uids[user.ID] = true
+	}
+
+	LoggedUser = "root"
+	defer func() { LoggedUser = "" }()
+	if creds, err := GetLoggedCredentials(); err != nil || creds.UID != structures.RootUID {
+		t.Errorf("root has credentials %v (%v), want uid %d", creds, err, structures.RootUID)
+	}
+
+	for _, name := range []string{"carl", "ana", "bob"} {
+		LoggedUser = name
+		creds, err := GetLoggedCredentials()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if creds.UID == structures.RootUID {
+			t.Errorf("%s has the uid of root", name)
+		}
+	}
+
+	// the removed user keeps a uid of its own too
+	if old := Users["old"][0]; old.ID == "" || uids[old.ID] {
+		t.Errorf("removed user has uid %q", old.ID)
+	}
+}
+
+func TestUsersKeepTheirUIDs(t *testing.T) {
+	ParserUserData(baselineUsers)
+	defer ClearData()
+
+	before := make(map[string]string)
+	for name, list := range Users {
+		before[name] = list[0].ID
+	}
+
+	if err := RemoveUser("bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	content := ConvertToString()
+	if !strings.Contains(content, "0,U,devs,bob,b,"+before["bob"]+"\n") {
+		t.Errorf("removed bob is missing from %q", content)
+	}
+
+	ParserUserData(content)
+	for name, uid := range before {
+		if got := Users[name][0].ID; got != uid {
+			t.Errorf("%s has uid %s after writing users.txt, want %s", name, got, uid)
+		}
+	}
+
+	// a new user never gets the uid of a removed one
+	if err := AddUserToGroup("dan", "d", "devs"); err != nil {
+		t.Fatal(err)
+	}
+	for name, uid := range before {
+		if dan := GetInfoUser("dan"); dan.ID == uid {
+			t.Errorf("dan got the uid %s of %s", uid, name)
+		}
+	}
+}
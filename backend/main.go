@@ -5,9 +5,12 @@ import (
 	"backend/commands"
 	"backend/global"
 	"backend/structures"
+	"errors"
+	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
@@ -45,6 +48,24 @@ type PartitionsListResponse struct {
 	Result []map[string]string `json:"result"`
 }
 
+type XattrListResponse struct {
+	Result []structures.Xattr `json:"result"`
+}
+
+type DfResponse struct {
+	Result []structures.FsUsage `json:"result"`
+}
+
+type DuResponse struct {
+	Result []structures.DiskUsage `json:"result"`
+}
+
+type XattrRequest struct {
+	Path  string `json:"path" binding:"required"`
+	Name  string `json:"name" binding:"required"`
+	Value string `json:"value"`
+}
+
 func main() {
 	app := fiber.New()
 
@@ -132,7 +153,7 @@ func main() {
 		if isFile {
 			text, err := commands.ParserCat([]string{"-file1=" + c.Query("path")})
 			if err != nil {
-				return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+				return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
 			}
 
 			return c.JSON(FileResponse{
@@ -142,7 +163,7 @@ func main() {
 
 		data, err := getElementsInFolder(c.Params("partitionId"), c.Query("path"))
 		if err != nil {
-			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
 		}
 
 		return c.JSON(FolderResponse{
@@ -150,12 +171,118 @@ func main() {
 		})
 	})
 
+	app.Get("/xattr", func(c *fiber.Ctx) error {
+		if name := c.Query("name"); name != "" {
+			value, err := commands.ParserGetXattr(xattrTokens(c.Query("path"), name))
+			if err != nil {
+				return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+			}
+
+			return c.JSON(FileResponse{
+				Result: value,
+			})
+		}
+
+		attrs, err := commands.ListXattrs(c.Query("path"))
+		if err != nil {
+			return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		return c.JSON(XattrListResponse{
+			Result: attrs,
+		})
+	})
+
+	app.Put("/xattr", func(c *fiber.Ctx) error {
+		var req XattrRequest
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		if strings.Contains(req.Value, "\"") {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid value: quotes are not allowed"})
+		}
+
+		tokens := append(xattrTokens(req.Path, req.Name), "-value=\""+req.Value+"\"")
+		result, err := commands.ParserSetXattr(tokens)
+		if err != nil {
+			return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		return c.JSON(ExecuteResponse{
+			Result: result,
+		})
+	})
+
+	app.Delete("/xattr", func(c *fiber.Ctx) error {
+		result, err := commands.ParserRmXattr(xattrTokens(c.Query("path"), c.Query("name")))
+		if err != nil {
+			return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		return c.JSON(ExecuteResponse{
+			Result: result,
+		})
+	})
+
+	app.Get("/df", func(c *fiber.Ctx) error {
+		usage, err := commands.DiskFree()
+		if err != nil {
+			return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		return c.JSON(DfResponse{
+			Result: usage,
+		})
+	})
+
+	app.Get("/du", func(c *fiber.Ctx) error {
+		depth, err := strconv.Atoi(c.Query("depth", "0"))
+		if err != nil || depth < 0 {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid depth: " + c.Query("depth")})
+		}
+
+		usage, err := commands.DiskUsage(c.Query("path", "/"), depth)
+		if err != nil {
+			return c.Status(errorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		return c.JSON(DuResponse{
+			Result: usage,
+		})
+	})
+
 	err := app.Listen(":5000")
 	if err != nil {
 		return
 	}
 }
 
+// errorStatus maps permission errors to 403, missing attributes to 404, corrupted structures
+// to 500 and everything else to 400
+func errorStatus(err error) int {
+	var permissionError *structures.PermissionError
+	if errors.As(err, &permissionError) {
+		return http.StatusForbidden
+	}
+
+	if errors.Is(err, structures.ErrXattrNotFound) {
+		return http.StatusNotFound
+	}
+
+	var corruptionError *structures.CorruptionError
+	if errors.As(err, &corruptionError) {
+		return http.StatusInternalServerError
+	}
+
+	return http.StatusBadRequest
+}
+
+// xattrTokens builds the -path and -name arguments of the xattr commands
+func xattrTokens(path, name string) []string {
+	return []string{"-path=\"" + path + "\"", "-name=\"" + name + "\""}
+}
+
 func processContent(content string) string {
 	return analyzer.Analyzer(content)
 }
@@ -201,6 +328,11 @@ func getPartitionsListDisk(diskId string) []map[string]string {
 }
 
 func getElementsInFolder(partitionID, path string) ([]structures.FolderElement, error) {
+	creds, err := global.GetLoggedCredentials()
+	if err != nil {
+		return nil, fmt.Errorf("you must be logged in")
+	}
+
 	mountedPartition, partitionPath, err := global.GetMountedPartition(partitionID)
 	if err != nil {
 		return nil, err
@@ -219,6 +351,10 @@ func getElementsInFolder(partitionID, path string) ([]structures.FolderElement,
 		}
 	}
 
+	if err := sb.CheckAccess(partitionPath, result, creds, structures.PermRead|structures.PermExec); err != nil {
+		return nil, err
+	}
+
 	indexInode := sb.GetInodeReference(partitionPath, 0, result)
 	folderElement, err := sb.GetInodeElements(partitionPath, indexInode)
 	if err != nil {
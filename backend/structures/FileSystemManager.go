@@ -1,9 +1,8 @@
 package structures
 
 import (
+	"bytes"
 	"fmt"
-	"strings"
-	"time"
 )
 
 type FolderElement struct {
@@ -12,7 +11,17 @@ type FolderElement struct {
 	Type string `json:"type"`
 }
 
+// GetFile returns the content of the file at filePath, following symbolic links
 func (sb *SuperBlock) GetFile(path string, index int32, filePath []string) string {
+	resolved, err := sb.ResolvePath(path, filePath, true)
+	if err != nil {
+		return "Error " + err.Error()
+	}
+
+	return sb.getFile(path, index, resolved)
+}
+
+func (sb *SuperBlock) getFile(path string, index int32, filePath []string) string {
 	inode := &Inode{}
 	inodePath := int64(sb.SInodeStart + index*sb.SInodeSize)
 
@@ -20,10 +29,10 @@ func (sb *SuperBlock) GetFile(path string, index int32, filePath []string) strin
 		return ""
 	}
 
-	if inode.IType == '0' {
+	if inode.IType == '0' && len(filePath) > 0 {
 		inodeIndex := sb.findInodeInBlock(path, filePath[0], inode)
 		if inodeIndex != -1 {
-			return sb.GetFile(path, inodeIndex, filePath[1:])
+			return sb.getFile(path, inodeIndex, filePath[1:])
 		}
 	} else if inode.IType == '1' {
 		return sb.getFileContent(path, inode)
@@ -33,75 +42,64 @@ func (sb *SuperBlock) GetFile(path string, index int32, filePath []string) strin
 }
 
 func (sb *SuperBlock) getFileContent(path string, inode *Inode) string {
-	var content strings.Builder
-
-	for _, block := range inode.IBlock[:12] {
-		if block == -1 {
-			continue
-		}
-		content.WriteString(sb.getContentBlock(path, block))
-	}
-
-	if inode.IBlock[12] != -1 {
-		content.WriteString(sb.getIndirectBlockContent(path, inode.IBlock[12], 1))
+	if inode.IsInline() {
+		return string(inode.InlineData())
 	}
 
-	if inode.IBlock[13] != -1 {
-		content.WriteString(sb.getIndirectBlockContent(path, inode.IBlock[13], 2))
+	if inode.IsCompressed() {
+		content, err := sb.compressedContent(path, inode)
+		if err != nil {
+			return ""
+		}
+		return string(content)
 	}
 
-	if inode.IBlock[14] != -1 {
-		content.WriteString(sb.getIndirectBlockContent(path, inode.IBlock[14], 3))
-	}
+	blockSize := int(sb.SBlockSize)
+	var content []byte
 
-	return content.String()
-}
+	// holes between allocated blocks read as zeros
+	sb.forEachFileBlock(path, inode, func(logical, blockIndex int32) {
+		block := sb.NewFileBlock()
+		if err := block.ReadFileBlock(path, int64(sb.SBlockStart+blockIndex*sb.SBlockSize)); err != nil {
+			return
+		}
 
-func (sb *SuperBlock) getContentBlock(path string, index int32) string {
-	block := &FileBlock{}
-	blockPath := int64(sb.SBlockStart + index*sb.SBlockSize)
+		start := int(logical) * blockSize
+		if len(content) < start {
+			content = append(content, make([]byte, start-len(content))...)
+		}
+		content = append(content[:start], block.BContent...)
+	})
 
-	if err := block.ReadFileBlock(path, blockPath); err != nil {
-		return ""
+	// files written before ISize was kept end at their last non zero byte
+	size := max(int(inode.ISize), len(bytes.TrimRight(content, "\x00")))
+	if len(content) < size {
+		content = append(content, make([]byte, size-len(content))...)
 	}
 
-	return strings.TrimRight(string(block.BContent[:]), "\x00")
+	return string(content[:size])
 }
 
-func (sb *SuperBlock) getIndirectBlockContent(path string, blockIndex int32, level int) string {
-	if level == 0 {
-		return sb.getContentBlock(path, blockIndex)
-	}
-
-	block := &PointerBlock{}
-	blockPath := int64(sb.SBlockStart + blockIndex*sb.SBlockSize)
-
-	if err := block.ReadPointerBlock(path, blockPath); err != nil {
-		return ""
-	}
-
-	var content strings.Builder
-	for _, subBlockIndex := range block.PPointers {
-		if subBlockIndex == -1 {
-			continue
-		}
-		content.WriteString(sb.getIndirectBlockContent(path, subBlockIndex, level-1))
+// WriteFile writes content into the file at filePath, following symbolic links
+func (sb *SuperBlock) WriteFile(path string, index int32, filePath []string, content string) (int, error) {
+	resolved, err := sb.ResolvePath(path, filePath, true)
+	if err != nil {
+		return 0, err
 	}
 
-	return content.String()
+	return sb.writeFile(path, index, resolved, content)
 }
 
-// WriteFile writes a file in the filesystem
-func (sb *SuperBlock) WriteFile(path string, index int32, filePath []string, content string) (int, error) {
+func (sb *SuperBlock) writeFile(path string, index int32, filePath []string, content string) (int, error) {
 	inode := &Inode{}
 	if err := inode.ReadInode(path, int64(sb.SInodeStart+index*sb.SInodeSize)); err != nil {
 		return 0, err
 	}
 
-	if inode.IType == '0' {
+	if inode.IType == '0' && len(filePath) > 0 {
 		inodeIndex := sb.findInodeInBlock(path, filePath[0], inode)
 		if inodeIndex != -1 {
-			writtenBytes, err := sb.WriteFile(path, inodeIndex, filePath[1:], content)
+			writtenBytes, err := sb.writeFile(path, inodeIndex, filePath[1:], content)
 			if err != nil {
 				return 0, err
 			}
@@ -117,120 +115,90 @@ func (sb *SuperBlock) WriteFile(path string, index int32, filePath []string, con
 	return 0, nil
 }
 
+// writeFileContent writes content at the start of the file
 func (sb *SuperBlock) writeFileContent(path string, inode *Inode, content string, index int32) (int, error) {
-	inode.IMTime = float32(time.Now().Unix())
-	var err error
-	for i, blockIndex := range inode.IBlock[:12] {
-		if content == "" {
-			break
-		}
-		if blockIndex == -1 {
-			inode.IBlock[i] = sb.SBlocksCount
-			inode.IMTime = float32(time.Now().Unix())
-
-			content, err = sb.CreateFileBlock(path, content)
-			if err != nil {
-				return 0, err
-			}
-		} else {
-			content, err = sb.WriteFileBlock(path, blockIndex, content)
-			if err != nil {
-				return 0, err
-			}
-		}
-	}
-
-	for i, blockIndex := range inode.IBlock[12:] {
-		if content == "" {
-			break
-		}
+	return sb.writeFileAt(path, inode, index, 0, content)
+}
 
-		if blockIndex == -1 {
-			inode.IBlock[i] = sb.SBlocksCount
-			inode.IMTime = float32(time.Now().Unix())
+// writeFileAt writes content at offset, in the inode itself when the file is small
+// enough to be stored inline and compressed again when the file is compressed
+func (sb *SuperBlock) writeFileAt(path string, inode *Inode, index int32, offset int, content string) (int, error) {
+	defer sb.chargeTo(inode.IuId, inode.IGid)()
 
-			if err := sb.CreatePointerBlock(path, i); err != nil {
-				return 0, err
-			}
-
-			content, err = sb.CreateFileBlock(path, content)
-			if err != nil {
-				return 0, err
-			}
-		} else {
-
-		}
+	if inode.IsCompressed() {
+		return sb.compressedWrite(path, inode, index, offset, content)
 	}
 
-	if err := inode.WriteInode(path, int64(sb.SInodeStart+index*sb.SInodeSize),
-		int64(sb.SInodeStart+(index+1)*sb.SInodeSize)); err != nil {
-		return 0, err
+	if done, err := sb.inlineWrite(path, inode, index, offset, content); done || err != nil {
+		if err != nil {
+			return 0, err
+		}
+		return len(content), nil
 	}
 
-	return 0, nil
+	return sb.writeFileBlocks(path, inode, index, offset, content)
 }
 
-func (sb *SuperBlock) writePointerContent(path string, blockIndex, level int32, content string) (string, error) {
-	block := &PointerBlock{}
-	blockPath := int64(sb.SBlockStart + blockIndex*sb.SBlockSize)
+// writeFileBlocks writes content at offset in data blocks, only the blocks it touches are
+// allocated so a write past the end or into a hole leaves the other holes unallocated
+func (sb *SuperBlock) writeFileBlocks(path string, inode *Inode, index int32, offset int, content string) (int, error) {
+	blockSize := int(sb.SBlockSize)
+	inodeStart := int64(sb.SInodeStart + index*sb.SInodeSize)
+
+	written := 0
 	var err error
-	err = block.ReadPointerBlock(path, blockPath)
-	if err != nil {
-		return "", err
-	}
+	for written < len(content) {
+		position := offset + written
 
-	for i, pointer := range block.PPointers {
-		if content == "" {
+		var blockIndex int32
+		blockIndex, err = sb.fileBlock(path, inode, int32(position/blockSize), true)
+		if err != nil {
 			break
 		}
-		if pointer == -1 {
-			block.PPointers[i] = sb.SBlocksCount
-			if err := block.WritePointerBlock(path, blockPath, blockPath+int64(sb.SBlockSize)); err != nil {
-				return "", err
-			}
 
-			if level != 0 {
-				if err := sb.CreatePointerBlock(path, int(level-1)); err != nil {
-					return "", err
-				}
-			}
+		block := sb.NewFileBlock()
+		blockStart := int64(sb.SBlockStart + blockIndex*sb.SBlockSize)
+		if err = block.ReadFileBlock(path, blockStart); err != nil {
+			break
+		}
 
-			content, err = sb.CreateFileBlock(path, content)
-			if err != nil {
-				return "", err
-			}
-		} else {
-			if level == 0 {
-				content, err = sb.WriteFileBlock(path, pointer, content)
-				if err != nil {
-					return "", err
-				}
-			} else {
-				content, err = sb.writePointerContent(path, pointer, level-1, content)
-				if err != nil {
-					return "", err
-				}
-			}
+		n := copy(block.BContent[position%blockSize:], content[written:])
+		if err = block.WriteFileBlock(path, blockStart, blockStart+int64(sb.SBlockSize)); err != nil {
+			break
 		}
+
+		written += n
+		inode.ISize = max(inode.ISize, int32(offset+written))
+	}
+
+	// the inode is saved even when writing fails so the blocks allocated stay referenced
+	inode.IMTime = Timestamp()
+	if err := inode.WriteInode(path, inodeStart, inodeStart+int64(sb.SInodeSize)); err != nil {
+		return written, err
 	}
 
-	return content, nil
+	return written, err
 }
 
-// CreateInode creates a new inode in the filesystem
-func (sb *SuperBlock) CreateInode(path string, isFile bool) error {
-	if sb.SFreeInodeCount == 0 {
-		return fmt.Errorf("no free inodes")
+// CreateInode creates a new inode in the filesystem owned by owner
+func (sb *SuperBlock) CreateInode(path string, isFile bool, owner *Credentials) error {
+	defer sb.chargeTo(owner.UID, owner.GID)()
+
+	if err := sb.CheckFreeInodes(1); err != nil {
+		return err
 	}
 
 	newInode := &Inode{}
 	newInode.DefaultValue(-1)
+	newInode.IuId = owner.UID
+	newInode.IGid = owner.GID
 	if isFile {
 		newInode.IType = '1'
+		newInode.IPerm = [3]byte{'6', '6', '4'}
 	} else {
 		newInode.IType = '0'
+		newInode.IPerm = [3]byte{'7', '7', '5'}
 	}
-	newInode.IPerm = [3]byte{'6', '6', '4'}
 
 	if err := newInode.WriteInode(path, int64(sb.SFirstIno), int64(sb.SFirstIno+sb.SInodeSize)); err != nil {
 		return err
@@ -243,18 +211,17 @@ func (sb *SuperBlock) CreateInode(path string, isFile bool) error {
 	return nil
 }
 
-// CreateFolderBlock creates a new folder block in the filesystem
-func (sb *SuperBlock) CreateFolderBlock(path, name string, indexInode int32) error {
-	if sb.SFreeBlockCount == 0 {
-		return fmt.Errorf("no free blocks")
+// CreateFolderBlock creates a new folder block in the filesystem with an entry name -> target
+func (sb *SuperBlock) CreateFolderBlock(path, name string, indexInode, target int32) error {
+	if err := sb.CheckFreeBlocks(1); err != nil {
+		return err
 	}
 
-	newBlock := &FolderBlock{}
-	newBlock.DefaultValue()
+	newBlock := sb.NewFolderBlock()
 	newBlock.BContent[0].BInode = indexInode // FIX CURRENT
 	newBlock.BContent[1].BInode = indexInode // FIX FATHER
 
-	newBlock.BContent[2].BInode = sb.SInodesCount
+	newBlock.BContent[2].BInode = target
 	copy(newBlock.BContent[2].BName[:], name)
 
 	if err := newBlock.WriteFolderBlock(path, int64(sb.SFirstBlo), int64(sb.SFirstBlo+sb.SBlockSize)); err != nil {
@@ -268,60 +235,22 @@ func (sb *SuperBlock) CreateFolderBlock(path, name string, indexInode int32) err
 	return nil
 }
 
-// CreateFileBlock creates a new file block in the filesystem
-func (sb *SuperBlock) CreateFileBlock(path string, content string) (string, error) {
-	if sb.SFreeBlockCount == 0 {
-		return "", fmt.Errorf("no free blocks")
-	}
-
-	newBlock := &FileBlock{}
-	toWrite := min(len(content), 64)
-	copy(newBlock.BContent[:], content[:toWrite])
-
-	if err := newBlock.WriteFileBlock(path, int64(sb.SFirstBlo), int64(sb.SFirstBlo+sb.SBlockSize)); err != nil {
-		return "", err
-	}
-
-	if err := sb.UpdateBitmapBlock(path); err != nil {
-		return "", err
-	}
-
-	return content[toWrite:], nil
-}
-
-func (sb *SuperBlock) WriteFileBlock(path string, index int32, content string) (string, error) {
-	block := &FileBlock{}
-	blockPath := int64(sb.SBlockStart + index*sb.SBlockSize)
-
-	if err := block.ReadFileBlock(path, blockPath); err != nil {
-		return "", err
-	}
-
-	toWrite := min(len(content), 64)
-	copy(block.BContent[:], content[:toWrite])
-
-	if err := block.WriteFileBlock(path, blockPath, blockPath+int64(sb.SBlockSize)); err != nil {
-		return "", err
-	}
-
-	return content[toWrite:], nil
-}
-
-// CreatePointerBlock creates a new pointer block in the filesystem
+// CreatePointerBlock creates a new pointer block in the filesystem, its first pointer
+// references the next allocated block (another pointer block while level > 0)
 func (sb *SuperBlock) CreatePointerBlock(path string, level int) error {
-	if sb.SFreeBlockCount == 0 {
-		return fmt.Errorf("no free blocks")
+	if err := sb.CheckFreeBlocks(1); err != nil {
+		return err
 	}
 
-	newBlock := &PointerBlock{}
-	newBlock.DefaultValue()
-	newBlock.PPointers[0] = sb.SBlocksCount + 1
-
-	if err := newBlock.WritePointerBlock(path, int64(sb.SFirstBlo), int64(sb.SFirstBlo+sb.SBlockSize)); err != nil {
+	blockStart := int64(sb.SFirstBlo)
+	if err := sb.UpdateBitmapBlock(path); err != nil {
 		return err
 	}
 
-	if err := sb.UpdateBitmapBlock(path); err != nil {
+	newBlock := sb.NewPointerBlock()
+	newBlock.PPointers[0] = sb.NextBlockIndex()
+
+	if err := newBlock.WritePointerBlock(path, blockStart, blockStart+int64(sb.SBlockSize)); err != nil {
 		return err
 	}
 
@@ -333,7 +262,7 @@ func (sb *SuperBlock) CreatePointerBlock(path string, level int) error {
 }
 
 // CreateNewInode creates a new inode in the filesystem (File/Folder)
-func (sb *SuperBlock) CreateNewInode(path string, filePath []string, indexInode int32, isFile, root bool) error {
+func (sb *SuperBlock) CreateNewInode(path string, filePath []string, indexInode int32, isFile, root bool, owner *Credentials) error {
 	inode := &Inode{}
 	inodePath := int64(sb.SInodeStart + indexInode*sb.SInodeSize)
 
@@ -341,170 +270,214 @@ func (sb *SuperBlock) CreateNewInode(path string, filePath []string, indexInode
 		return err
 	}
 
-	if inode.IType == '1' {
-		return fmt.Errorf("invalid inode type: file")
+	if inode.IType != '0' {
+		return fmt.Errorf("invalid inode type: not a folder")
 	}
 
 	if len(filePath) == 1 {
-		return sb.CreatePath(path, filePath[0], inode, isFile, indexInode)
+		return sb.CreatePath(path, filePath[0], inode, isFile, indexInode, owner)
 	}
 
 	newIndexInode := sb.findInodeInBlock(path, filePath[0], inode)
 
 	if newIndexInode != -1 {
-		return sb.CreateNewInode(path, filePath[1:], newIndexInode, isFile, root)
+		return sb.CreateNewInode(path, filePath[1:], newIndexInode, isFile, root, owner)
 	}
 
 	if root {
-		if err := sb.CreatePath(path, filePath[0], inode, false, indexInode); err != nil {
+		if err := sb.CreatePath(path, filePath[0], inode, false, indexInode, owner); err != nil {
 			return err
 		}
 		newIndexInode := sb.findInodeInBlock(path, filePath[0], inode)
-		return sb.CreateNewInode(path, filePath[1:], newIndexInode, isFile, root)
+		return sb.CreateNewInode(path, filePath[1:], newIndexInode, isFile, root, owner)
 	}
 
 	return nil
 }
 
 // CreatePath creates a new path in the filesystem
-func (sb *SuperBlock) CreatePath(path, name string, inode *Inode, isFile bool, indexInode int32) error {
+func (sb *SuperBlock) CreatePath(path, name string, inode *Inode, isFile bool, indexInode int32, owner *Credentials) error {
+	if err := sb.CheckFreeInodes(1); err != nil {
+		return err
+	}
+
+	if err := sb.AddFolderEntry(path, indexInode, name, sb.NextInodeIndex()); err != nil {
+		return err
+	}
+
+	if err := inode.ReadInode(path, int64(sb.SInodeStart+indexInode*sb.SInodeSize)); err != nil {
+		return err
+	}
+
+	return sb.CreateInode(path, isFile, owner)
+}
+
+// AddFolderEntry adds the entry name -> target to the folder at indexInode,
+// reusing a free slot of its blocks or allocating a new folder block. The blocks
+// allocated belong to the folder and are charged to its owner
+func (sb *SuperBlock) AddFolderEntry(path string, indexInode int32, name string, target int32) error {
+	folder := &Inode{}
+	if err := folder.ReadInode(path, int64(sb.SInodeStart+indexInode*sb.SInodeSize)); err != nil {
+		return err
+	}
+	defer sb.chargeTo(folder.IuId, folder.IGid)()
+
+	encoded, err := sb.encodeName(path, name)
+	if err != nil {
+		return err
+	}
+
+	block, err := sb.addFolderEntry(path, indexInode, encoded, target)
+	if err != nil {
+		if freeErr := sb.releaseName(path, encoded); freeErr != nil {
+			return freeErr
+		}
+		return err
+	}
+
+	return sb.indexFolderEntry(path, indexInode, name, block)
+}
+
+// addFolderEntry stores an encoded entry and returns the folder block that holds it
+func (sb *SuperBlock) addFolderEntry(path string, indexInode int32, name string, target int32) (int32, error) {
+	inode := &Inode{}
+	inodeStart := int64(sb.SInodeStart + indexInode*sb.SInodeSize)
+
+	if err := inode.ReadInode(path, inodeStart); err != nil {
+		return -1, err
+	}
+
 	for i, blockIndex := range inode.IBlock[:12] {
 		if blockIndex == -1 {
-			inode.IBlock[i] = sb.SBlocksCount
-			inode.IMTime = float32(time.Now().Unix())
+			inode.IBlock[i] = sb.NextBlockIndex()
+			inode.IMTime = Timestamp()
 
-			if err := sb.CreateBlockAndWriteInode(path, name, inode, indexInode); err != nil {
-				return err
-			}
-		} else {
-			if condition, err := sb.addContentToFolderBlock(path, name, blockIndex); err != nil {
-				return err
-			} else if !condition {
-				continue
+			if err := sb.CreateFolderBlock(path, name, indexInode, target); err != nil {
+				return -1, err
 			}
+
+			return inode.IBlock[i], inode.WriteInode(path, inodeStart, inodeStart+int64(sb.SInodeSize))
 		}
 
-		return sb.CreateInode(path, isFile)
+		if added, err := sb.addEntryToFolderBlock(path, blockIndex, name, target); err != nil || added != -1 {
+			return added, err
+		}
 	}
 
 	for i, blockIndex := range inode.IBlock[12:] {
 		if blockIndex == -1 {
-			inode.IBlock[i+12] = sb.SBlocksCount
-			inode.IMTime = float32(time.Now().Unix())
+			// i+1 pointer blocks and the folder block
+			if err := sb.CheckFreeBlocks(int32(i) + 2); err != nil {
+				return -1, err
+			}
+
+			inode.IBlock[i+12] = sb.NextBlockIndex()
+			inode.IMTime = Timestamp()
 
 			if err := sb.CreatePointerBlock(path, i); err != nil {
-				return err
+				return -1, err
 			}
 
-			if err := sb.CreateBlockAndWriteInode(path, name, inode, indexInode); err != nil {
-				return err
+			added := sb.NextBlockIndex()
+			if err := sb.CreateFolderBlock(path, name, indexInode, target); err != nil {
+				return -1, err
 			}
 
-		} else {
-			if condition, err := sb.addContentToPointerBlock(path, name, blockIndex, indexInode, int32(i)); err != nil {
-				return err
-			} else if !condition {
-				continue
-			}
+			return added, inode.WriteInode(path, inodeStart, inodeStart+int64(sb.SInodeSize))
 		}
 
-		return sb.CreateInode(path, isFile)
+		if added, err := sb.addEntryToPointerBlock(path, blockIndex, int32(i), indexInode, name, target); err != nil || added != -1 {
+			return added, err
+		}
 	}
 
-	return fmt.Errorf("no free blocks")
+	return -1, fmt.Errorf("no free entries in folder")
 }
 
-// CreateBlockAndWriteInode creates a new block and writes the inode in the filesystem
-func (sb *SuperBlock) CreateBlockAndWriteInode(path, name string, inode *Inode, indexInode int32) error {
-	inodeStart := int64(sb.SInodeStart + indexInode*sb.SInodeSize)
-	inodeEnd := int64(sb.SInodeStart + (indexInode+1)*sb.SInodeSize)
+// addEntryToFolderBlock adds an entry to the first free slot of a folder block,
+// it returns blockIndex when the entry was added and -1 when the block is full
+func (sb *SuperBlock) addEntryToFolderBlock(path string, blockIndex int32, name string, target int32) (int32, error) {
+	block := sb.NewFolderBlock()
+	blockStart := int64(sb.SBlockStart + blockIndex*sb.SBlockSize)
 
-	if err := inode.WriteInode(path, inodeStart, inodeEnd); err != nil {
-		return err
+	if err := block.ReadFolderBlock(path, blockStart); err != nil {
+		return -1, err
 	}
 
-	if err := sb.CreateFolderBlock(path, name, indexInode); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// addContentToFolderBlock adds a new content to a folder block
-func (sb *SuperBlock) addContentToFolderBlock(path, name string, blockIndex int32) (bool, error) {
-	block := &FolderBlock{}
-
-	if err := block.ReadFolderBlock(path, int64(sb.SBlockStart+blockIndex*sb.SBlockSize)); err != nil {
-		return false, err
-	}
+	for i := 2; i < len(block.BContent); i++ {
+		if block.BContent[i].BInode != -1 {
+			continue
+		}
 
-	if block.BContent[3].BInode != -1 {
-		return false, nil
-	}
+		block.BContent[i] = FolderContent{BInode: target}
+		copy(block.BContent[i].BName[:], name)
 
-	copy(block.BContent[3].BName[:], name)
-	block.BContent[3].BInode = sb.SInodesCount
+		if err := block.WriteFolderBlock(path, blockStart, blockStart+int64(sb.SBlockSize)); err != nil {
+			return -1, err
+		}
 
-	if err := block.WriteFolderBlock(path, int64(sb.SBlockStart+blockIndex*sb.SBlockSize),
-		int64(sb.SBlockStart+(blockIndex+1)*sb.SBlockSize)); err != nil {
-		return false, err
+		return blockIndex, nil
 	}
 
-	return true, nil
+	return -1, nil
 }
 
-// addContentToPointerBlock adds a new content to a pointer block
-func (sb *SuperBlock) addContentToPointerBlock(path, name string, blockIndex, indexInode, level int32) (bool, error) {
-	block := &PointerBlock{}
+// addEntryToPointerBlock adds an entry below a pointer block, level 0 points to folder blocks.
+// It returns the folder block that received the entry, or -1 when every block is full
+func (sb *SuperBlock) addEntryToPointerBlock(path string, blockIndex, level, indexInode int32, name string, target int32) (int32, error) {
+	block := sb.NewPointerBlock()
+	blockStart := int64(sb.SBlockStart + blockIndex*sb.SBlockSize)
 
-	if err := block.ReadPointerBlock(path, int64(sb.SBlockStart+blockIndex*sb.SBlockSize)); err != nil {
-		return false, err
+	if err := block.ReadPointerBlock(path, blockStart); err != nil {
+		return -1, err
 	}
 
 	for i, pointer := range block.PPointers {
 		if pointer == -1 {
-			block.PPointers[i] = sb.SBlocksCount
+			// level pointer blocks and the folder block
+			if err := sb.CheckFreeBlocks(level + 1); err != nil {
+				return -1, err
+			}
 
-			if err := block.WritePointerBlock(path, int64(sb.SBlockStart+blockIndex*sb.SBlockSize),
-				int64(sb.SBlockStart+(blockIndex+1)*sb.SBlockSize)); err != nil {
-				return false, err
+			block.PPointers[i] = sb.NextBlockIndex()
+
+			if err := block.WritePointerBlock(path, blockStart, blockStart+int64(sb.SBlockSize)); err != nil {
+				return -1, err
 			}
+
 			if level != 0 {
 				if err := sb.CreatePointerBlock(path, int(level-1)); err != nil {
-					return false, err
+					return -1, err
 				}
 			}
-			if err := sb.CreateFolderBlock(path, name, sb.SInodesCount); err != nil {
-				return false, err
+
+			added := sb.NextBlockIndex()
+			if err := sb.CreateFolderBlock(path, name, indexInode, target); err != nil {
+				return -1, err
 			}
-			return true, nil
+
+			return added, nil
 		}
 
+		var added int32
+		var err error
 		if level == 0 {
-			if condition, err := sb.addContentToFolderBlock(path, name, pointer); err != nil {
-				return false, err
-			} else if !condition {
-				continue
-			} else {
-				return true, nil
-			}
+			added, err = sb.addEntryToFolderBlock(path, pointer, name, target)
 		} else {
-			if condition, err := sb.addContentToPointerBlock(path, name, pointer, indexInode, level-1); err != nil {
-				return false, err
-			} else if !condition {
-				continue
-			} else {
-				return true, nil
-			}
+			added, err = sb.addEntryToPointerBlock(path, pointer, level-1, indexInode, name, target)
+		}
+
+		if err != nil || added != -1 {
+			return added, err
 		}
 	}
 
-	return false, nil
+	return -1, nil
 }
 
 // GetIndexInode returns the index of an inode in a block
 func (sb *SuperBlock) GetIndexInode(path, file string, index int32) int32 {
-	block := &FolderBlock{}
+	block := sb.NewFolderBlock()
 	blockPath := int64(sb.SBlockStart + index*sb.SBlockSize)
 
 	if err := block.ReadFolderBlock(path, blockPath); err != nil {
@@ -512,16 +485,23 @@ func (sb *SuperBlock) GetIndexInode(path, file string, index int32) int32 {
 	}
 
 	for _, entry := range block.BContent[2:] {
-		name := strings.TrimRight(string(entry.BName[:]), "\x00")
-		if name == file {
+		if entry.BInode == -1 {
+			continue
+		}
+		if sb.EntryName(path, entry) == file {
 			return entry.BInode
 		}
 	}
 	return -1
 }
 
-// findInodeInBlock returns the index of an inode in a block
+// findInodeInBlock returns the index of the inode named part inside the folder inode,
+// indexed folders only read the blocks the hash points to
 func (sb *SuperBlock) findInodeInBlock(path, part string, inode *Inode) int32 {
+	if inode.IIndex != -1 {
+		return sb.lookupDirIndex(path, inode.IIndex, part)
+	}
+
 	for _, block := range inode.IBlock[:12] {
 		if block == -1 {
 			return -1
@@ -550,7 +530,7 @@ func (sb *SuperBlock) findInodeInBlock(path, part string, inode *Inode) int32 {
 
 // finInodeInPointerBlock returns the index of an inode in a pointer block
 func (sb *SuperBlock) finInodeInPointerBlock(path, part string, blockIndex, level int32) int32 {
-	block := &PointerBlock{}
+	block := sb.NewPointerBlock()
 	blockPath := int64(sb.SBlockStart + blockIndex*sb.SBlockSize)
 
 	if err := block.ReadPointerBlock(path, blockPath); err != nil {
@@ -578,6 +558,7 @@ func (sb *SuperBlock) finInodeInPointerBlock(path, part string, blockIndex, leve
 	return -1
 }
 
+// GetInodeElements lists the folder at index, direct and indirect blocks included
 func (sb *SuperBlock) GetInodeElements(path string, index int32) ([]FolderElement, error) {
 	inode := &Inode{}
 	inodePath := int64(sb.SInodeStart + index*sb.SInodeSize)
@@ -589,10 +570,7 @@ func (sb *SuperBlock) GetInodeElements(path string, index int32) ([]FolderElemen
 	var allElements []FolderElement
 
 	if index != -1 {
-		for _, block := range inode.IBlock[:12] {
-			if block == -1 {
-				continue
-			}
+		for _, block := range sb.FolderBlocks(path, inode) {
 			elements, err := sb.GetFolderElements(path, block)
 			if err != nil {
 				continue
@@ -606,7 +584,7 @@ func (sb *SuperBlock) GetInodeElements(path string, index int32) ([]FolderElemen
 }
 
 func (sb *SuperBlock) GetFolderElements(path string, index int32) ([]FolderElement, error) {
-	block := &FolderBlock{}
+	block := sb.NewFolderBlock()
 	blockPath := int64(sb.SBlockStart + index*sb.SBlockSize)
 
 	if err := block.ReadFolderBlock(path, blockPath); err != nil {
@@ -626,11 +604,14 @@ func (sb *SuperBlock) GetFolderElements(path string, index int32) ([]FolderEleme
 		}
 
 		element := FolderElement{
-			Name: strings.TrimRight(string(entry.BName[:]), "\x00"),
+			Name: sb.EntryName(path, entry),
 			ID:   entry.BInode,
 			Type: func() string {
-				if inode.IType == '1' {
+				switch inode.IType {
+				case '1':
 					return "file"
+				case '2':
+					return "symlink"
 				}
 				return "folder"
 			}(),
@@ -642,7 +623,17 @@ func (sb *SuperBlock) GetFolderElements(path string, index int32) ([]FolderEleme
 	return elements, nil
 }
 
+// GetInodeReference returns the index of the inode at filePath following symbolic links, or -1
 func (sb *SuperBlock) GetInodeReference(path string, index int32, filePath []string) int32 {
+	resolved, err := sb.ResolvePath(path, filePath, true)
+	if err != nil {
+		return -1
+	}
+
+	return sb.getInodeReference(path, index, resolved)
+}
+
+func (sb *SuperBlock) getInodeReference(path string, index int32, filePath []string) int32 {
 	if len(filePath) == 0 {
 		return index
 	}
@@ -654,23 +645,118 @@ func (sb *SuperBlock) GetInodeReference(path string, index int32, filePath []str
 		return -1
 	}
 
-	if len(filePath) == 1 {
-		for _, block := range inode.IBlock[:12] {
-			if block == -1 {
-				break
-			}
-			newIndexInode := sb.GetIndexInode(path, filePath[0], block)
-			if newIndexInode != -1 {
-				return newIndexInode
-			}
-		}
-	}
-
 	newIndexInode := sb.findInodeInBlock(path, filePath[0], inode)
 
 	if newIndexInode != -1 {
-		return sb.GetInodeReference(path, newIndexInode, filePath[1:])
+		return sb.getInodeReference(path, newIndexInode, filePath[1:])
 	}
 
 	return -1
 }
+
+// GetFolderEntries returns every used entry of a folder inode (direct and indirect blocks)
+func (sb *SuperBlock) GetFolderEntries(path string, inode *Inode) []FolderContent {
+	var entries []FolderContent
+
+	for _, block := range sb.FolderBlocks(path, inode) {
+		entries = append(entries, sb.getFolderBlockEntries(path, block)...)
+	}
+
+	return entries
+}
+
+// FolderBlocks returns the folder blocks of a folder inode, direct blocks first
+func (sb *SuperBlock) FolderBlocks(path string, inode *Inode) []int32 {
+	var blocks []int32
+
+	for _, block := range inode.IBlock[:12] {
+		if block == -1 {
+			continue
+		}
+		blocks = append(blocks, block)
+	}
+
+	for i, block := range inode.IBlock[12:] {
+		if block == -1 {
+			continue
+		}
+		blocks = append(blocks, sb.pointerFolderBlocks(path, block, int32(i))...)
+	}
+
+	return blocks
+}
+
+func (sb *SuperBlock) getFolderBlockEntries(path string, index int32) []FolderContent {
+	block := sb.NewFolderBlock()
+	blockPath := int64(sb.SBlockStart + index*sb.SBlockSize)
+
+	if err := block.ReadFolderBlock(path, blockPath); err != nil {
+		return nil
+	}
+
+	var entries []FolderContent
+	for _, entry := range block.BContent[2:] {
+		if entry.BInode == -1 {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func (sb *SuperBlock) pointerFolderBlocks(path string, index, level int32) []int32 {
+	block := sb.NewPointerBlock()
+	blockPath := int64(sb.SBlockStart + index*sb.SBlockSize)
+
+	if err := block.ReadPointerBlock(path, blockPath); err != nil {
+		return nil
+	}
+
+	var blocks []int32
+	for _, pointer := range block.PPointers {
+		if pointer == -1 {
+			continue
+		}
+
+		if level == 0 {
+			blocks = append(blocks, pointer)
+		} else {
+			blocks = append(blocks, sb.pointerFolderBlocks(path, pointer, level-1)...)
+		}
+	}
+
+	return blocks
+}
+
+// ChangePermissions updates IPerm of an inode (and its children when recursive),
+// only inodes owned by uid are changed unless uid is root
+func (sb *SuperBlock) ChangePermissions(path string, index int32, perm [3]byte, uid int32, recursive bool) error {
+	inode := &Inode{}
+	inodeStart := int64(sb.SInodeStart + index*sb.SInodeSize)
+
+	if err := inode.ReadInode(path, inodeStart); err != nil {
+		return err
+	}
+
+	if uid == RootUID || inode.IuId == uid {
+		inode.IPerm = perm
+		inode.ICTime = Timestamp()
+
+		if err := inode.WriteInode(path, inodeStart, inodeStart+int64(sb.SInodeSize)); err != nil {
+			return err
+		}
+	}
+
+	if !recursive || inode.IType != '0' {
+		return nil
+	}
+
+	for _, entry := range sb.GetFolderEntries(path, inode) {
+		if err := sb.ChangePermissions(path, entry.BInode, perm, uid, recursive); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
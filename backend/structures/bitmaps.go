@@ -1,10 +1,19 @@
 package structures
 
 import (
+	"bytes"
 	"encoding/binary"
+	"io"
 	"os"
 )
 
+const (
+	InodeFree byte = '0'
+	InodeUsed byte = '1'
+	BlockFree byte = 'O'
+	BlockUsed byte = 'X'
+)
+
 func (sb *SuperBlock) CreateBitMaps(path string) error {
 	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
 	if err != nil {
@@ -24,7 +33,7 @@ func (sb *SuperBlock) CreateBitMaps(path string) error {
 
 	buffer := make([]byte, sb.SFreeInodeCount)
 	for i := 0; i < len(buffer); i++ {
-		buffer[i] = '0'
+		buffer[i] = InodeFree
 	}
 
 	if err = binary.Write(file, binary.BigEndian, buffer); err != nil {
@@ -37,7 +46,7 @@ func (sb *SuperBlock) CreateBitMaps(path string) error {
 
 	buffer = make([]byte, sb.SFreeBlockCount)
 	for i := 0; i < len(buffer); i++ {
-		buffer[i] = 'O'
+		buffer[i] = BlockFree
 	}
 
 	if err = binary.Write(file, binary.BigEndian, buffer); err != nil {
@@ -47,7 +56,162 @@ func (sb *SuperBlock) CreateBitMaps(path string) error {
 	return nil
 }
 
+// NextInodeIndex returns the index of the first free inode, SFirstIno always points to it
+func (sb *SuperBlock) NextInodeIndex() int32 {
+	return (sb.SFirstIno - sb.SInodeStart) / sb.SInodeSize
+}
+
+// NextBlockIndex returns the index of the first free block, SFirstBlo always points to it
+func (sb *SuperBlock) NextBlockIndex() int32 {
+	return (sb.SFirstBlo - sb.SBlockStart) / sb.SBlockSize
+}
+
+// UpdateBitmapInode marks the inode at SFirstIno as used and moves SFirstIno to the next free inode,
+// the inode is charged to the active quota
 func (sb *SuperBlock) UpdateBitmapInode(path string) error {
+	if err := sb.checkQuota(1, 0); err != nil {
+		return err
+	}
+
+	index := sb.NextInodeIndex()
+	if err := sb.writeBitmap(path, int64(sb.SBMInodeStart+index), []byte{InodeUsed}); err != nil {
+		return err
+	}
+
+	sb.SInodesCount++
+	sb.SFreeInodeCount--
+	sb.chargeQuota(1, 0)
+
+	bitmap, err := sb.ReadInodeBitmap(path)
+	if err != nil {
+		return err
+	}
+	sb.SFirstIno = sb.SInodeStart + findFree(bitmap, index+1, InodeUsed)*sb.SInodeSize
+
+	return nil
+}
+
+// UpdateBitmapBlock marks the block at SFirstBlo as used and moves SFirstBlo to the next free block,
+// the block is charged to the active quota
+func (sb *SuperBlock) UpdateBitmapBlock(path string) error {
+	if err := sb.checkQuota(0, 1); err != nil {
+		return err
+	}
+
+	index := sb.NextBlockIndex()
+	if err := sb.writeBitmap(path, int64(sb.SBMBlockStart+index), []byte{BlockUsed}); err != nil {
+		return err
+	}
+
+	sb.SBlocksCount++
+	sb.SFreeBlockCount--
+	sb.chargeQuota(0, 1)
+
+	bitmap, err := sb.ReadBlockBitmap(path)
+	if err != nil {
+		return err
+	}
+	sb.SFirstBlo = sb.SBlockStart + findFree(bitmap, index+1, BlockUsed)*sb.SBlockSize
+
+	return nil
+}
+
+// FreeInode marks an inode as free, it becomes the next allocated one if it is the lowest free inode
+func (sb *SuperBlock) FreeInode(path string, index int32) error {
+	if err := sb.writeBitmap(path, int64(sb.SBMInodeStart+index), []byte{InodeFree}); err != nil {
+		return err
+	}
+
+	sb.SInodesCount--
+	sb.SFreeInodeCount++
+	sb.chargeQuota(-1, 0)
+	if index < sb.NextInodeIndex() {
+		sb.SFirstIno = sb.SInodeStart + index*sb.SInodeSize
+	}
+
+	return nil
+}
+
+// FreeBlock marks a block as free, it becomes the next allocated one if it is the lowest free block.
+// Snapshots sharing the block get a copy first, a free block may be overwritten any time
+func (sb *SuperBlock) FreeBlock(path string, index int32) error {
+	if err := sb.copyOnWrite(path, int64(sb.SBlockStart+index*sb.SBlockSize)); err != nil {
+		return err
+	}
+
+	if err := sb.writeBitmap(path, int64(sb.SBMBlockStart+index), []byte{BlockFree}); err != nil {
+		return err
+	}
+
+	sb.SBlocksCount--
+	sb.SFreeBlockCount++
+	sb.chargeQuota(0, -1)
+	if index < sb.NextBlockIndex() {
+		sb.SFirstBlo = sb.SBlockStart + index*sb.SBlockSize
+	}
+
+	return nil
+}
+
+// ReadInodeBitmap returns the raw inode bitmap, one byte per inode
+func (sb *SuperBlock) ReadInodeBitmap(path string) ([]byte, error) {
+	return readBitmap(path, int64(sb.SBMInodeStart), sb.InodeCapacity())
+}
+
+// ReadBlockBitmap returns the raw block bitmap, one byte per block
+func (sb *SuperBlock) ReadBlockBitmap(path string) ([]byte, error) {
+	return readBitmap(path, int64(sb.SBMBlockStart), sb.BlockCapacity())
+}
+
+// WriteInodeBitmap replaces the inode bitmap
+func (sb *SuperBlock) WriteInodeBitmap(path string, bitmap []byte) error {
+	return sb.writeBitmap(path, int64(sb.SBMInodeStart), bitmap)
+}
+
+// WriteBlockBitmap replaces the block bitmap
+func (sb *SuperBlock) WriteBlockBitmap(path string, bitmap []byte) error {
+	return sb.writeBitmap(path, int64(sb.SBMBlockStart), bitmap)
+}
+
+// ReplaceBitmaps writes both bitmaps and recomputes the counters and the first free slots from them
+func (sb *SuperBlock) ReplaceBitmaps(path string, inodeBitmap, blockBitmap []byte) error {
+	if err := sb.WriteInodeBitmap(path, inodeBitmap); err != nil {
+		return err
+	}
+
+	if err := sb.WriteBlockBitmap(path, blockBitmap); err != nil {
+		return err
+	}
+
+	sb.SInodesCount = int32(bytes.Count(inodeBitmap, []byte{InodeUsed}))
+	sb.SFreeInodeCount = sb.InodeCapacity() - sb.SInodesCount
+	sb.SFirstIno = sb.SInodeStart + findFree(inodeBitmap, 0, InodeUsed)*sb.SInodeSize
+
+	sb.SBlocksCount = int32(bytes.Count(blockBitmap, []byte{BlockUsed}))
+	sb.SFreeBlockCount = sb.BlockCapacity() - sb.SBlocksCount
+	sb.SFirstBlo = sb.SBlockStart + findFree(blockBitmap, 0, BlockUsed)*sb.SBlockSize
+
+	return nil
+}
+
+// GetUsedInodes returns the index of every inode marked as used in the bitmap
+func (sb *SuperBlock) GetUsedInodes(path string) ([]int32, error) {
+	bitmap, err := sb.ReadInodeBitmap(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var used []int32
+	for i, value := range bitmap {
+		if value == InodeUsed {
+			used = append(used, int32(i))
+		}
+	}
+
+	return used, nil
+}
+
+func (sb *SuperBlock) writeBitmap(path string, offset int64, values []byte) error {
 	file, err := os.OpenFile(path, os.O_RDWR, 0644)
 	if err != nil {
 		return err
@@ -60,25 +224,21 @@ func (sb *SuperBlock) UpdateBitmapInode(path string) error {
 		}
 	}(file)
 
-	if _, err = file.Seek(int64(sb.SBMInodeStart)+int64(sb.SInodesCount), 0); err != nil {
+	if _, err = file.Seek(offset, 0); err != nil {
 		return err
 	}
 
-	if _, err := file.Write([]byte{'1'}); err != nil {
+	if _, err := file.Write(values); err != nil {
 		return err
 	}
 
-	sb.SInodesCount++
-	sb.SFreeInodeCount--
-	sb.SFirstIno += sb.SInodeSize
-
 	return nil
 }
 
-func (sb *SuperBlock) UpdateBitmapBlock(path string) error {
-	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+func readBitmap(path string, offset int64, length int32) ([]byte, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	defer func(file *os.File) {
@@ -88,17 +248,32 @@ func (sb *SuperBlock) UpdateBitmapBlock(path string) error {
 		}
 	}(file)
 
-	if _, err = file.Seek(int64(sb.SBMBlockStart)+int64(sb.SBlocksCount), 0); err != nil {
-		return err
+	if _, err = file.Seek(offset, 0); err != nil {
+		return nil, err
 	}
 
-	if _, err := file.Write([]byte{'X'}); err != nil {
-		return err
+	buffer := make([]byte, length)
+	if _, err = io.ReadFull(file, buffer); err != nil {
+		return nil, err
 	}
 
-	sb.SBlocksCount++
-	sb.SFreeBlockCount--
-	sb.SFirstBlo += sb.SBlockSize
+	return buffer, nil
+}
 
-	return nil
+// findFree returns the first index not marked as used starting at from,
+// or len(bitmap) when the bitmap is full
+func findFree(bitmap []byte, from int32, used byte) int32 {
+	for i := from; i < int32(len(bitmap)); i++ {
+		if bitmap[i] != used {
+			return i
+		}
+	}
+
+	for i := int32(0); i < from && i < int32(len(bitmap)); i++ {
+		if bitmap[i] != used {
+			return i
+		}
+	}
+
+	return int32(len(bitmap))
 }
@@ -0,0 +1,92 @@
+package structures
+
+import (
+	"backend/utils"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+// CorruptionError is returned when a structure read from disk does not match its checksum,
+// the structure is still decoded so fsck can inspect and repair it
+type CorruptionError struct {
+	Structure string // "superblock", "inode", "folder block 12", ...
+	Offset    int64
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("%s at offset %d is corrupted: checksum mismatch", e.Structure, e.Offset)
+}
+
+// checksum returns the CRC32 of data encoded as it is stored on disk
+func checksum(data interface{}) uint32 {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, data); err != nil {
+		return 0
+	}
+	return crc32.ChecksumIEEE(buf.Bytes())
+}
+
+// checksum returns the CRC32 of the superblock with SChecksum cleared
+func (sb *SuperBlock) checksum() uint32 {
+	copy := sb.SuperBlockData
+	copy.SChecksum = 0
+	return checksum(&copy)
+}
+
+// checksum returns the CRC32 of the inode with IChecksum cleared
+func (i *Inode) checksum() uint32 {
+	copy := *i
+	copy.IChecksum = 0
+	return checksum(&copy)
+}
+
+// blockChecksumOffset returns where the checksum of the block stored at offset lives in
+// the checksum table, folder, pointer, index, name and attribute blocks have one
+func (sb *SuperBlock) blockChecksumOffset(offset int64) (int64, int32, bool) {
+	if sb == nil || sb.SChecksumStart == 0 {
+		return 0, 0, false
+	}
+
+	relative := offset - int64(sb.SBlockStart)
+	if relative < 0 || relative%int64(sb.SBlockSize) != 0 {
+		return 0, 0, false
+	}
+
+	index := int32(relative / int64(sb.SBlockSize))
+	if index >= sb.BlockCapacity() {
+		return 0, 0, false
+	}
+
+	return int64(sb.SChecksumStart) + int64(index)*4, index, true
+}
+
+// writeBlockChecksum stores the checksum of the block data written at offset
+func (sb *SuperBlock) writeBlockChecksum(path string, offset int64, data interface{}) error {
+	at, _, ok := sb.blockChecksumOffset(offset)
+	if !ok {
+		return nil
+	}
+
+	return utils.WriteToFile(path, at, at+4, checksum(data))
+}
+
+// verifyBlockChecksum compares the block data read at offset with its stored checksum
+func (sb *SuperBlock) verifyBlockChecksum(path string, offset int64, structure string, data interface{}) error {
+	at, index, ok := sb.blockChecksumOffset(offset)
+	if !ok {
+		return nil
+	}
+
+	var stored uint32
+	if err := utils.ReadFromFile(path, at, &stored); err != nil {
+		return err
+	}
+
+	if stored != checksum(data) {
+		return &CorruptionError{Structure: fmt.Sprintf("%s %d", structure, index), Offset: offset}
+	}
+
+	return nil
+}
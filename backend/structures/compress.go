@@ -0,0 +1,210 @@
+package structures
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// IsCompressed reports whether the content of the file is stored compressed
+func (i *Inode) IsCompressed() bool {
+	return i.IFlags&InodeCompressed != 0
+}
+
+// compressedContent decompresses the data blocks of a compressed file. The DEFLATE
+// stream ends by itself, the rest of the last block is ignored
+func (sb *SuperBlock) compressedContent(path string, inode *Inode) ([]byte, error) {
+	var stream []byte
+	sb.forEachFileBlock(path, inode, func(logical, blockIndex int32) {
+		block := sb.NewFileBlock()
+		if err := block.ReadFileBlock(path, int64(sb.SBlockStart+blockIndex*sb.SBlockSize)); err != nil {
+			return
+		}
+
+		start := int(logical) * int(sb.SBlockSize)
+		if len(stream) < start {
+			stream = append(stream, make([]byte, start-len(stream))...)
+		}
+		stream = append(stream[:start], block.BContent...)
+	})
+
+	content, err := io.ReadAll(flate.NewReader(bytes.NewReader(stream)))
+	if err != nil && inode.ISize > 0 {
+		return nil, fmt.Errorf("compressed content is corrupted: %v", err)
+	}
+
+	size := int(max(inode.ISize, 0))
+	if len(content) < size {
+		content = append(content, make([]byte, size-len(content))...)
+	}
+	return content[:size], nil
+}
+
+// compressedWrite writes content at offset in a compressed file. The whole file is
+// decompressed, changed and compressed again into new data blocks
+func (sb *SuperBlock) compressedWrite(path string, inode *Inode, index int32, offset int, content string) (int, error) {
+	data, err := sb.compressedContent(path, inode)
+	if err != nil {
+		return 0, err
+	}
+
+	if end := offset + len(content); len(data) < end {
+		data = append(data, make([]byte, end-len(data))...)
+	}
+	copy(data[offset:], content)
+
+	if err := sb.storeCompressed(path, inode, index, data); err != nil {
+		return 0, err
+	}
+	return len(content), nil
+}
+
+// storeCompressed replaces the data blocks of inode with data compressed, ISize is the
+// size of data so the file reads as data
+func (sb *SuperBlock) storeCompressed(path string, inode *Inode, index int32, data []byte) error {
+	var stream bytes.Buffer
+	writer, err := flate.NewWriter(&stream, flate.BestCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	// an empty file keeps no blocks at all
+	if len(data) == 0 {
+		stream.Reset()
+	}
+
+	return sb.replaceFileBlocks(path, inode, index, stream.String(), int32(len(data)))
+}
+
+// replaceFileBlocks writes content to new blocks and writes inode pointing to them with
+// ISize set to size, the old blocks are freed last so a failure leaves the file as it
+// was. Content goes inline as in a new file unless inode is compressed
+func (sb *SuperBlock) replaceFileBlocks(path string, inode *Inode, index int32, content string, size int32) error {
+	defer sb.chargeTo(inode.IuId, inode.IGid)()
+
+	replaced := *inode
+	for i := range replaced.IBlock {
+		replaced.IBlock[i] = -1
+	}
+	replaced.IFlags &^= InodeInline
+
+	if !replaced.IsCompressed() && sb.HasFeature(FeatureInlineData) && len(content) <= InlineDataSize {
+		replaced.SetInlineData([]byte(content))
+	} else {
+		if err := sb.fillFileBlocks(path, &replaced, content); err != nil {
+			sb.releaseFileBlocks(path, &replaced)
+			return err
+		}
+	}
+
+	replaced.ISize = size
+	replaced.IMTime = Timestamp()
+	inodeStart := int64(sb.SInodeStart + index*sb.SInodeSize)
+	if err := replaced.WriteInode(path, inodeStart, inodeStart+int64(sb.SInodeSize)); err != nil {
+		sb.releaseFileBlocks(path, &replaced)
+		return err
+	}
+
+	old := *inode
+	*inode = replaced
+	return sb.releaseFileBlocks(path, &old)
+}
+
+// fillFileBlocks writes content from the start of a file without blocks, the caller
+// writes the inode. Blocks of zeros are left as holes unless the file is compressed,
+// its stream is read back block by block
+func (sb *SuperBlock) fillFileBlocks(path string, inode *Inode, content string) error {
+	blockSize := int(sb.SBlockSize)
+	for n := 0; n*blockSize < len(content); n++ {
+		chunk := content[n*blockSize : min(len(content), (n+1)*blockSize)]
+		if !inode.IsCompressed() && strings.Trim(chunk, "\x00") == "" {
+			continue
+		}
+
+		blockIndex, err := sb.fileBlock(path, inode, int32(n), true)
+		if err != nil {
+			return err
+		}
+
+		block := sb.NewFileBlock()
+		copy(block.BContent, chunk)
+		blockStart := int64(sb.SBlockStart + blockIndex*sb.SBlockSize)
+		if err := block.WriteFileBlock(path, blockStart, blockStart+int64(sb.SBlockSize)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// releaseFileBlocks frees the data and pointer blocks of a file and leaves it empty,
+// the caller writes the inode
+func (sb *SuperBlock) releaseFileBlocks(path string, inode *Inode) error {
+	if !inode.IsInline() {
+		for i, block := range inode.IBlock {
+			if block == -1 {
+				continue
+			}
+
+			blocks := []int32{block}
+			if i >= 12 {
+				blocks = sb.pointerTreeBlocks(path, block, int32(i-12))
+			}
+
+			for _, b := range blocks {
+				if err := sb.FreeBlock(path, b); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for i := range inode.IBlock {
+		inode.IBlock[i] = -1
+	}
+	inode.IFlags &^= InodeInline
+	inode.ISize = 0
+	return nil
+}
+
+// SetCompression compresses or decompresses the file at filePath following symbolic
+// links, its content is written again in the new format
+func (sb *SuperBlock) SetCompression(path string, filePath []string, compress bool) error {
+	index := sb.GetInodeReference(path, 0, filePath)
+	if index == -1 {
+		return fmt.Errorf("path not found: /%s", strings.Join(filePath, "/"))
+	}
+
+	inode := &Inode{}
+	inodeStart := int64(sb.SInodeStart + index*sb.SInodeSize)
+	if err := inode.ReadInode(path, inodeStart); err != nil {
+		return err
+	}
+
+	if inode.IType != '1' {
+		return fmt.Errorf("not a file: /%s", strings.Join(filePath, "/"))
+	}
+
+	if inode.IsCompressed() == compress {
+		return nil
+	}
+
+	content := sb.getFileContent(path, inode)
+	if compress {
+		compressed := *inode
+		compressed.IFlags |= InodeCompressed
+		return sb.storeCompressed(path, &compressed, index, []byte(content))
+	}
+
+	decompressed := *inode
+	decompressed.IFlags &^= InodeCompressed
+	return sb.replaceFileBlocks(path, &decompressed, index, content, int32(len(content)))
+}
@@ -0,0 +1,62 @@
+package structures
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	path, sb := formatDisk(t, 200*1024, DefaultFormatOptions())
+	blockSize := int(sb.SBlockSize)
+
+	content := strings.Repeat("compress me ", 80)
+	createFile(t, sb, path, "/c.txt", content, root)
+	_, inode := readInode(t, sb, path, "/c.txt")
+	plain := sb.InodeBlockCount(path, inode)
+
+	if err := sb.SetCompression(path, SplitPath("/c.txt"), true); err != nil {
+		t.Fatal(err)
+	}
+
+	_, inode = readInode(t, sb, path, "/c.txt")
+	if !inode.IsCompressed() {
+		t.Fatalf("file is not compressed")
+	}
+	if blocks := sb.InodeBlockCount(path, inode); blocks >= plain {
+		t.Errorf("compressed file has %d blocks, %d before", blocks, plain)
+	}
+	if got := sb.GetFile(path, 0, SplitPath("/c.txt")); got != content {
+		t.Errorf("compressed file reads %q", got)
+	}
+
+	// writes and holes go into the stream
+	if _, err := sb.WriteFile(path, 0, SplitPath("/c.txt"), "C"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sb.ExtendFile(path, SplitPath("/c.txt"), int32(len(content)+10*blockSize)); err != nil {
+		t.Fatal(err)
+	}
+	content = "C" + content[1:] + strings.Repeat("\x00", 10*blockSize)
+	if got := sb.GetFile(path, 0, SplitPath("/c.txt")); got != content {
+		t.Errorf("compressed file reads %d bytes after writing, want %d", len(got), len(content))
+	}
+
+	if err := sb.SetCompression(path, SplitPath("/c.txt"), false); err != nil {
+		t.Fatal(err)
+	}
+
+	_, inode = readInode(t, sb, path, "/c.txt")
+	if inode.IsCompressed() {
+		t.Fatalf("file is still compressed")
+	}
+	if got := sb.GetFile(path, 0, SplitPath("/c.txt")); got != content {
+		t.Errorf("decompressed file reads %d bytes, want %d", len(got), len(content))
+	}
+
+	// the zeros at the end are left as holes
+	if blocks := sb.InodeBlockCount(path, inode); blocks != plain {
+		t.Errorf("decompressed file has %d blocks, want %d", blocks, plain)
+	}
+
+	checkClean(t, sb, path)
+}
@@ -0,0 +1,345 @@
+package structures
+
+import (
+	"backend/utils"
+	"fmt"
+	"hash/fnv"
+)
+
+// dirIndexMinBlocks is the number of direct folder blocks a folder needs before
+// it gets a hashed index on filesystems formatted with FeatureDirIndex
+const dirIndexMinBlocks = 4
+
+// IndexEntry maps the hash of a name to the folder block that holds the entry
+type IndexEntry struct {
+	IHash  uint32
+	IBlock int32
+	// Total size of the IndexEntry is 8 bytes
+}
+
+// IndexBlock holds the entries of one bucket of a directory index. The root of the index
+// is a PointerBlock with the first IndexBlock of every bucket, the IBlock of the last
+// entry links the next IndexBlock of the same bucket
+type IndexBlock struct {
+	IEntries []IndexEntry
+	sb       *SuperBlock // locates the checksum table
+	// Total size of the IndexBlock is SBlockSize bytes, SBlockSize/8 entries
+}
+
+// NewIndexBlock returns an empty index block sized for this filesystem
+func (sb *SuperBlock) NewIndexBlock() *IndexBlock {
+	block := &IndexBlock{IEntries: make([]IndexEntry, sb.SBlockSize/8), sb: sb}
+	for i := range block.IEntries {
+		block.IEntries[i].IBlock = -1
+	}
+	return block
+}
+
+// next returns the following index block of the bucket, or -1
+func (b *IndexBlock) next() int32 {
+	return b.IEntries[len(b.IEntries)-1].IBlock
+}
+
+func (b *IndexBlock) WriteIndexBlock(path string, offset int64, maxSize int64) error {
+	if err := b.sb.copyOnWrite(path, offset); err != nil {
+		return err
+	}
+
+	if err := utils.WriteToFile(path, offset, maxSize, b.IEntries); err != nil {
+		return err
+	}
+	return b.sb.writeBlockChecksum(path, offset, b.IEntries)
+}
+
+func (b *IndexBlock) ReadIndexBlock(path string, offset int64) error {
+	if err := utils.ReadFromFile(path, offset, b.IEntries); err != nil {
+		return err
+	}
+	return b.sb.verifyBlockChecksum(path, offset, "index block", b.IEntries)
+}
+
+// nameHash returns the hash used to place a name in a directory index
+func nameHash(name string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return h.Sum32()
+}
+
+// lookupDirIndex returns the inode named name using the index rooted at root,
+// only the folder blocks recorded under the hash of the name are read
+func (sb *SuperBlock) lookupDirIndex(path string, root int32, name string) int32 {
+	hash := nameHash(name)
+
+	heads := sb.NewPointerBlock()
+	if err := heads.ReadPointerBlock(path, int64(sb.SBlockStart+root*sb.SBlockSize)); err != nil {
+		return -1
+	}
+
+	next := heads.PPointers[hash%uint32(len(heads.PPointers))]
+	for steps := int32(0); next >= 0 && next < sb.BlockCapacity() && steps < sb.BlockCapacity(); steps++ {
+		block := sb.NewIndexBlock()
+		if err := block.ReadIndexBlock(path, int64(sb.SBlockStart+next*sb.SBlockSize)); err != nil {
+			return -1
+		}
+
+		for _, entry := range block.IEntries[:len(block.IEntries)-1] {
+			if entry.IBlock == -1 || entry.IHash != hash {
+				continue
+			}
+
+			if inode := sb.GetIndexInode(path, name, entry.IBlock); inode != -1 {
+				return inode
+			}
+		}
+
+		next = block.next()
+	}
+
+	return -1
+}
+
+// insertDirIndex records that a name with the given hash lives in folder block block
+func (sb *SuperBlock) insertDirIndex(path string, root int32, hash uint32, block int32) error {
+	heads := sb.NewPointerBlock()
+	rootStart := int64(sb.SBlockStart + root*sb.SBlockSize)
+	if err := heads.ReadPointerBlock(path, rootStart); err != nil {
+		return err
+	}
+
+	bucket := hash % uint32(len(heads.PPointers))
+	if heads.PPointers[bucket] == -1 {
+		if err := sb.CheckFreeBlocks(1); err != nil {
+			return err
+		}
+
+		heads.PPointers[bucket] = sb.NextBlockIndex()
+		if err := heads.WritePointerBlock(path, rootStart, rootStart+int64(sb.SBlockSize)); err != nil {
+			return err
+		}
+
+		return sb.createIndexBlock(path, hash, block)
+	}
+
+	current := heads.PPointers[bucket]
+	for {
+		indexBlock := sb.NewIndexBlock()
+		blockStart := int64(sb.SBlockStart + current*sb.SBlockSize)
+		if err := indexBlock.ReadIndexBlock(path, blockStart); err != nil {
+			return err
+		}
+
+		for i, entry := range indexBlock.IEntries[:len(indexBlock.IEntries)-1] {
+			if entry.IBlock == block && entry.IHash == hash {
+				return nil
+			}
+
+			if entry.IBlock == -1 {
+				indexBlock.IEntries[i] = IndexEntry{IHash: hash, IBlock: block}
+				return indexBlock.WriteIndexBlock(path, blockStart, blockStart+int64(sb.SBlockSize))
+			}
+		}
+
+		if indexBlock.next() != -1 {
+			current = indexBlock.next()
+			continue
+		}
+
+		if err := sb.CheckFreeBlocks(1); err != nil {
+			return err
+		}
+
+		indexBlock.IEntries[len(indexBlock.IEntries)-1].IBlock = sb.NextBlockIndex()
+		if err := indexBlock.WriteIndexBlock(path, blockStart, blockStart+int64(sb.SBlockSize)); err != nil {
+			return err
+		}
+
+		return sb.createIndexBlock(path, hash, block)
+	}
+}
+
+// createIndexBlock allocates an index block whose first entry is hash -> block
+func (sb *SuperBlock) createIndexBlock(path string, hash uint32, block int32) error {
+	indexBlock := sb.NewIndexBlock()
+	indexBlock.IEntries[0] = IndexEntry{IHash: hash, IBlock: block}
+
+	blockStart := int64(sb.SFirstBlo)
+	if err := sb.UpdateBitmapBlock(path); err != nil {
+		return err
+	}
+
+	return indexBlock.WriteIndexBlock(path, blockStart, blockStart+int64(sb.SBlockSize))
+}
+
+// indexFolderEntry keeps the index of a folder up to date after name was added to
+// folder block block, building the index once the folder is big enough. When the
+// index can not grow it is dropped and the folder falls back to linear scans
+func (sb *SuperBlock) indexFolderEntry(path string, indexInode int32, name string, block int32) error {
+	inode := &Inode{}
+	if err := inode.ReadInode(path, int64(sb.SInodeStart+indexInode*sb.SInodeSize)); err != nil {
+		return err
+	}
+
+	var err error
+	if inode.IIndex != -1 {
+		err = sb.insertDirIndex(path, inode.IIndex, nameHash(name), block)
+	} else if sb.HasFeature(FeatureDirIndex) && inode.IBlock[dirIndexMinBlocks-1] != -1 {
+		err = sb.buildDirIndex(path, indexInode, inode)
+	}
+
+	if err != nil {
+		return sb.DropDirIndex(path, indexInode)
+	}
+
+	return nil
+}
+
+// buildDirIndex creates the index of a folder from the entries it already has
+func (sb *SuperBlock) buildDirIndex(path string, indexInode int32, inode *Inode) error {
+	if err := sb.CheckFreeBlocks(1); err != nil {
+		return err
+	}
+
+	root := sb.NextBlockIndex()
+	if err := sb.NewPointerBlock().WritePointerBlock(path, int64(sb.SFirstBlo), int64(sb.SFirstBlo+sb.SBlockSize)); err != nil {
+		return err
+	}
+
+	if err := sb.UpdateBitmapBlock(path); err != nil {
+		return err
+	}
+
+	inode.IIndex = root
+	inodeStart := int64(sb.SInodeStart + indexInode*sb.SInodeSize)
+	if err := inode.WriteInode(path, inodeStart, inodeStart+int64(sb.SInodeSize)); err != nil {
+		return err
+	}
+
+	for _, blockIndex := range sb.FolderBlocks(path, inode) {
+		for _, entry := range sb.getFolderBlockEntries(path, blockIndex) {
+			if err := sb.insertDirIndex(path, root, nameHash(sb.EntryName(path, entry)), blockIndex); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// unindexFolderEntry keeps the index of a folder up to date after name was removed from
+// folder block blockIndex, the hash is removed once no other name of the block has it.
+// When the index can not be updated it is dropped
+func (sb *SuperBlock) unindexFolderEntry(path string, indexInode, root int32, name string, blockIndex int32, block *FolderBlock) error {
+	hash := nameHash(name)
+	for _, entry := range block.BContent[2:] {
+		if entry.BInode != -1 && nameHash(sb.EntryName(path, entry)) == hash {
+			return nil
+		}
+	}
+
+	if err := sb.removeDirIndex(path, root, hash, blockIndex); err != nil {
+		return sb.DropDirIndex(path, indexInode)
+	}
+
+	return nil
+}
+
+// removeDirIndex clears every entry hash -> block of the index rooted at root, the slots
+// are reused by insertDirIndex
+func (sb *SuperBlock) removeDirIndex(path string, root int32, hash uint32, block int32) error {
+	heads := sb.NewPointerBlock()
+	if err := heads.ReadPointerBlock(path, int64(sb.SBlockStart+root*sb.SBlockSize)); err != nil {
+		return err
+	}
+
+	next := heads.PPointers[hash%uint32(len(heads.PPointers))]
+	for steps := int32(0); next != -1; steps++ {
+		if next < 0 || next >= sb.BlockCapacity() || steps >= sb.BlockCapacity() {
+			return fmt.Errorf("bad index block %d", next)
+		}
+
+		indexBlock := sb.NewIndexBlock()
+		blockStart := int64(sb.SBlockStart + next*sb.SBlockSize)
+		if err := indexBlock.ReadIndexBlock(path, blockStart); err != nil {
+			return err
+		}
+
+		changed := false
+		for i, entry := range indexBlock.IEntries[:len(indexBlock.IEntries)-1] {
+			if entry.IBlock == block && entry.IHash == hash {
+				indexBlock.IEntries[i] = IndexEntry{IBlock: -1}
+				changed = true
+			}
+		}
+
+		if changed {
+			if err := indexBlock.WriteIndexBlock(path, blockStart, blockStart+int64(sb.SBlockSize)); err != nil {
+				return err
+			}
+		}
+
+		next = indexBlock.next()
+	}
+
+	return nil
+}
+
+// DropDirIndex frees the index of a folder, lookups go back to scanning its blocks
+func (sb *SuperBlock) DropDirIndex(path string, indexInode int32) error {
+	inode := &Inode{}
+	inodeStart := int64(sb.SInodeStart + indexInode*sb.SInodeSize)
+	if err := inode.ReadInode(path, inodeStart); err != nil {
+		return err
+	}
+
+	if inode.IIndex == -1 {
+		return nil
+	}
+
+	blocks, err := sb.dirIndexBlocks(path, inode.IIndex)
+	if err != nil {
+		blocks = nil
+	}
+
+	for _, blockIndex := range blocks {
+		if err := sb.FreeBlock(path, blockIndex); err != nil {
+			return err
+		}
+	}
+
+	inode.IIndex = -1
+	return inode.WriteInode(path, inodeStart, inodeStart+int64(sb.SInodeSize))
+}
+
+// dirIndexBlocks returns the root and every index block of the index rooted at root,
+// it fails on pointers out of range or chains that loop
+func (sb *SuperBlock) dirIndexBlocks(path string, root int32) ([]int32, error) {
+	if root < 0 || root >= sb.BlockCapacity() {
+		return nil, fmt.Errorf("bad index root %d", root)
+	}
+
+	heads := sb.NewPointerBlock()
+	if err := heads.ReadPointerBlock(path, int64(sb.SBlockStart+root*sb.SBlockSize)); err != nil {
+		return nil, err
+	}
+
+	blocks := []int32{root}
+	seen := map[int32]bool{root: true}
+
+	for _, next := range heads.PPointers {
+		for next != -1 {
+			if next < 0 || next >= sb.BlockCapacity() || seen[next] {
+				return nil, fmt.Errorf("bad index block %d", next)
+			}
+			seen[next] = true
+			blocks = append(blocks, next)
+
+			block := sb.NewIndexBlock()
+			if err := block.ReadIndexBlock(path, int64(sb.SBlockStart+next*sb.SBlockSize)); err != nil {
+				return nil, err
+			}
+			next = block.next()
+		}
+	}
+
+	return blocks, nil
+}
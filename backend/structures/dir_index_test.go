@@ -0,0 +1,81 @@
+package structures
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDirIndexLookupAfterRemoval(t *testing.T) {
+	opts := DefaultFormatOptions()
+	opts.Features |= FeatureDirIndex
+	path, sb := formatDisk(t, 400*1024, opts)
+
+	const files = 40
+	for i := 0; i < files; i++ {
+		createFile(t, sb, path, fmt.Sprintf("/big/f%d", i), "", root)
+	}
+
+	_, folder := readInode(t, sb, path, "/big")
+	if folder.IIndex == -1 {
+		t.Fatalf("folder with %d entries has no index", files)
+	}
+
+	// remove every other name, the rest must still be found through the index
+	for i := 0; i < files; i += 2 {
+		if err := sb.RemovePath(path, SplitPath(fmt.Sprintf("/big/f%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, folder = readInode(t, sb, path, "/big")
+	if folder.IIndex == -1 {
+		t.Fatalf("index was dropped by removing entries")
+	}
+
+	// scanning the folder blocks gives the answer the index must give
+	scan := *folder
+	scan.IIndex = -1
+
+	for i := 0; i < files; i++ {
+		name := fmt.Sprintf("f%d", i)
+		want := sb.findInodeInBlock(path, name, &scan)
+		if got := sb.lookupDirIndex(path, folder.IIndex, name); got != want {
+			t.Errorf("index lookup of %s returns %d, want %d", name, got, want)
+		}
+		if removed := i%2 == 0; removed != (want == -1) {
+			t.Errorf("%s found at inode %d after removing every other name", name, want)
+		}
+	}
+
+	// a removed hash leaves no entry behind
+	blocks, err := sb.dirIndexBlocks(path, folder.IIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, blockIndex := range blocks[1:] {
+		block := sb.NewIndexBlock()
+		if err := block.ReadIndexBlock(path, int64(sb.SBlockStart+blockIndex*sb.SBlockSize)); err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range block.IEntries[:len(block.IEntries)-1] {
+			for i := 0; i < files; i += 2 {
+				if entry.IBlock != -1 && entry.IHash == nameHash(fmt.Sprintf("f%d", i)) {
+					t.Errorf("index still has the hash of removed f%d", i)
+				}
+			}
+		}
+	}
+
+	// names added after the removals reuse the freed slots
+	for i := 0; i < files; i += 2 {
+		createFile(t, sb, path, fmt.Sprintf("/big/g%d", i), "", root)
+	}
+	for i := 0; i < files; i += 2 {
+		name := fmt.Sprintf("g%d", i)
+		if sb.lookupDirIndex(path, folder.IIndex, name) == -1 {
+			t.Errorf("index lookup of new %s fails", name)
+		}
+	}
+
+	checkClean(t, sb, path)
+}
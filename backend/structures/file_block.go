@@ -3,23 +3,36 @@ package structures
 import (
 	"backend/utils"
 	"fmt"
+	"html"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type FileBlock struct {
-	BContent [64]byte
-	// Total size of the FileBlock is 64 bytes
+	BContent []byte
+	sb       *SuperBlock // copies the block for snapshots that share it
+	// Total size of the FileBlock is SBlockSize bytes
+}
+
+// NewFileBlock returns an empty file block sized for this filesystem
+func (sb *SuperBlock) NewFileBlock() *FileBlock {
+	return &FileBlock{BContent: make([]byte, sb.SBlockSize), sb: sb}
 }
 
 func (f *FileBlock) WriteFileBlock(path string, offset int64, maxSize int64) error {
-	if err := utils.WriteToFile(path, offset, maxSize, f); err != nil {
+	if err := f.sb.copyOnWrite(path, offset); err != nil {
+		return err
+	}
+
+	if err := utils.WriteToFile(path, offset, maxSize, f.BContent); err != nil {
 		return err
 	}
 	return nil
 }
 
 func (f *FileBlock) ReadFileBlock(path string, offset int64) error {
-	if err := utils.ReadFromFile(path, offset, f); err != nil {
+	if err := utils.ReadFromFile(path, offset, f.BContent); err != nil {
 		return err
 	}
 	return nil
@@ -33,8 +46,20 @@ func (f *FileBlock) Print() {
 func (f *FileBlock) GetStringBuilder(nodeName string) string {
 	var sb strings.Builder
 
-	content := strings.ReplaceAll(string(f.BContent[:]), "\x00", "")
-	content2 := strings.ReplaceAll(content, "\n", "<br/>")
+	// compressed and binary content is shown with its unprintable bytes as dots so the
+	// label stays valid
+	content := strings.Map(func(r rune) rune {
+		switch {
+		case r == 0:
+			return -1
+		case r == '\n':
+			return r
+		case r == utf8.RuneError || !unicode.IsPrint(r):
+			return '.'
+		}
+		return r
+	}, string(f.BContent[:]))
+	content2 := strings.ReplaceAll(html.EscapeString(content), "\n", "<br/>")
 
 	sb.WriteString(fmt.Sprintf("    %s [label=<\n", nodeName))
 	sb.WriteString(fmt.Sprintf("    <TABLE BORDER=\"0\" CELLBORDER=\"1\" CELLSPACING=\"0\">\n"))
@@ -0,0 +1,204 @@
+package structures
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Logical block n of a file lives in IBlock[n] for the first 12 blocks, then below the
+// simple, double and triple indirect pointer blocks in IBlock[12], IBlock[13] and IBlock[14].
+// A -1 pointer inside ISize is a hole and reads as zeros
+
+// blockPath returns the IBlock slot holding logical block n and the pointer index to
+// follow in every pointer block below it, one index per level
+func (sb *SuperBlock) blockPath(n int32) (int, []int32, error) {
+	if n < 12 {
+		return int(n), nil, nil
+	}
+
+	per := int64(sb.SBlockSize / 4)
+	rest := int64(n - 12)
+	span := per
+
+	for level := 0; level < 3; level++ {
+		if rest < span {
+			indexes := make([]int32, level+1)
+			for i := level; i >= 0; i-- {
+				indexes[i] = int32(rest % per)
+				rest /= per
+			}
+			return 12 + level, indexes, nil
+		}
+
+		rest -= span
+		span *= per
+	}
+
+	return 0, nil, fmt.Errorf("file too large: block %d is past the triple indirect block", n)
+}
+
+// fileBlock returns the data block holding logical block n of inode, or -1 for a hole.
+// With allocate the missing pointer blocks and the data block are created, the caller
+// writes the inode
+func (sb *SuperBlock) fileBlock(path string, inode *Inode, n int32, allocate bool) (int32, error) {
+	slot, indexes, err := sb.blockPath(n)
+	if err != nil {
+		return -1, err
+	}
+
+	if inode.IBlock[slot] == -1 {
+		if !allocate {
+			return -1, nil
+		}
+
+		inode.IBlock[slot], err = sb.allocateFileBlock(path, len(indexes) > 0)
+		if err != nil {
+			inode.IBlock[slot] = -1
+			return -1, err
+		}
+	}
+
+	current := inode.IBlock[slot]
+	for depth, i := range indexes {
+		block := sb.NewPointerBlock()
+		blockStart := int64(sb.SBlockStart + current*sb.SBlockSize)
+		if err := block.ReadPointerBlock(path, blockStart); err != nil {
+			return -1, err
+		}
+
+		if block.PPointers[i] == -1 {
+			if !allocate {
+				return -1, nil
+			}
+
+			next, err := sb.allocateFileBlock(path, depth < len(indexes)-1)
+			if err != nil {
+				return -1, err
+			}
+
+			block.PPointers[i] = next
+			if err := block.WritePointerBlock(path, blockStart, blockStart+int64(sb.SBlockSize)); err != nil {
+				return -1, err
+			}
+		}
+
+		current = block.PPointers[i]
+	}
+
+	return current, nil
+}
+
+// allocateFileBlock allocates an empty pointer block or a zeroed file block
+func (sb *SuperBlock) allocateFileBlock(path string, pointer bool) (int32, error) {
+	if err := sb.CheckFreeBlocks(1); err != nil {
+		return -1, err
+	}
+
+	index := sb.NextBlockIndex()
+	blockStart := int64(sb.SFirstBlo)
+
+	var err error
+	if pointer {
+		err = sb.NewPointerBlock().WritePointerBlock(path, blockStart, blockStart+int64(sb.SBlockSize))
+	} else {
+		err = sb.NewFileBlock().WriteFileBlock(path, blockStart, blockStart+int64(sb.SBlockSize))
+	}
+	if err != nil {
+		return -1, err
+	}
+
+	if err := sb.UpdateBitmapBlock(path); err != nil {
+		return -1, err
+	}
+
+	return index, nil
+}
+
+// forEachFileBlock calls fn with every allocated data block of inode in logical order
+func (sb *SuperBlock) forEachFileBlock(path string, inode *Inode, fn func(logical, blockIndex int32)) {
+	for i, blockIndex := range inode.IBlock[:12] {
+		if blockIndex != -1 {
+			fn(int32(i), blockIndex)
+		}
+	}
+
+	per := int64(sb.SBlockSize / 4)
+	base := int64(12)
+	span := per
+
+	for level, blockIndex := range inode.IBlock[12:] {
+		if blockIndex != -1 {
+			sb.forEachPointerBlock(path, blockIndex, level, base, span/per, fn)
+		}
+
+		base += span
+		span *= per
+	}
+}
+
+// forEachPointerBlock walks a pointer block whose first data block is logical block base,
+// every pointer covers childSpan logical blocks. Level 0 points to data blocks
+func (sb *SuperBlock) forEachPointerBlock(path string, blockIndex int32, level int, base, childSpan int64, fn func(logical, blockIndex int32)) {
+	block := sb.NewPointerBlock()
+	if err := block.ReadPointerBlock(path, int64(sb.SBlockStart+blockIndex*sb.SBlockSize)); err != nil {
+		return
+	}
+
+	per := int64(len(block.PPointers))
+	for i, pointer := range block.PPointers {
+		if pointer == -1 {
+			continue
+		}
+
+		logical := base + int64(i)*childSpan
+		if level == 0 {
+			fn(int32(logical), pointer)
+		} else {
+			sb.forEachPointerBlock(path, pointer, level-1, logical, childSpan/per, fn)
+		}
+	}
+}
+
+// ExtendFile grows the file at filePath to size bytes without allocating blocks,
+// the new bytes are a hole that reads as zeros until something is written there
+func (sb *SuperBlock) ExtendFile(path string, filePath []string, size int32) error {
+	index := sb.getInodeReference(path, 0, filePath)
+	if index == -1 {
+		return fmt.Errorf("path not found: /%s", strings.Join(filePath, "/"))
+	}
+
+	inode := &Inode{}
+	inodeStart := int64(sb.SInodeStart + index*sb.SInodeSize)
+	if err := inode.ReadInode(path, inodeStart); err != nil {
+		return err
+	}
+
+	if inode.IType != '1' {
+		return fmt.Errorf("not a file: /%s", strings.Join(filePath, "/"))
+	}
+	defer sb.chargeTo(inode.IuId, inode.IGid)()
+
+	if _, _, err := sb.blockPath(max(size-1, 0) / sb.SBlockSize); err != nil {
+		return err
+	}
+
+	if size < inode.ISize {
+		return fmt.Errorf("file /%s is already %d bytes", strings.Join(filePath, "/"), inode.ISize)
+	}
+
+	// a compressed file stores the zeros in its stream
+	if inode.IsCompressed() {
+		_, err := sb.compressedWrite(path, inode, index, int(size), "")
+		return err
+	}
+
+	if inode.IsInline() && size > InlineDataSize {
+		if err := sb.expandInline(path, inode, index); err != nil {
+			return err
+		}
+	}
+
+	inode.ISize = size
+	inode.IMTime = Timestamp()
+	return inode.WriteInode(path, inodeStart, inodeStart+int64(sb.SInodeSize))
+}
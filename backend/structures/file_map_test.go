@@ -0,0 +1,45 @@
+package structures
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSparseReads(t *testing.T) {
+	path, sb := formatDisk(t, 200*1024, DefaultFormatOptions())
+	blockSize := int(sb.SBlockSize)
+
+	createFile(t, sb, path, "/sparse.txt", "head", root)
+	if err := sb.ExtendFile(path, SplitPath("/sparse.txt"), int32(20*blockSize)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "head" + strings.Repeat("\x00", 20*blockSize-4)
+	if content := sb.GetFile(path, 0, SplitPath("/sparse.txt")); content != want {
+		t.Errorf("extended file reads %d bytes %q..., want %d bytes", len(content), content[:min(len(content), 8)], len(want))
+	}
+	if _, inode := readInode(t, sb, path, "/sparse.txt"); sb.InodeBlockCount(path, inode) != 1 {
+		t.Errorf("extending allocated blocks, the file has %d", sb.InodeBlockCount(path, inode))
+	}
+
+	// a write in the middle of the hole only allocates the block it touches, behind the
+	// indirect pointer block
+	index, inode := readInode(t, sb, path, "/sparse.txt")
+	if _, err := sb.writeFileAt(path, inode, index, 15*blockSize, "tail"); err != nil {
+		t.Fatal(err)
+	}
+
+	want = want[:15*blockSize] + "tail" + want[15*blockSize+4:]
+	if content := sb.GetFile(path, 0, SplitPath("/sparse.txt")); content != want {
+		t.Errorf("file reads %q around the write, want %q", content[15*blockSize-2:15*blockSize+6], want[15*blockSize-2:15*blockSize+6])
+	}
+	if _, inode := readInode(t, sb, path, "/sparse.txt"); sb.InodeBlockCount(path, inode) != 3 {
+		t.Errorf("file has %d blocks after writing into the hole, want 3", sb.InodeBlockCount(path, inode))
+	}
+
+	if err := sb.ExtendFile(path, SplitPath("/sparse.txt"), int32(blockSize)); err == nil {
+		t.Errorf("extending the file to a smaller size did not fail")
+	}
+
+	checkClean(t, sb, path)
+}
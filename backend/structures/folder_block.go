@@ -2,13 +2,15 @@ package structures
 
 import (
 	"backend/utils"
+	"encoding/binary"
 	"fmt"
 	"strings"
 )
 
 type FolderBlock struct {
-	BContent [4]FolderContent
-	// Total size of the FolderBlock is 64 bytes
+	BContent []FolderContent
+	sb       *SuperBlock // locates the checksum table
+	// Total size of the FolderBlock is SBlockSize bytes, SBlockSize/16 entries
 }
 
 type FolderContent struct {
@@ -17,27 +19,37 @@ type FolderContent struct {
 	// Total size of the FolderContent is 16 bytes
 }
 
+// NewFolderBlock returns a folder block sized for this filesystem with "." and ".." set to 0
+func (sb *SuperBlock) NewFolderBlock() *FolderBlock {
+	block := &FolderBlock{BContent: make([]FolderContent, sb.SBlockSize/int32(binary.Size(FolderContent{}))), sb: sb}
+	block.DefaultValue()
+	return block
+}
+
 func (f *FolderBlock) DefaultValue() {
-	f.BContent = [4]FolderContent{
-		{BName: [12]byte{'.'}, BInode: 0},
-		{BName: [12]byte{'.', '.'}, BInode: 0},
-		{BName: [12]byte{'-'}, BInode: -1},
-		{BName: [12]byte{'-'}, BInode: -1},
+	f.BContent[0] = FolderContent{BName: [12]byte{'.'}, BInode: 0}
+	f.BContent[1] = FolderContent{BName: [12]byte{'.', '.'}, BInode: 0}
+	for i := 2; i < len(f.BContent); i++ {
+		f.BContent[i] = FolderContent{BName: [12]byte{'-'}, BInode: -1}
 	}
 }
 
 func (f *FolderBlock) WriteFolderBlock(path string, offset int64, maxSize int64) error {
-	if err := utils.WriteToFile(path, offset, maxSize, f); err != nil {
+	if err := f.sb.copyOnWrite(path, offset); err != nil {
+		return err
+	}
+
+	if err := utils.WriteToFile(path, offset, maxSize, f.BContent); err != nil {
 		return err
 	}
-	return nil
+	return f.sb.writeBlockChecksum(path, offset, f.BContent)
 }
 
 func (f *FolderBlock) ReadFolderBlock(path string, offset int64) error {
-	if err := utils.ReadFromFile(path, offset, f); err != nil {
+	if err := utils.ReadFromFile(path, offset, f.BContent); err != nil {
 		return err
 	}
-	return nil
+	return f.sb.verifyBlockChecksum(path, offset, "folder block", f.BContent)
 }
 
 func (f *FolderBlock) Print() {
@@ -56,12 +68,10 @@ func (f *FolderContent) Print(i int) {
 func (f *FolderBlock) GetStringBuilder(nodeName string) string {
 	var sb strings.Builder
 
-	if f.BContent[2].BInode != -1 {
-		sb.WriteString(fmt.Sprintf("%s -> Inodo_%d\n", nodeName, f.BContent[2].BInode))
-		//nodeName -> Inodo_(BINODE[2])
-	}
-	if f.BContent[3].BInode != -1 {
-		sb.WriteString(fmt.Sprintf("%s -> Inodo_%d\n", nodeName, f.BContent[3].BInode))
+	for _, entry := range f.BContent[2:] {
+		if entry.BInode != -1 {
+			sb.WriteString(fmt.Sprintf("%s -> Inodo_%d\n", nodeName, entry.BInode))
+		}
 	}
 	sb.WriteString(fmt.Sprintf("    %s [label=<\n", nodeName))
 	sb.WriteString(fmt.Sprintf("    <TABLE BORDER=\"0\" CELLBORDER=\"1\" CELLSPACING=\"0\">\n"))
@@ -80,7 +90,12 @@ func (f *FolderBlock) GetStringBuilder(nodeName string) string {
 func (f *FolderContent) GetStringBuilder() string {
 	var sb strings.Builder
 
-	sb.WriteString(fmt.Sprintf("\t<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">%s</TD><TD WIDTH=\"150\" BGCOLOR=\"%s\">%d</TD></TR>\n", "#DDDDDD", strings.TrimRight(string(f.BName[:]), "\x00"), "#DDDDDD", f.BInode))
+	name := strings.TrimRight(string(f.BName[:]), "\x00")
+	if f.IsLongName() {
+		name = fmt.Sprintf("long name (%d bytes, block %d)", f.BName[1], f.nameBlockStart())
+	}
+
+	sb.WriteString(fmt.Sprintf("\t<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">%s</TD><TD WIDTH=\"150\" BGCOLOR=\"%s\">%d</TD></TR>\n", "#DDDDDD", name, "#DDDDDD", f.BInode))
 
 	return sb.String()
 }
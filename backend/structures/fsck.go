@@ -0,0 +1,580 @@
+package structures
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FsckReport lists the problems found by CheckFilesystem
+type FsckReport struct {
+	Problems []string
+	Repaired bool
+}
+
+// fsChecker keeps the state of a consistency check walk
+type fsChecker struct {
+	sb       *SuperBlock
+	path     string
+	repair   bool
+	inodes   map[int32]bool
+	blocks   map[int32]bool
+	links    map[int32]int32
+	corrupt  map[int64]bool // offsets already reported with a checksum mismatch
+	problems []string
+}
+
+// CheckFilesystem walks the tree from root inode 0 and compares what is reachable with the
+// bitmaps and the superblock counters, when repair is true the problems are fixed and orphan
+// inodes are moved to /lost+found. The caller must write the superblock afterwards
+func (sb *SuperBlock) CheckFilesystem(path string, repair bool) (*FsckReport, error) {
+	checker := &fsChecker{
+		sb:      sb,
+		path:    path,
+		repair:  repair,
+		inodes:  make(map[int32]bool),
+		blocks:  make(map[int32]bool),
+		links:   make(map[int32]int32),
+		corrupt: make(map[int64]bool),
+	}
+
+	if err := checker.walkInode(0, "/"); err != nil {
+		return nil, err
+	}
+
+	inodeBitmap, err := sb.ReadInodeBitmap(path)
+	if err != nil {
+		return nil, err
+	}
+
+	blockBitmap, err := sb.ReadBlockBitmap(path)
+	if err != nil {
+		return nil, err
+	}
+
+	orphans, err := checker.findOrphanInodes(inodeBitmap)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, orphan := range orphans {
+		if err := checker.walkInode(orphan, fmt.Sprintf("orphan inode %d", orphan)); err != nil {
+			return nil, err
+		}
+	}
+
+	// orphans get their entry in /lost+found when repairing
+	for _, orphan := range orphans {
+		checker.links[orphan]++
+	}
+
+	if err := checker.checkLinkCounts(); err != nil {
+		return nil, err
+	}
+
+	checker.compareBitmaps(inodeBitmap, blockBitmap)
+
+	if !repair {
+		return &FsckReport{Problems: checker.problems}, nil
+	}
+
+	if err := checker.rewriteBitmaps(); err != nil {
+		return nil, err
+	}
+
+	if err := checker.moveToLostFound(orphans); err != nil {
+		return nil, err
+	}
+
+	return &FsckReport{Problems: checker.problems, Repaired: true}, nil
+}
+
+func (c *fsChecker) report(format string, args ...interface{}) {
+	c.problems = append(c.problems, fmt.Sprintf(format, args...))
+}
+
+func (c *fsChecker) validInode(index int32) bool {
+	return index >= 0 && index < c.sb.InodeCapacity()
+}
+
+func (c *fsChecker) validBlock(index int32) bool {
+	return index >= 0 && index < c.sb.BlockCapacity()
+}
+
+func validInodeType(inodeType byte) bool {
+	return inodeType == '0' || inodeType == '1' || inodeType == '2'
+}
+
+// corrupted reports a checksum mismatch once per structure and tells the caller to keep
+// going with the decoded data, any other error is returned as is
+func (c *fsChecker) corrupted(err error) (bool, error) {
+	var corruption *CorruptionError
+	if !errors.As(err, &corruption) {
+		return false, err
+	}
+
+	if !c.corrupt[corruption.Offset] {
+		c.corrupt[corruption.Offset] = true
+		c.report("%v", corruption)
+	}
+	return true, nil
+}
+
+// readInode reads an inode, a corrupted inode is reported and rewritten with a fresh
+// checksum when repairing so the rest of the walk validates its fields
+func (c *fsChecker) readInode(index int32) (*Inode, error) {
+	inode := &Inode{}
+	if err := inode.ReadInode(c.path, int64(c.sb.SInodeStart+index*c.sb.SInodeSize)); err != nil {
+		corrupt, err := c.corrupted(err)
+		if !corrupt {
+			return nil, err
+		}
+
+		if c.repair {
+			if err := c.writeInode(index, inode); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return inode, nil
+}
+
+func (c *fsChecker) writeInode(index int32, inode *Inode) error {
+	inodeStart := int64(c.sb.SInodeStart + index*c.sb.SInodeSize)
+	return inode.WriteInode(c.path, inodeStart, inodeStart+int64(c.sb.SInodeSize))
+}
+
+// claimBlock validates a block pointer and marks it as referenced, it returns false
+// when the pointer must be dropped (bad or already referenced)
+func (c *fsChecker) claimBlock(index int32, owner string) bool {
+	if !c.validBlock(index) {
+		c.report("%s: bad block pointer %d", owner, index)
+		return false
+	}
+
+	if c.blocks[index] {
+		c.report("%s: block %d is referenced more than once", owner, index)
+		return false
+	}
+
+	c.blocks[index] = true
+	return true
+}
+
+// walkInode marks an inode and everything reachable from it
+func (c *fsChecker) walkInode(index int32, name string) error {
+	if c.inodes[index] {
+		return nil
+	}
+	c.inodes[index] = true
+
+	inode, err := c.readInode(index)
+	if err != nil {
+		return err
+	}
+
+	isFolder := inode.IType == '0'
+	owner := fmt.Sprintf("inode %d (%s)", index, name)
+	changed := false
+
+	if inode.IsInline() && isFolder {
+		c.report("%s: folder marked as inline", owner)
+		inode.IFlags &^= InodeInline
+		changed = true
+	}
+
+	if inode.IsCompressed() && (inode.IType != '1' || inode.IsInline()) {
+		c.report("%s: compressed flag on a folder, link or inline file", owner)
+		inode.IFlags &^= InodeCompressed
+		changed = true
+	}
+
+	if inode.IsInline() && inode.ISize > InlineDataSize {
+		c.report("%s: inline size %d is over the limit of %d bytes", owner, inode.ISize, InlineDataSize)
+		inode.ISize = InlineDataSize
+		changed = true
+	}
+
+	for i, blockIndex := range inode.IBlock {
+		// the IBlock area of an inline file is its content
+		if blockIndex == -1 || inode.IsInline() {
+			continue
+		}
+
+		if !c.claimBlock(blockIndex, owner) {
+			inode.IBlock[i] = -1
+			changed = true
+			continue
+		}
+
+		if i < 12 {
+			if isFolder {
+				if err := c.walkFolderBlock(blockIndex, name); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if err := c.walkPointerBlock(blockIndex, int32(i-11), isFolder, name); err != nil {
+			return err
+		}
+	}
+
+	if inode.IIndex != -1 && !c.claimDirIndex(inode, owner) {
+		inode.IIndex = -1
+		changed = true
+	}
+
+	if inode.IXattr != -1 && !c.claimBlock(inode.IXattr, owner+" attributes") {
+		inode.IXattr = -1
+		changed = true
+	}
+
+	if changed && c.repair {
+		return c.writeInode(index, inode)
+	}
+
+	return nil
+}
+
+// claimDirIndex marks the blocks of a folder index, it returns false when the index
+// must be dropped because it is damaged, belongs to a file or names a block that is
+// not a folder block of the inode
+func (c *fsChecker) claimDirIndex(inode *Inode, owner string) bool {
+	if inode.IType != '0' {
+		c.report("%s: directory index on a file", owner)
+		return false
+	}
+
+	blocks, err := c.sb.dirIndexBlocks(c.path, inode.IIndex)
+	if err == nil {
+		err = c.checkDirIndexEntries(inode, blocks)
+	}
+
+	if err != nil {
+		c.report("%s: damaged directory index: %v", owner, err)
+		return false
+	}
+
+	for _, blockIndex := range blocks {
+		c.blocks[blockIndex] = true
+	}
+
+	return true
+}
+
+// checkDirIndexEntries verifies that the index blocks are not shared and only point to
+// folder blocks of inode, blocks[0] is the root of the index
+func (c *fsChecker) checkDirIndexEntries(inode *Inode, blocks []int32) error {
+	folderBlocks := make(map[int32]bool)
+	for _, blockIndex := range c.sb.FolderBlocks(c.path, inode) {
+		folderBlocks[blockIndex] = true
+	}
+
+	for i, blockIndex := range blocks {
+		if c.blocks[blockIndex] {
+			return fmt.Errorf("block %d is referenced more than once", blockIndex)
+		}
+
+		if i == 0 {
+			continue
+		}
+
+		block := c.sb.NewIndexBlock()
+		if err := block.ReadIndexBlock(c.path, int64(c.sb.SBlockStart+blockIndex*c.sb.SBlockSize)); err != nil {
+			return err
+		}
+
+		for _, entry := range block.IEntries[:len(block.IEntries)-1] {
+			if entry.IBlock != -1 && !folderBlocks[entry.IBlock] {
+				return fmt.Errorf("index block %d points to block %d outside the folder", blockIndex, entry.IBlock)
+			}
+		}
+	}
+
+	return nil
+}
+
+// walkPointerBlock marks the blocks referenced by a pointer block, level 1 points to data blocks
+func (c *fsChecker) walkPointerBlock(blockIndex, level int32, isFolder bool, name string) error {
+	block := c.sb.NewPointerBlock()
+	blockStart := int64(c.sb.SBlockStart + blockIndex*c.sb.SBlockSize)
+
+	changed, err := c.corrupted(block.ReadPointerBlock(c.path, blockStart))
+	if err != nil {
+		return err
+	}
+
+	owner := fmt.Sprintf("pointer block %d (%s)", blockIndex, name)
+
+	for i, pointer := range block.PPointers {
+		if pointer == -1 {
+			continue
+		}
+
+		if !c.claimBlock(pointer, owner) {
+			block.PPointers[i] = -1
+			changed = true
+			continue
+		}
+
+		if level > 1 {
+			if err := c.walkPointerBlock(pointer, level-1, isFolder, name); err != nil {
+				return err
+			}
+		} else if isFolder {
+			if err := c.walkFolderBlock(pointer, name); err != nil {
+				return err
+			}
+		}
+	}
+
+	if changed && c.repair {
+		return block.WritePointerBlock(c.path, blockStart, blockStart+int64(c.sb.SBlockSize))
+	}
+
+	return nil
+}
+
+// walkFolderBlock validates the entries of a folder block and walks the inodes they point to
+func (c *fsChecker) walkFolderBlock(blockIndex int32, name string) error {
+	block := c.sb.NewFolderBlock()
+	blockStart := int64(c.sb.SBlockStart + blockIndex*c.sb.SBlockSize)
+
+	changed, err := c.corrupted(block.ReadFolderBlock(c.path, blockStart))
+	if err != nil {
+		return err
+	}
+
+	for i := 2; i < len(block.BContent); i++ {
+		entry := block.BContent[i]
+		if entry.BInode == -1 {
+			continue
+		}
+
+		entryName := c.sb.EntryName(c.path, entry)
+		childPath := strings.TrimRight(name, "/") + "/" + entryName
+
+		valid := c.validInode(entry.BInode)
+		if valid {
+			child, err := c.readInode(entry.BInode)
+			if err != nil {
+				return err
+			}
+			valid = validInodeType(child.IType)
+		}
+
+		if !valid {
+			c.report("folder block %d: entry %s points to invalid inode %d", blockIndex, childPath, entry.BInode)
+			block.BContent[i] = FolderContent{BName: [12]byte{'-'}, BInode: -1}
+			changed = true
+			continue
+		}
+
+		if entry.IsLongName() && !c.claimNameBlocks(entry, childPath) {
+			c.report("folder block %d: entry %s has a damaged long name", blockIndex, childPath)
+			block.BContent[i] = FolderContent{BName: [12]byte{'-'}, BInode: -1}
+			changed = true
+			continue
+		}
+
+		c.links[entry.BInode]++
+		if err := c.walkInode(entry.BInode, childPath); err != nil {
+			return err
+		}
+	}
+
+	if changed && c.repair {
+		return block.WriteFolderBlock(c.path, blockStart, blockStart+int64(c.sb.SBlockSize))
+	}
+
+	return nil
+}
+
+// claimNameBlocks marks the name blocks of a long name entry, it returns false when
+// the chain is incomplete or the filesystem does not support long names
+func (c *fsChecker) claimNameBlocks(entry FolderContent, name string) bool {
+	if !c.sb.HasFeature(FeatureLongNames) {
+		return false
+	}
+
+	blocks := c.sb.nameBlocks(c.path, entry)
+	if len(blocks) != (int(entry.BName[1])+c.sb.nameChunk()-1)/c.sb.nameChunk() {
+		return false
+	}
+
+	for _, blockIndex := range blocks {
+		if !c.claimBlock(blockIndex, "name of "+name) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkLinkCounts compares the link count of every reachable file with the entries pointing to it,
+// folders can not be hard linked so their count is not tracked
+func (c *fsChecker) checkLinkCounts() error {
+	var indexes []int32
+	for index := range c.inodes {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+	for _, index := range indexes {
+		inode, err := c.readInode(index)
+		if err != nil {
+			return err
+		}
+
+		if inode.IType == '0' || inode.ILinks == c.links[index] {
+			continue
+		}
+
+		c.report("inode %d: link count is %d but %d entries point to it", index, inode.ILinks, c.links[index])
+		if c.repair {
+			inode.ILinks = c.links[index]
+			if err := c.writeInode(index, inode); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// findOrphanInodes returns the used but unreachable inodes that are not referenced by
+// another orphan folder, those are the roots moved to /lost+found
+func (c *fsChecker) findOrphanInodes(inodeBitmap []byte) ([]int32, error) {
+	var candidates []int32
+	for i, value := range inodeBitmap {
+		index := int32(i)
+		if value != InodeUsed || c.inodes[index] {
+			continue
+		}
+
+		inode, err := c.readInode(index)
+		if err != nil {
+			return nil, err
+		}
+
+		if !validInodeType(inode.IType) {
+			c.report("inode %d is marked as used but has an invalid type", index)
+			continue
+		}
+
+		c.report("inode %d is not reachable from root", index)
+		candidates = append(candidates, index)
+	}
+
+	referenced := make(map[int32]bool)
+	for _, index := range candidates {
+		inode, err := c.readInode(index)
+		if err != nil {
+			return nil, err
+		}
+
+		if inode.IType != '0' {
+			continue
+		}
+
+		for _, entry := range c.sb.GetFolderEntries(c.path, inode) {
+			if entry.BInode != index {
+				referenced[entry.BInode] = true
+			}
+		}
+	}
+
+	var orphans []int32
+	for _, index := range candidates {
+		if !referenced[index] {
+			orphans = append(orphans, index)
+		}
+	}
+
+	return orphans, nil
+}
+
+// compareBitmaps reports differences between the bitmaps, the reachable sets and the counters
+func (c *fsChecker) compareBitmaps(inodeBitmap, blockBitmap []byte) {
+	usedInodes := int32(0)
+	for i, value := range inodeBitmap {
+		if value == InodeUsed {
+			usedInodes++
+		} else if c.inodes[int32(i)] {
+			c.report("inode %d is in use but marked as free", i)
+		}
+	}
+
+	usedBlocks := int32(0)
+	for i, value := range blockBitmap {
+		if value == BlockUsed {
+			usedBlocks++
+			if !c.blocks[int32(i)] {
+				c.report("block %d is marked as used but not referenced", i)
+			}
+		} else if c.blocks[int32(i)] {
+			c.report("block %d is in use but marked as free", i)
+		}
+	}
+
+	if free := c.sb.InodeCapacity() - usedInodes; c.sb.SFreeInodeCount != free {
+		c.report("free inode count is %d, bitmap has %d free inodes", c.sb.SFreeInodeCount, free)
+	}
+
+	if free := c.sb.BlockCapacity() - usedBlocks; c.sb.SFreeBlockCount != free {
+		c.report("free block count is %d, bitmap has %d free blocks", c.sb.SFreeBlockCount, free)
+	}
+}
+
+// rewriteBitmaps writes both bitmaps from the reachable sets and updates the counters
+func (c *fsChecker) rewriteBitmaps() error {
+	inodeBitmap := make([]byte, c.sb.InodeCapacity())
+	for i := range inodeBitmap {
+		inodeBitmap[i] = InodeFree
+	}
+	for index := range c.inodes {
+		inodeBitmap[index] = InodeUsed
+	}
+
+	blockBitmap := make([]byte, c.sb.BlockCapacity())
+	for i := range blockBitmap {
+		blockBitmap[i] = BlockFree
+	}
+	for index := range c.blocks {
+		blockBitmap[index] = BlockUsed
+	}
+
+	return c.sb.ReplaceBitmaps(c.path, inodeBitmap, blockBitmap)
+}
+
+// moveToLostFound links every orphan into /lost+found as #<inode>
+func (c *fsChecker) moveToLostFound(orphans []int32) error {
+	if len(orphans) == 0 {
+		return nil
+	}
+
+	root, err := c.readInode(0)
+	if err != nil {
+		return err
+	}
+
+	lostFound := c.sb.findInodeInBlock(c.path, "lost+found", root)
+	if lostFound == -1 {
+		lostFound = c.sb.NextInodeIndex()
+		if err := c.sb.CreatePath(c.path, "lost+found", root, false, 0, &Credentials{UID: RootUID, GID: 1}); err != nil {
+			return err
+		}
+	}
+
+	for _, orphan := range orphans {
+		if err := c.sb.AddFolderEntry(c.path, lostFound, "#"+strconv.Itoa(int(orphan)), orphan); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package structures
+
+import (
+	"fmt"
+	"testing"
+)
+
+// checkRepaired runs fsck twice, the first run must find problems and repair them and
+// the second must find none
+func checkRepaired(t *testing.T, sb *SuperBlock, path string) {
+	t.Helper()
+
+	report, err := sb.CheckFilesystem(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) == 0 || !report.Repaired {
+		t.Fatalf("fsck found %d problems (repaired %v) on a damaged filesystem", len(report.Problems), report.Repaired)
+	}
+
+	checkClean(t, sb, path)
+}
+
+func TestFsckRepairsBitmapsAndLinkCounts(t *testing.T) {
+	path, sb := formatDisk(t, 200*1024, DefaultFormatOptions())
+
+	createFile(t, sb, path, "/docs/a.txt", "some content that fills more than one block of the file", root)
+	index, inode := readInode(t, sb, path, "/docs/a.txt")
+
+	inodeBitmap, err := sb.ReadInodeBitmap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockBitmap, err := sb.ReadBlockBitmap(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a used block marked free, a free block marked used and a wrong link count
+	blockBitmap[inode.IBlock[0]] = BlockFree
+	blockBitmap[len(blockBitmap)-1] = BlockUsed
+	inodeBitmap[index] = InodeFree
+	if err := sb.ReplaceBitmaps(path, inodeBitmap, blockBitmap); err != nil {
+		t.Fatal(err)
+	}
+
+	inode.ILinks = 3
+	inodeStart := int64(sb.SInodeStart + index*sb.SInodeSize)
+	if err := inode.WriteInode(path, inodeStart, inodeStart+int64(sb.SInodeSize)); err != nil {
+		t.Fatal(err)
+	}
+
+	checkRepaired(t, sb, path)
+
+	if _, inode := readInode(t, sb, path, "/docs/a.txt"); inode.ILinks != 1 {
+		t.Errorf("repaired file has %d links, want 1", inode.ILinks)
+	}
+	if content := sb.GetFile(path, 0, SplitPath("/docs/a.txt")); content != "some content that fills more than one block of the file" {
+		t.Errorf("repaired file has %q", content)
+	}
+}
+
+func TestFsckMovesOrphansToLostFound(t *testing.T) {
+	path, sb := formatDisk(t, 200*1024, DefaultFormatOptions())
+
+	createFile(t, sb, path, "/docs/lost.txt", "still here", root)
+	docs, _ := readInode(t, sb, path, "/docs")
+
+	// drop the entry without releasing the inode
+	orphan, err := sb.removeFolderEntry(path, docs, "lost.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkRepaired(t, sb, path)
+
+	name := fmt.Sprintf("/lost+found/#%d", orphan)
+	if index, _ := readInode(t, sb, path, name); index != orphan {
+		t.Errorf("%s is inode %d, want %d", name, index, orphan)
+	}
+	if content := sb.GetFile(path, 0, SplitPath(name)); content != "still here" {
+		t.Errorf("%s has %q", name, content)
+	}
+}
@@ -0,0 +1,57 @@
+package structures
+
+// inlineWrite writes content at offset in the inode of a file when the result fits in
+// InlineDataSize bytes. New empty files go inline on filesystems formatted with
+// FeatureInlineData, an inline file that outgrows the inode moves to data blocks.
+// It reports whether the write was done
+func (sb *SuperBlock) inlineWrite(path string, inode *Inode, index int32, offset int, content string) (bool, error) {
+	empty := inode.ISize == 0 && !inode.hasBlocks()
+	if !inode.IsInline() && !(empty && sb.HasFeature(FeatureInlineData)) {
+		return false, nil
+	}
+
+	end := offset + len(content)
+	if end > InlineDataSize {
+		if inode.IsInline() {
+			return false, sb.expandInline(path, inode, index)
+		}
+		return false, nil
+	}
+
+	data := inode.InlineData()
+	if len(data) < end {
+		data = append(data, make([]byte, end-len(data))...)
+	}
+	copy(data[offset:], content)
+
+	inode.SetInlineData(data)
+	inode.ISize = max(inode.ISize, int32(end))
+	inode.IMTime = Timestamp()
+
+	inodeStart := int64(sb.SInodeStart + index*sb.SInodeSize)
+	return true, inode.WriteInode(path, inodeStart, inodeStart+int64(sb.SInodeSize))
+}
+
+// expandInline moves the content of an inline file to data blocks
+func (sb *SuperBlock) expandInline(path string, inode *Inode, index int32) error {
+	data := inode.InlineData()
+
+	inode.IFlags &^= InodeInline
+	for i := range inode.IBlock {
+		inode.IBlock[i] = -1
+	}
+	inode.ISize = 0
+
+	_, err := sb.writeFileBlocks(path, inode, index, 0, string(data))
+	return err
+}
+
+// hasBlocks reports whether any IBlock pointer is set
+func (i *Inode) hasBlocks() bool {
+	for _, block := range i.IBlock {
+		if block != -1 {
+			return true
+		}
+	}
+	return false
+}
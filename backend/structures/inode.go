@@ -2,30 +2,54 @@ package structures
 
 import (
 	"backend/utils"
+	"encoding/binary"
 	"fmt"
 	"strings"
 	"time"
 )
 
+// RootUID is the uid of the root user, it bypasses ownership checks
+const RootUID int32 = 1
+
+// InodeInline marks a file whose content is stored in IBlock instead of data blocks
+const InodeInline int32 = 1 << 0
+
+// InodeCompressed marks a file whose data blocks hold its content as a DEFLATE stream
+const InodeCompressed int32 = 1 << 1
+
+// InlineDataSize is the largest file that fits in the IBlock pointer area
+const InlineDataSize = 15 * 4
+
 type Inode struct {
-	IuId   int32
-	IGid   int32
-	ISize  int32
-	IAtime float32
-	ICTime float32
-	IMTime float32
-	IBlock [15]int32
-	IType  byte
-	IPerm  [3]byte
+	IuId      int32
+	IGid      int32
+	ISize     int32
+	IAtime    int64
+	ICTime    int64
+	IMTime    int64
+	IBlock    [15]int32
+	IType     byte
+	IPerm     [3]byte
+	ILinks    int32
+	IIndex    int32 // root of the hashed directory index, -1 when the folder is not indexed
+	IXattr    int32 // block holding the extended attributes, -1 when there are none
+	IFlags    int32 // InodeInline, InodeCompressed
+	IChecksum uint32
+}
+
+// Timestamp returns the current time in nanoseconds, the unit of every on-disk time
+func Timestamp() int64 {
+	return time.Now().UnixNano()
 }
 
 func (i *Inode) DefaultValue(blockCount int32) {
 	i.IuId = 1
 	i.IGid = 1
 	i.ISize = 0
-	i.IAtime = float32(time.Now().Unix())
-	i.ICTime = float32(time.Now().Unix())
-	i.IMTime = float32(time.Now().Unix())
+	now := Timestamp()
+	i.IAtime = now
+	i.ICTime = now
+	i.IMTime = now
 	i.IBlock[0] = blockCount
 	for j := 1; j < 15; j++ {
 		i.IBlock[j] = -1
@@ -34,9 +58,38 @@ func (i *Inode) DefaultValue(blockCount int32) {
 	for j := 0; j < 3; j++ {
 		i.IPerm[j] = '7'
 	}
+	i.ILinks = 1
+	i.IIndex = -1
+	i.IXattr = -1
+	i.IFlags = 0
+}
+
+// IsInline reports whether the content of the file is stored in the inode
+func (i *Inode) IsInline() bool {
+	return i.IFlags&InodeInline != 0
+}
+
+// InlineData returns the content stored in the IBlock area of an inline file
+func (i *Inode) InlineData() []byte {
+	data := make([]byte, 0, InlineDataSize)
+	for _, word := range i.IBlock {
+		data = binary.LittleEndian.AppendUint32(data, uint32(word))
+	}
+	return data[:min(max(i.ISize, 0), InlineDataSize)]
+}
+
+// SetInlineData stores data in the IBlock area and marks the inode inline
+func (i *Inode) SetInlineData(data []byte) {
+	area := make([]byte, InlineDataSize)
+	copy(area, data)
+	for j := range i.IBlock {
+		i.IBlock[j] = int32(binary.LittleEndian.Uint32(area[j*4:]))
+	}
+	i.IFlags |= InodeInline
 }
 
 func (i *Inode) WriteInode(path string, offset int64, maxSize int64) error {
+	i.IChecksum = i.checksum()
 	if err := utils.WriteToFile(path, offset, maxSize, i); err != nil {
 		return err
 	}
@@ -47,6 +100,10 @@ func (i *Inode) ReadInode(path string, offset int64) error {
 	if err := utils.ReadFromFile(path, offset, i); err != nil {
 		return err
 	}
+
+	if i.IChecksum != i.checksum() {
+		return &CorruptionError{Structure: "inode", Offset: offset}
+	}
 	return nil
 }
 
@@ -54,12 +111,17 @@ func (i *Inode) Print() {
 	fmt.Printf("IuId: %d\n", i.IuId)
 	fmt.Printf("IGid: %d\n", i.IGid)
 	fmt.Printf("ISize: %d\n", i.ISize)
-	fmt.Printf("IAtime: %s\n", time.Unix(int64(i.IAtime), 0))
-	fmt.Printf("ICTime: %s\n", time.Unix(int64(i.ICTime), 0))
-	fmt.Printf("IMTime: %s\n", time.Unix(int64(i.IMTime), 0))
+	fmt.Printf("IAtime: %s\n", time.Unix(0, i.IAtime))
+	fmt.Printf("ICTime: %s\n", time.Unix(0, i.ICTime))
+	fmt.Printf("IMTime: %s\n", time.Unix(0, i.IMTime))
 	fmt.Printf("IBlock: %v\n", i.IBlock)
 	fmt.Printf("IType: %c\n", i.IType)
 	fmt.Printf("IPerm: %s\n", string(i.IPerm[:]))
+	fmt.Printf("ILinks: %d\n", i.ILinks)
+	fmt.Printf("IIndex: %d\n", i.IIndex)
+	fmt.Printf("IXattr: %d\n", i.IXattr)
+	fmt.Printf("IFlags: %d\n", i.IFlags)
+	fmt.Printf("IChecksum: %08x\n", i.IChecksum)
 }
 
 func (i *Inode) GetStringBuilder(nodeName string) string {
@@ -75,11 +137,23 @@ func (i *Inode) GetStringBuilder(nodeName string) string {
 	sb.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">IuId</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%d</TD></TR>\n", "#DDDDDD", "#DDDDDD", i.IuId))
 	sb.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">IGid</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%d</TD></TR>\n", "#FFFFFF", "#FFFFFF", i.IGid))
 	sb.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">ISize</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%d</TD></TR>\n", "#DDDDDD", "#DDDDDD", i.ISize))
-	sb.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">IAtime</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%s</TD></TR>\n", "#FFFFFF", "#FFFFFF", time.Unix(int64(i.IAtime), 0).Format("02-Jan-2006 03:04 PM")))
-	sb.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">ICTime</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%s</TD></TR>\n", "#DDDDDD", "#DDDDDD", time.Unix(int64(i.ICTime), 0).Format("02-Jan-2006 03:04 PM")))
-	sb.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">IMTime</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%s</TD></TR>\n", "#FFFFFF", "#FFFFFF", time.Unix(int64(i.IMTime), 0).Format("02-Jan-2006 03:04 PM")))
+	sb.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">IAtime</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%s</TD></TR>\n", "#FFFFFF", "#FFFFFF", time.Unix(0, i.IAtime).Format("02-Jan-2006 03:04 PM")))
+	sb.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">ICTime</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%s</TD></TR>\n", "#DDDDDD", "#DDDDDD", time.Unix(0, i.ICTime).Format("02-Jan-2006 03:04 PM")))
+	sb.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">IMTime</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%s</TD></TR>\n", "#FFFFFF", "#FFFFFF", time.Unix(0, i.IMTime).Format("02-Jan-2006 03:04 PM")))
 	sb.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">IType</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%c</TD></TR>\n", "#DDDDDD", "#DDDDDD", i.IType))
 	sb.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">IPerm</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%s</TD></TR>\n", "#FFFFFF", "#FFFFFF", Perm))
+	sb.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">ILinks</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%d</TD></TR>\n", "#DDDDDD", "#DDDDDD", i.ILinks))
+	sb.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">IIndex</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%d</TD></TR>\n", "#FFFFFF", "#FFFFFF", i.IIndex))
+	sb.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">IXattr</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%d</TD></TR>\n", "#DDDDDD", "#DDDDDD", i.IXattr))
+	sb.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">IFlags</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%d</TD></TR>\n", "#FFFFFF", "#FFFFFF", i.IFlags))
+
+	if i.IsInline() {
+		content := strings.ReplaceAll(strings.ReplaceAll(string(i.InlineData()), "\x00", ""), "\n", "<br/>")
+		sb.WriteString(fmt.Sprintf("\t<TR><TD COLSPAN=\"2\" BGCOLOR=\"%s\"><B>Inline Data</B></TD></TR>\n", "#333333"))
+		sb.WriteString(fmt.Sprintf("<TR><TD COLSPAN=\"2\" BGCOLOR=\"%s\">%s</TD></TR>\n", "#DDDDDD", content))
+		sb.WriteString("    </TABLE>>];\n")
+		return sb.String()
+	}
 
 	sb.WriteString(fmt.Sprintf("\t<TR><TD COLSPAN=\"2\" BGCOLOR=\"%s\"><B>Direct Blocks</B></TD></TR>\n", "#333333"))
 	for j := 0; j < 12; j++ {
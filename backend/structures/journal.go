@@ -0,0 +1,313 @@
+package structures
+
+import (
+	"backend/utils"
+	"encoding/binary"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+)
+
+// JournalExcerptSize is how much of the content of an entry the journaling report shows
+const JournalExcerptSize = 32
+
+// JournalCompress marks the mkfile entry of a file created compressed
+const JournalCompress int32 = 1 << 0
+
+// JournalSparse marks the mkfile entry of a sparse file, ISize is the size of its hole
+const JournalSparse int32 = 1 << 1
+
+// JournalSymbolic marks the ln entry of a symbolic link
+const JournalSymbolic int32 = 1 << 2
+
+// JournalContinued marks a record that holds more content of the entry before it
+const JournalContinued int32 = 1 << 3
+
+type Journal struct {
+	JCount   int32
+	JContent Information
+	// Total size of the Journal is 174 bytes
+}
+
+// Information is the operation of a journal entry. IPathSize and IContentSize are the
+// lengths before IPath and IContent were cut to fit, they tell a truncated entry apart.
+// Content longer than IContent goes on in the continuation records that follow the entry.
+// The options of the command are kept in IFlags and ISize, never in IContent, and IUid and
+// IGid are the credentials recovery replays the entry with
+type Information struct {
+	IOperation   [10]byte
+	IPath        [64]byte
+	IPathSize    int32
+	IContent     [64]byte
+	IContentSize int32
+	IDate        int64
+	IFlags       int32 // JournalCompress, JournalSparse, JournalSymbolic, JournalContinued
+	ISize        int32 // size of the file of a mkfile entry
+	IUid         int32
+	IGid         int32
+	// Total size of the Information is 170 bytes
+}
+
+// JournalEntry is an operation to add to the journal
+type JournalEntry struct {
+	Operation string
+	Path      string
+	Content   string
+	Flags     int32
+	Size      int32
+	Owner     *Credentials // user that ran the operation
+}
+
+func (j *Journal) WriteJournal(path string, offset int64, maxSize int64) error {
+	if err := utils.WriteToFile(path, offset, maxSize, j); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (j *Journal) ReadJournal(path string, offset int64) error {
+	if err := utils.ReadFromFile(path, offset, j); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (j *Journal) GetOperation() string {
+	return strings.TrimRight(string(j.JContent.IOperation[:]), "\x00")
+}
+
+func (j *Journal) GetPath() string {
+	return strings.TrimRight(string(j.JContent.IPath[:]), "\x00")
+}
+
+func (j *Journal) GetContent() string {
+	return strings.TrimRight(string(j.JContent.IContent[:]), "\x00")
+}
+
+// HasFlag reports whether the entry was written with the given option
+func (j *Journal) HasFlag(flag int32) bool {
+	return j.JContent.IFlags&flag != 0
+}
+
+// IsContinuation reports whether the record only holds content of the entry before it
+func (j *Journal) IsContinuation() bool {
+	return j.HasFlag(JournalContinued)
+}
+
+// IsTruncated reports whether the path did not fit in the entry or the content, as read
+// back by JournalContent, is shorter than the content written
+func (j *Journal) IsTruncated(content string) bool {
+	return int(j.JContent.IPathSize) > len(j.GetPath()) || int(j.JContent.IContentSize) > len(content)
+}
+
+// JournalContent returns the content of the entry that starts journals joined with the
+// continuation records that follow it
+func JournalContent(journals []Journal) string {
+	if len(journals) == 0 {
+		return ""
+	}
+
+	var content strings.Builder
+	content.WriteString(journals[0].GetContent())
+	for _, journal := range journals[1:] {
+		if !journal.IsContinuation() {
+			break
+		}
+		content.WriteString(journal.GetContent())
+	}
+
+	return content.String()
+}
+
+func (j *Journal) Print() {
+	fmt.Printf("JCount: %d\n", j.JCount)
+	fmt.Printf("IOperation: %s\n", j.GetOperation())
+	fmt.Printf("IPath: %s\n", j.GetPath())
+	fmt.Printf("IContent: %s\n", j.GetContent())
+	fmt.Printf("IDate: %s\n", time.Unix(0, j.JContent.IDate))
+}
+
+// GetStringBuilder returns the journal entry as a row of the journaling report,
+// the content is cut to JournalExcerptSize characters
+func (j *Journal) GetStringBuilder() string {
+	var sb strings.Builder
+
+	bgColor := "#DDDDDD"
+	if j.JCount%2 == 0 {
+		bgColor = "#FFFFFF"
+	}
+
+	content := j.GetContent()
+	if runes := []rune(content); len(runes) > JournalExcerptSize {
+		content = string(runes[:JournalExcerptSize]) + "..."
+	} else if int(j.JContent.IContentSize) > len(content) {
+		content += "..."
+	}
+
+	cells := []string{
+		fmt.Sprintf("%d", j.JCount),
+		j.GetOperation(),
+		j.GetPath(),
+		content,
+		time.Unix(0, j.JContent.IDate).Format("02-Jan-2006 03:04 PM"),
+	}
+
+	sb.WriteString("\t<TR>")
+	for _, cell := range cells {
+		sb.WriteString(fmt.Sprintf("<TD BGCOLOR=\"%s\">%s</TD>", bgColor, html.EscapeString(cell)))
+	}
+	sb.WriteString("</TR>\n")
+
+	return sb.String()
+}
+
+// IsJournaling returns true when the filesystem is EXT3
+func (sb *SuperBlock) IsJournaling() bool {
+	return sb.SFilesystemType == 3
+}
+
+// journalCount returns the number of entries the journal can hold, one per inode
+func (sb *SuperBlock) journalCount() int32 {
+	return sb.InodeCapacity()
+}
+
+// journalStart returns the offset of the journal, it sits right after the superblock
+func (sb *SuperBlock) journalStart() int32 {
+	return sb.SBMInodeStart - sb.journalCount()*int32(binary.Size(Journal{}))
+}
+
+// CreateJournal zero-fills the journal area of an EXT3 filesystem, the caller must write
+// the superblock afterwards
+func (sb *SuperBlock) CreateJournal(path string) error {
+	if !sb.IsJournaling() {
+		return nil
+	}
+
+	sb.SJournalNext = 0
+	return utils.ZeroFill(path, int64(sb.journalStart()), int64(sb.SBMInodeStart))
+}
+
+// CheckpointJournal empties the journal once the filesystem is known to be consistent,
+// recovery can only replay the entries written after the last checkpoint
+func (sb *SuperBlock) CheckpointJournal(path string) error {
+	if !sb.IsJournaling() {
+		return nil
+	}
+
+	if err := sb.CreateJournal(path); err != nil {
+		return err
+	}
+
+	return sb.writeJournalSuperBlock(path)
+}
+
+// writeJournalSuperBlock writes the superblock, it sits right before the journal
+func (sb *SuperBlock) writeJournalSuperBlock(path string) error {
+	start := int64(sb.journalStart() - sb.Size())
+	return sb.WriteSuperBlock(path, start, start+int64(sb.Size()))
+}
+
+// AddJournal appends an entry to the journal at SJournalNext and writes the superblock,
+// it does nothing on EXT2 filesystems. A path longer than its field is cut and keeps its
+// full length in the entry, content longer than its field is written in continuation
+// records after the entry
+func (sb *SuperBlock) AddJournal(path string, entry JournalEntry) error {
+	if !sb.IsJournaling() {
+		return nil
+	}
+
+	contentSize := int32(len(Information{}.IContent))
+	records := int32(1)
+	if size := int32(len(entry.Content)); size > contentSize {
+		records += (size - 1) / contentSize
+	}
+
+	if sb.SJournalNext+records > sb.journalCount() {
+		return fmt.Errorf("journal is full, run fsck to checkpoint it")
+	}
+
+	journalSize := int32(binary.Size(Journal{}))
+	date := Timestamp()
+
+	for r := int32(0); r < records; r++ {
+		record := entry.Journal()
+		if r > 0 {
+			record = &Journal{}
+			record.JContent.IFlags = JournalContinued
+			chunk := entry.Content[r*contentSize : min(int32(len(entry.Content)), (r+1)*contentSize)]
+			copy(record.JContent.IContent[:], chunk)
+			record.JContent.IContentSize = int32(len(chunk))
+		}
+		record.JCount = sb.SJournalNext + r + 1
+		record.JContent.IDate = date
+
+		offset := int64(sb.journalStart() + (sb.SJournalNext+r)*journalSize)
+		if err := record.WriteJournal(path, offset, offset+int64(journalSize)); err != nil {
+			return err
+		}
+	}
+
+	sb.SJournalNext += records
+	return sb.writeJournalSuperBlock(path)
+}
+
+// Journal returns the first record of the entry, its content is cut to the field
+func (entry JournalEntry) Journal() *Journal {
+	journal := &Journal{}
+	copy(journal.JContent.IOperation[:], entry.Operation)
+	copy(journal.JContent.IPath[:], entry.Path)
+	journal.JContent.IPathSize = int32(len(entry.Path))
+	copy(journal.JContent.IContent[:], entry.Content)
+	journal.JContent.IContentSize = int32(len(entry.Content))
+	journal.JContent.IFlags = entry.Flags
+	journal.JContent.ISize = entry.Size
+	if entry.Owner != nil {
+		journal.JContent.IUid = entry.Owner.UID
+		journal.JContent.IGid = entry.Owner.GID
+	}
+
+	return journal
+}
+
+// GetJournals returns every entry written since the last checkpoint in order
+func (sb *SuperBlock) GetJournals(path string) ([]Journal, error) {
+	if !sb.IsJournaling() {
+		return nil, fmt.Errorf("filesystem is not EXT3")
+	}
+
+	journalSize := int32(binary.Size(Journal{}))
+	var journals []Journal
+
+	for i := int32(0); i < sb.SJournalNext; i++ {
+		journal := Journal{}
+		if err := journal.ReadJournal(path, int64(sb.journalStart()+i*journalSize)); err != nil {
+			return nil, err
+		}
+
+		if journal.JCount == 0 {
+			break
+		}
+		journals = append(journals, journal)
+	}
+
+	return journals, nil
+}
+
+// WriteJournals replaces the journal with the given entries and writes the superblock
+func (sb *SuperBlock) WriteJournals(path string, journals []Journal) error {
+	if err := sb.CreateJournal(path); err != nil {
+		return err
+	}
+
+	journalSize := int32(binary.Size(Journal{}))
+	for i, journal := range journals {
+		offset := int64(sb.journalStart() + int32(i)*journalSize)
+		if err := journal.WriteJournal(path, offset, offset+int64(journalSize)); err != nil {
+			return err
+		}
+	}
+
+	sb.SJournalNext = int32(len(journals))
+	return sb.writeJournalSuperBlock(path)
+}
@@ -0,0 +1,176 @@
+package structures
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxSymlinkDepth limits the symbolic links followed while resolving a single path
+const maxSymlinkDepth = 8
+
+// ResolvePath expands the symbolic links found in filePath and returns the same path
+// without links, the last component is only followed when followLast is true.
+// Missing components are kept as they are so callers can report or create them
+func (sb *SuperBlock) ResolvePath(path string, filePath []string, followLast bool) ([]string, error) {
+	return sb.resolvePath(path, filePath, followLast, 0)
+}
+
+func (sb *SuperBlock) resolvePath(path string, filePath []string, followLast bool, depth int) ([]string, error) {
+	var resolved []string
+	index := int32(0)
+	inode := &Inode{}
+
+	for i, name := range filePath {
+		switch name {
+		case ".":
+			continue
+		case "..":
+			if len(resolved) > 0 {
+				resolved = resolved[:len(resolved)-1]
+			}
+			index = sb.getInodeReference(path, 0, resolved)
+			continue
+		}
+
+		if err := inode.ReadInode(path, int64(sb.SInodeStart+index*sb.SInodeSize)); err != nil {
+			return nil, err
+		}
+
+		if inode.IType != '0' {
+			return append(resolved, filePath[i:]...), nil
+		}
+
+		next := sb.findInodeInBlock(path, name, inode)
+		if next == -1 {
+			return append(resolved, filePath[i:]...), nil
+		}
+
+		if err := inode.ReadInode(path, int64(sb.SInodeStart+next*sb.SInodeSize)); err != nil {
+			return nil, err
+		}
+
+		if inode.IType == '2' && (i < len(filePath)-1 || followLast) {
+			if depth >= maxSymlinkDepth {
+				return nil, fmt.Errorf("too many levels of symbolic links: /%s", strings.Join(filePath[:i+1], "/"))
+			}
+
+			target := sb.getFileContent(path, inode)
+			var expanded []string
+			if !strings.HasPrefix(target, "/") {
+				expanded = append(expanded, resolved...)
+			}
+			expanded = append(expanded, SplitPath(target)...)
+			expanded = append(expanded, filePath[i+1:]...)
+
+			return sb.resolvePath(path, expanded, followLast, depth+1)
+		}
+
+		resolved = append(resolved, name)
+		index = next
+	}
+
+	return resolved, nil
+}
+
+// SplitPath splits a slash separated path into its non empty components
+func SplitPath(path string) []string {
+	var result []string
+	for _, part := range strings.Split(path, "/") {
+		if part != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+// CreateHardLink adds the entry linkPath pointing to the inode at target and
+// increases its link count, folders can not be hard linked
+func (sb *SuperBlock) CreateHardLink(path string, target, linkPath []string) error {
+	targetIndex := sb.getInodeReference(path, 0, target)
+	if targetIndex == -1 {
+		return fmt.Errorf("path not found: /%s", strings.Join(target, "/"))
+	}
+
+	inode := &Inode{}
+	inodeStart := int64(sb.SInodeStart + targetIndex*sb.SInodeSize)
+	if err := inode.ReadInode(path, inodeStart); err != nil {
+		return err
+	}
+
+	if inode.IType == '0' {
+		return fmt.Errorf("hard link not allowed for folder: /%s", strings.Join(target, "/"))
+	}
+
+	parentIndex, err := sb.linkParent(path, linkPath)
+	if err != nil {
+		return err
+	}
+
+	if err := sb.AddFolderEntry(path, parentIndex, linkPath[len(linkPath)-1], targetIndex); err != nil {
+		return err
+	}
+
+	inode.ILinks++
+	return inode.WriteInode(path, inodeStart, inodeStart+int64(sb.SInodeSize))
+}
+
+// CreateSymlink creates at linkPath a symbolic link whose content is target,
+// the target does not need to exist
+func (sb *SuperBlock) CreateSymlink(path, target string, linkPath []string, owner *Credentials) error {
+	parentIndex, err := sb.linkParent(path, linkPath)
+	if err != nil {
+		return err
+	}
+
+	parent := &Inode{}
+	if err := parent.ReadInode(path, int64(sb.SInodeStart+parentIndex*sb.SInodeSize)); err != nil {
+		return err
+	}
+
+	index := sb.NextInodeIndex()
+	if err := sb.CreatePath(path, linkPath[len(linkPath)-1], parent, true, parentIndex, owner); err != nil {
+		return err
+	}
+
+	inode := &Inode{}
+	inodeStart := int64(sb.SInodeStart + index*sb.SInodeSize)
+	if err := inode.ReadInode(path, inodeStart); err != nil {
+		return err
+	}
+
+	inode.IType = '2'
+	inode.IPerm = [3]byte{'7', '7', '7'}
+	if err := inode.WriteInode(path, inodeStart, inodeStart+int64(sb.SInodeSize)); err != nil {
+		return err
+	}
+
+	_, err = sb.writeFileContent(path, inode, target, index)
+	return err
+}
+
+// linkParent returns the folder that will hold linkPath, checking that the name is free
+func (sb *SuperBlock) linkParent(path string, linkPath []string) (int32, error) {
+	if len(linkPath) == 0 {
+		return -1, fmt.Errorf("invalid link path")
+	}
+
+	parentIndex := sb.getInodeReference(path, 0, linkPath[:len(linkPath)-1])
+	if parentIndex == -1 {
+		return -1, fmt.Errorf("path not found: /%s", strings.Join(linkPath[:len(linkPath)-1], "/"))
+	}
+
+	parent := &Inode{}
+	if err := parent.ReadInode(path, int64(sb.SInodeStart+parentIndex*sb.SInodeSize)); err != nil {
+		return -1, err
+	}
+
+	if parent.IType != '0' {
+		return -1, fmt.Errorf("not a folder: /%s", strings.Join(linkPath[:len(linkPath)-1], "/"))
+	}
+
+	if sb.findInodeInBlock(path, linkPath[len(linkPath)-1], parent) != -1 {
+		return -1, fmt.Errorf("file already exists: /%s", strings.Join(linkPath, "/"))
+	}
+
+	return parentIndex, nil
+}
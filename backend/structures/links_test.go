@@ -0,0 +1,96 @@
+package structures
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHardLinks(t *testing.T) {
+	path, sb := formatDisk(t, 200*1024, DefaultFormatOptions())
+
+	createFile(t, sb, path, "/a/file.txt", "linked content", root)
+	createFolder(t, sb, path, "/b", root)
+
+	if err := sb.CreateHardLink(path, SplitPath("/a/file.txt"), SplitPath("/b/link.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	index, inode := readInode(t, sb, path, "/a/file.txt")
+	if link, _ := readInode(t, sb, path, "/b/link.txt"); link != index {
+		t.Errorf("/b/link.txt is inode %d, want %d", link, index)
+	}
+	if inode.ILinks != 2 {
+		t.Errorf("linked file has %d links, want 2", inode.ILinks)
+	}
+
+	if err := sb.RemovePath(path, SplitPath("/a/file.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if content := sb.GetFile(path, 0, SplitPath("/b/link.txt")); content != "linked content" {
+		t.Errorf("/b/link.txt has %q after removing the other name", content)
+	}
+	if _, inode := readInode(t, sb, path, "/b/link.txt"); inode.ILinks != 1 {
+		t.Errorf("file has %d links after removing a name, want 1", inode.ILinks)
+	}
+
+	// a folder can not be hard linked
+	if err := sb.CreateHardLink(path, SplitPath("/b"), SplitPath("/c")); err == nil {
+		t.Errorf("hard link to a folder was created")
+	}
+
+	checkClean(t, sb, path)
+}
+
+func TestSymbolicLinks(t *testing.T) {
+	path, sb := formatDisk(t, 200*1024, DefaultFormatOptions())
+
+	createFile(t, sb, path, "/data/file.txt", "through the link", root)
+
+	if err := sb.CreateSymlink(path, "/data", SplitPath("/abs"), root); err != nil {
+		t.Fatal(err)
+	}
+	if err := sb.CreateSymlink(path, "file.txt", SplitPath("/data/rel"), root); err != nil {
+		t.Fatal(err)
+	}
+
+	if content := sb.GetFile(path, 0, SplitPath("/abs/rel")); content != "through the link" {
+		t.Errorf("/abs/rel reads %q", content)
+	}
+
+	resolved, err := sb.ResolvePath(path, SplitPath("/abs/rel"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"data", "rel"}; !reflect.DeepEqual(resolved, want) {
+		t.Errorf("/abs/rel resolves to %v without following the last link, want %v", resolved, want)
+	}
+
+	resolved, err = sb.ResolvePath(path, SplitPath("/abs/rel"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"data", "file.txt"}; !reflect.DeepEqual(resolved, want) {
+		t.Errorf("/abs/rel resolves to %v, want %v", resolved, want)
+	}
+
+	// removing the target leaves a dangling link
+	if err := sb.RemovePath(path, SplitPath("/data/file.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if index := sb.GetInodeReference(path, 0, SplitPath("/abs/rel")); index != -1 {
+		t.Errorf("dangling link resolves to inode %d", index)
+	}
+
+	// links to each other never resolve
+	if err := sb.CreateSymlink(path, "/loop2", SplitPath("/loop1"), root); err != nil {
+		t.Fatal(err)
+	}
+	if err := sb.CreateSymlink(path, "/loop1", SplitPath("/loop2"), root); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sb.ResolvePath(path, SplitPath("/loop1"), true); err == nil {
+		t.Errorf("a link loop resolved")
+	}
+
+	checkClean(t, sb, path)
+}
@@ -0,0 +1,270 @@
+package structures
+
+import (
+	"backend/utils"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"time"
+)
+
+// legacySuperBlock is the revision 0 superblock, times are float32 seconds and there
+// are no feature flags
+type legacySuperBlock struct {
+	SFilesystemType int32
+	SInodesCount    int32
+	SBlocksCount    int32
+	SFreeInodeCount int32
+	SFreeBlockCount int32
+	SMTime          float32
+	SUmTime         float32
+	SMntCount       int32
+	SMagic          int32
+	SInodeSize      int32
+	SBlockSize      int32
+	SFirstIno       int32
+	SFirstBlo       int32
+	SBMBlockStart   int32
+	SBMInodeStart   int32
+	SInodeStart     int32
+	SBlockStart     int32
+	// Total size of the legacySuperBlock is 68 bytes
+}
+
+// legacyInode is the revision 0 inode, times are float32 seconds and there is no link
+// count
+type legacyInode struct {
+	IuId   int32
+	IGid   int32
+	ISize  int32
+	IAtime float32
+	ICTime float32
+	IMTime float32
+	IBlock [15]int32
+	IType  byte
+	IPerm  [3]byte
+	// Total size of the legacyInode is 88 bytes
+}
+
+// legacyTime converts float32 seconds to nanoseconds
+func legacyTime(seconds float32) int64 {
+	return int64(seconds) * int64(time.Second)
+}
+
+// isLegacySuperBlock reports whether a superblock with float32 times is stored at offset,
+// its magic number sits 8 bytes earlier than in the current layout
+func isLegacySuperBlock(path string, offset int64) bool {
+	legacy := &legacySuperBlock{}
+	if err := utils.ReadFromFile(path, offset, legacy); err != nil {
+		return false
+	}
+	return legacy.SMagic == 0xEF53
+}
+
+// readOldSuperBlock returns the superblock of a revision 0 partition converted to the
+// current types
+func readOldSuperBlock(path string, offset int64) (*SuperBlock, error) {
+	legacy := &legacySuperBlock{}
+	if err := utils.ReadFromFile(path, offset, legacy); err != nil {
+		return nil, err
+	}
+
+	if legacy.SMagic != 0xEF53 {
+		return nil, fmt.Errorf("partition does not use an older format")
+	}
+
+	if int(legacy.SInodeSize) != binary.Size(legacyInode{}) {
+		return nil, fmt.Errorf("unknown inode size %d", legacy.SInodeSize)
+	}
+
+	sb := &SuperBlock{SuperBlockData: SuperBlockData{
+		SFilesystemType: legacy.SFilesystemType,
+		SInodesCount:    legacy.SInodesCount,
+		SBlocksCount:    legacy.SBlocksCount,
+		SFreeInodeCount: legacy.SFreeInodeCount,
+		SFreeBlockCount: legacy.SFreeBlockCount,
+		SMTime:          legacyTime(legacy.SMTime),
+		SUmTime:         legacyTime(legacy.SUmTime),
+		SMntCount:       legacy.SMntCount,
+		SMagic:          legacy.SMagic,
+		SInodeSize:      legacy.SInodeSize,
+		SBlockSize:      legacy.SBlockSize,
+		SFirstIno:       legacy.SFirstIno,
+		SFirstBlo:       legacy.SFirstBlo,
+		SBMBlockStart:   legacy.SBMBlockStart,
+		SBMInodeStart:   legacy.SBMInodeStart,
+		SInodeStart:     legacy.SInodeStart,
+		SBlockStart:     legacy.SBlockStart,
+	}}
+
+	return sb, nil
+}
+
+// readOldInode reads a revision 0 inode, its link count is set later by countLinks
+func readOldInode(path string, offset int64) (Inode, error) {
+	legacy := &legacyInode{}
+	if err := utils.ReadFromFile(path, offset, legacy); err != nil {
+		return Inode{}, err
+	}
+
+	return Inode{
+		IuId:   legacy.IuId,
+		IGid:   legacy.IGid,
+		ISize:  legacy.ISize,
+		IAtime: legacyTime(legacy.IAtime),
+		ICTime: legacyTime(legacy.ICTime),
+		IMTime: legacyTime(legacy.IMTime),
+		IBlock: legacy.IBlock,
+		IType:  legacy.IType,
+		IPerm:  legacy.IPerm,
+		ILinks: 1,
+		IIndex: -1,
+		IXattr: -1,
+	}, nil
+}
+
+// MigratePartition rewrites a revision 0 partition in the current revision.
+// Superblock and inodes may change size, so every area is read first and written back
+// at the positions of the new layout, block indexes are kept as they are
+func MigratePartition(path string, partition *Partition) (*SuperBlock, error) {
+	old, err := readOldSuperBlock(path, int64(partition.PartStart))
+	if err != nil {
+		return nil, err
+	}
+
+	oldInodes := old.InodeCapacity()
+	oldBlocks := old.BlockCapacity()
+
+	opts := FormatOptions{
+		FsType:    old.SFilesystemType,
+		Features:  old.SFeatures,
+		BlockSize: old.SBlockSize,
+		Ratio:     oldBlocks / oldInodes,
+	}
+
+	n := min(partition.CalculateN(opts), oldInodes)
+
+	inodeBitmap, err := readBitmap(path, int64(old.SBMInodeStart), oldInodes)
+	if err != nil {
+		return nil, err
+	}
+
+	blockBitmap, err := readBitmap(path, int64(old.SBMBlockStart), oldBlocks)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := n; i < oldInodes; i++ {
+		if inodeBitmap[i] == InodeUsed {
+			return nil, fmt.Errorf("not enough space to migrate: inode %d is in use", i)
+		}
+	}
+
+	for i := n * opts.Ratio; i < oldBlocks; i++ {
+		if blockBitmap[i] == BlockUsed {
+			return nil, fmt.Errorf("not enough space to migrate: block %d is in use", i)
+		}
+	}
+
+	inodes := make([]Inode, n)
+	for i := range inodes {
+		if inodeBitmap[i] != InodeUsed {
+			continue
+		}
+
+		inodes[i], err = readOldInode(path, int64(old.SInodeStart+int32(i)*old.SInodeSize))
+		if err != nil {
+			return nil, err
+		}
+		inodes[i].IChecksum = inodes[i].checksum()
+	}
+
+	blocks := make([]byte, n*opts.Ratio*opts.BlockSize)
+	if err := utils.ReadFromFile(path, int64(old.SBlockStart), blocks); err != nil {
+		return nil, err
+	}
+
+	sb := &SuperBlock{}
+	sb.CreateSuperBlock(partition.PartStart, n, opts)
+	sb.SMTime = old.SMTime
+	sb.SUmTime = old.SUmTime
+	sb.SMntCount = old.SMntCount
+
+	if err := sb.ReplaceBitmaps(path, inodeBitmap[:n], blockBitmap[:n*opts.Ratio]); err != nil {
+		return nil, err
+	}
+
+	if err := utils.WriteToFile(path, int64(sb.SInodeStart), int64(sb.SBlockStart), inodes); err != nil {
+		return nil, err
+	}
+
+	if err := utils.WriteToFile(path, int64(sb.SBlockStart), int64(sb.BlockEnd()), blocks); err != nil {
+		return nil, err
+	}
+
+	// block types are not known here, every used block gets its checksum
+	checksums := make([]uint32, n*opts.Ratio)
+	for i := range checksums {
+		if blockBitmap[i] == BlockUsed {
+			checksums[i] = crc32.ChecksumIEEE(blocks[int32(i)*opts.BlockSize : int32(i+1)*opts.BlockSize])
+		}
+	}
+
+	if err := utils.WriteToFile(path, int64(sb.SChecksumStart), int64(sb.SBlockStart), checksums); err != nil {
+		return nil, err
+	}
+
+	if err := sb.countLinks(path, inodeBitmap[:n]); err != nil {
+		return nil, err
+	}
+
+	return sb, nil
+}
+
+// countLinks sets the link count of the files of a revision 0 partition, which had none,
+// to the number of folder entries that point to them. Folders keep a count of 1
+func (sb *SuperBlock) countLinks(path string, inodeBitmap []byte) error {
+	links := make(map[int32]int32)
+	for i, value := range inodeBitmap {
+		if value != InodeUsed {
+			continue
+		}
+
+		inode := &Inode{}
+		if err := inode.ReadInode(path, int64(sb.SInodeStart+int32(i)*sb.SInodeSize)); err != nil {
+			return err
+		}
+
+		if inode.IType != '0' {
+			continue
+		}
+
+		for _, entry := range sb.GetFolderEntries(path, inode) {
+			links[entry.BInode]++
+		}
+	}
+
+	for i, value := range inodeBitmap {
+		index := int32(i)
+		if value != InodeUsed {
+			continue
+		}
+
+		inode := &Inode{}
+		inodeStart := int64(sb.SInodeStart + index*sb.SInodeSize)
+		if err := inode.ReadInode(path, inodeStart); err != nil {
+			return err
+		}
+
+		if inode.IType == '0' || inode.ILinks == links[index] {
+			continue
+		}
+
+		inode.ILinks = links[index]
+		if err := inode.WriteInode(path, inodeStart, inodeStart+int64(sb.SInodeSize)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package structures
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// openFixture copies a gzipped disk from testdata to a temporary file and returns its
+// path along with the partition named name
+func openFixture(t *testing.T, fixture, name string) (string, *Partition) {
+	t.Helper()
+
+	source, err := os.Open(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+
+	reader, err := gzip.NewReader(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), strings.TrimSuffix(fixture, ".gz"))
+	disk, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disk.Close()
+
+	if _, err := io.Copy(disk, reader); err != nil {
+		t.Fatal(err)
+	}
+
+	mbr := &MBR{}
+	if err := mbr.ReadMBR(path); err != nil {
+		t.Fatal(err)
+	}
+
+	partition, _ := mbr.GetPartitionByName(name)
+	if partition == nil {
+		t.Fatalf("partition %s not found in %s", name, fixture)
+	}
+
+	return path, partition
+}
+
+// migrateFixture runs MigratePartition on a fixture and returns the migrated superblock
+// as read back from the disk
+func migrateFixture(t *testing.T, fixture string) (string, *SuperBlock) {
+	t.Helper()
+
+	path, partition := openFixture(t, fixture, "P1")
+
+	sb := &SuperBlock{}
+	if err := sb.ReadSuperBlock(path, int64(partition.PartStart)); !errors.Is(err, ErrLegacyFormat) {
+		t.Fatalf("ReadSuperBlock before migrate: got %v, want ErrLegacyFormat", err)
+	}
+
+	migrated, err := MigratePartition(path, partition)
+	if err != nil {
+		t.Fatalf("MigratePartition: %v", err)
+	}
+
+	if err := migrated.WriteSuperBlock(path, int64(partition.PartStart), int64(partition.PartStart+migrated.Size())); err != nil {
+		t.Fatal(err)
+	}
+
+	sb = &SuperBlock{}
+	if err := sb.ReadSuperBlock(path, int64(partition.PartStart)); err != nil {
+		t.Fatalf("ReadSuperBlock after migrate: %v", err)
+	}
+
+	return path, sb
+}
+
+// testdata/baseline.mia.gz was written by the first version of the filesystem: mkfs on
+// partition P1, mkgrp devs, mkusr ana, mkdir -p /docs/sub, mkfile /docs/a.txt -size=100,
+// /docs/sub/big.txt -size=700 and /b.txt -size=30
+func TestMigrateBaseline(t *testing.T) {
+	path, sb := migrateFixture(t, "baseline.mia.gz")
+
+	if sb.SRevision != CurrentRevision {
+		t.Errorf("revision is %d, want %d", sb.SRevision, CurrentRevision)
+	}
+
+	if sb.SFeatures != 0 {
+		t.Errorf("features are %d, want 0", sb.SFeatures)
+	}
+
+	report, err := sb.CheckFilesystem(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, problem := range report.Problems {
+		t.Errorf("fsck: %s", problem)
+	}
+
+	digits := strings.Repeat("0123456789", 100)
+	files := map[string]string{
+		"docs/a.txt":       digits[:100],
+		"docs/sub/big.txt": digits[:700],
+		"b.txt":            digits[:30],
+	}
+
+	for name, want := range files {
+		filePath := strings.Split(name, "/")
+		if got := sb.GetFile(path, 0, filePath); got != want {
+			t.Errorf("%s has %q, want %q", name, got, want)
+		}
+
+		inode := &Inode{}
+		index := sb.GetInodeReference(path, 0, filePath)
+		if err := inode.ReadInode(path, int64(sb.SInodeStart+index*sb.SInodeSize)); err != nil {
+			t.Fatal(err)
+		}
+		if inode.ILinks != 1 {
+			t.Errorf("%s has %d links, want 1", name, inode.ILinks)
+		}
+	}
+
+	if users := sb.GetFile(path, 0, []string{"users.txt"}); !strings.Contains(users, ",U,devs,ana,1\n") {
+		t.Errorf("users.txt is %q", users)
+	}
+}
@@ -0,0 +1,51 @@
+package structures
+
+import (
+	"backend/utils"
+	"encoding/binary"
+	"fmt"
+)
+
+type NameBlock struct {
+	BName []byte
+	BNext int32
+	sb    *SuperBlock // locates the checksum table
+	// Total size of the NameBlock is SBlockSize bytes, BNext takes the last 4
+}
+
+// NewNameBlock returns an empty name block sized for this filesystem
+func (sb *SuperBlock) NewNameBlock() *NameBlock {
+	return &NameBlock{BName: make([]byte, sb.SBlockSize-4), BNext: -1, sb: sb}
+}
+
+func (n *NameBlock) WriteNameBlock(path string, offset int64, maxSize int64) error {
+	data := make([]byte, len(n.BName)+4)
+	copy(data, n.BName)
+	binary.LittleEndian.PutUint32(data[len(n.BName):], uint32(n.BNext))
+
+	if err := n.sb.copyOnWrite(path, offset); err != nil {
+		return err
+	}
+
+	if err := utils.WriteToFile(path, offset, maxSize, data); err != nil {
+		return err
+	}
+	return n.sb.writeBlockChecksum(path, offset, data)
+}
+
+func (n *NameBlock) ReadNameBlock(path string, offset int64) error {
+	data := make([]byte, len(n.BName)+4)
+	if err := utils.ReadFromFile(path, offset, data); err != nil {
+		return err
+	}
+
+	copy(n.BName, data)
+	n.BNext = int32(binary.LittleEndian.Uint32(data[len(n.BName):]))
+	return n.sb.verifyBlockChecksum(path, offset, "name block", data)
+}
+
+func (n *NameBlock) Print() {
+	fmt.Printf("--*-- NameBlock --*--\n")
+	fmt.Printf("BName: %s\n", n.BName)
+	fmt.Printf("BNext: %d\n", n.BNext)
+}
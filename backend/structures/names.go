@@ -0,0 +1,153 @@
+package structures
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// ShortNameLength is the size of FolderContent.BName
+	ShortNameLength = 12
+	// MaxNameLength is the longest name accepted with FeatureLongNames
+	MaxNameLength = 255
+	// longNameMarker starts the BName of an entry whose name lives in name blocks,
+	// 0xFF never appears in valid UTF-8 so it can not be confused with a short name.
+	// The rest of BName holds the name length (byte 1) and the first name block (bytes 4-8)
+	longNameMarker = 0xFF
+)
+
+// IsLongName reports whether the name of the entry is stored in name blocks
+func (f *FolderContent) IsLongName() bool {
+	return f.BName[0] == longNameMarker
+}
+
+// nameBlockStart returns the first name block of a long name entry
+func (f *FolderContent) nameBlockStart() int32 {
+	return int32(binary.LittleEndian.Uint32(f.BName[4:8]))
+}
+
+// nameChunk returns the number of name bytes kept by each NameBlock
+func (sb *SuperBlock) nameChunk() int {
+	return int(sb.SBlockSize) - 4
+}
+
+// ValidateName checks that name is valid UTF-8 and fits in a folder entry of this filesystem
+func (sb *SuperBlock) ValidateName(name string) error {
+	if !utf8.ValidString(name) {
+		return fmt.Errorf("invalid name: %q is not valid UTF-8", name)
+	}
+
+	limit := ShortNameLength
+	if sb.HasFeature(FeatureLongNames) {
+		limit = MaxNameLength
+	}
+
+	if len(name) > limit {
+		return fmt.Errorf("name too long: %s (max %d bytes)", name, limit)
+	}
+
+	return nil
+}
+
+// encodeName returns the BName bytes for name, names longer than ShortNameLength
+// are written to a chain of name blocks and replaced by a long name marker
+func (sb *SuperBlock) encodeName(path, name string) (string, error) {
+	if err := sb.ValidateName(name); err != nil {
+		return "", err
+	}
+
+	if len(name) <= ShortNameLength {
+		return name, nil
+	}
+
+	chunks := (len(name) + sb.nameChunk() - 1) / sb.nameChunk()
+	if err := sb.CheckFreeBlocks(int32(chunks)); err != nil {
+		return "", err
+	}
+
+	var encoded [ShortNameLength]byte
+	encoded[0] = longNameMarker
+	encoded[1] = byte(len(name))
+	binary.LittleEndian.PutUint32(encoded[4:8], uint32(sb.NextBlockIndex()))
+
+	for len(name) > 0 {
+		block := sb.NewNameBlock()
+		n := copy(block.BName[:], name)
+		name = name[n:]
+
+		blockStart := int64(sb.SFirstBlo)
+		if err := sb.UpdateBitmapBlock(path); err != nil {
+			return "", err
+		}
+
+		if len(name) > 0 {
+			block.BNext = sb.NextBlockIndex()
+		}
+
+		if err := block.WriteNameBlock(path, blockStart, blockStart+int64(sb.SBlockSize)); err != nil {
+			return "", err
+		}
+	}
+
+	return string(encoded[:]), nil
+}
+
+// releaseName frees the name blocks written by encodeName when the entry that would
+// have pointed to them is never stored
+func (sb *SuperBlock) releaseName(path, encoded string) error {
+	entry := FolderContent{}
+	copy(entry.BName[:], encoded)
+
+	for _, blockIndex := range sb.nameBlocks(path, entry) {
+		if err := sb.FreeBlock(path, blockIndex); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// EntryName returns the name of a folder entry, reading its name blocks when needed
+func (sb *SuperBlock) EntryName(path string, entry FolderContent) string {
+	if !entry.IsLongName() {
+		return strings.TrimRight(string(entry.BName[:]), "\x00")
+	}
+
+	var name strings.Builder
+	length := int(entry.BName[1])
+	for _, blockIndex := range sb.nameBlocks(path, entry) {
+		block := sb.NewNameBlock()
+		if err := block.ReadNameBlock(path, int64(sb.SBlockStart+blockIndex*sb.SBlockSize)); err != nil {
+			break
+		}
+		name.Write(block.BName[:min(sb.nameChunk(), length-name.Len())])
+	}
+
+	return name.String()
+}
+
+// nameBlocks returns the chain of name blocks of a long name entry, stopping at
+// the first pointer out of range so a damaged chain can not loop forever
+func (sb *SuperBlock) nameBlocks(path string, entry FolderContent) []int32 {
+	if !entry.IsLongName() {
+		return nil
+	}
+
+	var blocks []int32
+	maxBlocks := (int(entry.BName[1]) + sb.nameChunk() - 1) / sb.nameChunk()
+	next := entry.nameBlockStart()
+
+	for len(blocks) < maxBlocks && next >= 0 && next < sb.BlockCapacity() {
+		blocks = append(blocks, next)
+
+		block := sb.NewNameBlock()
+		if err := block.ReadNameBlock(path, int64(sb.SBlockStart+next*sb.SBlockSize)); err != nil {
+			break
+		}
+		next = block.BNext
+	}
+
+	return blocks
+}
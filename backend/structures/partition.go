@@ -59,9 +59,15 @@ func (p *Partition) IsMounted() bool {
 	return p.PartCorrelative != -1
 }
 
-func (p *Partition) CalculateN() int32 {
-	numerator := int(p.PartSize) - binary.Size(SuperBlock{})
-	denominator := 4 + binary.Size(Inode{}) + 3*binary.Size(FileBlock{})
+// CalculateN returns how many inodes fit in the partition, each one takes a bitmap byte,
+// the inode itself and ratio blocks with their bitmap bytes and checksums (plus a journal
+// entry on EXT3)
+func (p *Partition) CalculateN(opts FormatOptions) int32 {
+	numerator := int(p.PartSize) - binary.Size(SuperBlockData{})
+	denominator := 1 + int(opts.Ratio) + binary.Size(Inode{}) + int(opts.Ratio*opts.BlockSize) + 4*int(opts.Ratio)
+	if opts.FsType == 3 {
+		denominator += binary.Size(Journal{})
+	}
 	return int32(math.Floor(float64(numerator) / float64(denominator)))
 }
 
@@ -0,0 +1,208 @@
+package structures
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	PermRead  byte = 4
+	PermWrite byte = 2
+	PermExec  byte = 1
+)
+
+// Credentials identifies the user an operation is executed for
+type Credentials struct {
+	UID int32
+	GID int32
+}
+
+// PermissionError is returned when the credentials do not grant access to an inode
+type PermissionError struct {
+	Op   string
+	Path string
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("permission denied: cannot %s %s", e.Op, e.Path)
+}
+
+// HasPermission checks perm (a mix of PermRead, PermWrite and PermExec) against IPerm,
+// using the owner, group or others digit depending on the credentials
+func (i *Inode) HasPermission(creds *Credentials, perm byte) bool {
+	if creds.UID == RootUID {
+		return true
+	}
+
+	var digit byte
+	switch {
+	case i.IuId == creds.UID:
+		digit = i.IPerm[0]
+	case i.IGid == creds.GID:
+		digit = i.IPerm[1]
+	default:
+		digit = i.IPerm[2]
+	}
+
+	if digit < '0' || digit > '7' {
+		return false
+	}
+
+	return (digit-'0')&perm == perm
+}
+
+// CheckAccess verifies that every folder in filePath can be traversed and that the
+// last inode grants perm, a missing path is not an error so callers can report it
+func (sb *SuperBlock) CheckAccess(path string, filePath []string, creds *Credentials, perm byte) error {
+	filePath, err := sb.ResolvePath(path, filePath, true)
+	if err != nil {
+		return err
+	}
+
+	inode := &Inode{}
+	index := int32(0)
+
+	for i, name := range filePath {
+		if err := inode.ReadInode(path, int64(sb.SInodeStart+index*sb.SInodeSize)); err != nil {
+			return err
+		}
+
+		if inode.IType != '0' {
+			return nil
+		}
+
+		if !inode.HasPermission(creds, PermExec) {
+			return &PermissionError{Op: "traverse", Path: "/" + strings.Join(filePath[:i], "/")}
+		}
+
+		index = sb.findInodeInBlock(path, name, inode)
+		if index == -1 {
+			return nil
+		}
+	}
+
+	if err := inode.ReadInode(path, int64(sb.SInodeStart+index*sb.SInodeSize)); err != nil {
+		return err
+	}
+
+	if !inode.HasPermission(creds, perm) {
+		return &PermissionError{Op: permissionName(perm), Path: "/" + strings.Join(filePath, "/")}
+	}
+
+	return nil
+}
+
+// CheckCreate verifies that the deepest existing folder of filePath can be modified,
+// when the whole path already exists write access on it is required instead
+func (sb *SuperBlock) CheckCreate(path string, filePath []string, creds *Credentials) error {
+	filePath, err := sb.ResolvePath(path, filePath, true)
+	if err != nil {
+		return err
+	}
+
+	inode := &Inode{}
+	index := int32(0)
+
+	for i, name := range filePath {
+		if err := inode.ReadInode(path, int64(sb.SInodeStart+index*sb.SInodeSize)); err != nil {
+			return err
+		}
+
+		if inode.IType != '0' {
+			return nil
+		}
+
+		parent := "/" + strings.Join(filePath[:i], "/")
+		if !inode.HasPermission(creds, PermExec) {
+			return &PermissionError{Op: "traverse", Path: parent}
+		}
+
+		next := sb.findInodeInBlock(path, name, inode)
+		if next == -1 {
+			if !inode.HasPermission(creds, PermWrite) {
+				return &PermissionError{Op: "write", Path: parent}
+			}
+			return nil
+		}
+		index = next
+	}
+
+	if err := inode.ReadInode(path, int64(sb.SInodeStart+index*sb.SInodeSize)); err != nil {
+		return err
+	}
+
+	if !inode.HasPermission(creds, PermWrite) {
+		return &PermissionError{Op: "write", Path: "/" + strings.Join(filePath, "/")}
+	}
+
+	return nil
+}
+
+// CheckRemove verifies that filePath can be removed with everything below it. The folder
+// holding it must grant write and execute, and so must every folder below it that still
+// has entries since removing it removes them too. Symbolic links are not followed
+func (sb *SuperBlock) CheckRemove(path string, filePath []string, creds *Credentials) error {
+	if len(filePath) == 0 {
+		return nil
+	}
+
+	if err := sb.CheckAccess(path, filePath[:len(filePath)-1], creds, PermWrite|PermExec); err != nil {
+		return err
+	}
+
+	index := sb.getInodeReference(path, 0, filePath)
+	if index == -1 {
+		return nil
+	}
+
+	return sb.checkRemoveTree(path, index, "/"+strings.Join(filePath, "/"), creds)
+}
+
+// checkRemoveTree verifies write and execute on the folder at index, when it has entries,
+// and on the folders below it. name is the path reported on failure
+func (sb *SuperBlock) checkRemoveTree(path string, index int32, name string, creds *Credentials) error {
+	if creds.UID == RootUID {
+		return nil
+	}
+
+	inode := &Inode{}
+	if err := inode.ReadInode(path, int64(sb.SInodeStart+index*sb.SInodeSize)); err != nil {
+		return err
+	}
+
+	if inode.IType != '0' {
+		return nil
+	}
+
+	entries := sb.GetFolderEntries(path, inode)
+	if len(entries) == 0 {
+		return nil
+	}
+
+	if !inode.HasPermission(creds, PermWrite|PermExec) {
+		return &PermissionError{Op: "write", Path: name}
+	}
+
+	for _, entry := range entries {
+		if err := sb.checkRemoveTree(path, entry.BInode, name+"/"+sb.EntryName(path, entry), creds); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func permissionName(perm byte) string {
+	switch perm {
+	case PermRead:
+		return "read"
+	case PermWrite:
+		return "write"
+	case PermExec:
+		return "execute"
+	case PermRead | PermExec:
+		return "list"
+	default:
+		return "access"
+	}
+}
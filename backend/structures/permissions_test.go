@@ -0,0 +1,62 @@
+package structures
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPermissionChecks(t *testing.T) {
+	path, sb := formatDisk(t, 200*1024, DefaultFormatOptions())
+
+	createFile(t, sb, path, "/home/notes.txt", "secret", root)
+	createFolder(t, sb, path, "/pub", root)
+	createFolder(t, sb, path, "/ro", root)
+
+	home, _ := readInode(t, sb, path, "/home")
+	if err := sb.ChangePermissions(path, home, [3]byte{'7', '0', '0'}, RootUID, false); err != nil {
+		t.Fatal(err)
+	}
+	pub, _ := readInode(t, sb, path, "/pub")
+	if err := sb.ChangePermissions(path, pub, [3]byte{'7', '7', '7'}, RootUID, false); err != nil {
+		t.Fatal(err)
+	}
+
+	var denied *PermissionError
+
+	// root is never denied
+	if err := sb.CheckAccess(path, SplitPath("/home/notes.txt"), root, PermRead); err != nil {
+		t.Errorf("root can not read /home/notes.txt: %v", err)
+	}
+
+	if err := sb.CheckAccess(path, SplitPath("/home/notes.txt"), user, PermRead); !errors.As(err, &denied) || denied.Path != "/home" {
+		t.Errorf("reading through /home with mode 700 returned %v, want traverse denied on /home", err)
+	}
+	if err := sb.CheckCreate(path, SplitPath("/ro/new.txt"), user); !errors.As(err, &denied) || denied.Path != "/ro" {
+		t.Errorf("creating in /ro with mode 775 returned %v, want write denied on /ro", err)
+	}
+	if err := sb.CheckCreate(path, SplitPath("/pub/a/b.txt"), user); err != nil {
+		t.Errorf("creating in /pub with mode 777 returned %v", err)
+	}
+
+	// others get r-- on a new file, the owner rw-
+	createFile(t, sb, path, "/pub/mine.txt", "x", user)
+	if err := sb.CheckAccess(path, SplitPath("/pub/mine.txt"), user, PermWrite); err != nil {
+		t.Errorf("owner can not write /pub/mine.txt: %v", err)
+	}
+	other := &Credentials{UID: 3, GID: 3}
+	if err := sb.CheckAccess(path, SplitPath("/pub/mine.txt"), other, PermRead); err != nil {
+		t.Errorf("others can not read /pub/mine.txt: %v", err)
+	}
+	if err := sb.CheckAccess(path, SplitPath("/pub/mine.txt"), other, PermWrite); !errors.As(err, &denied) {
+		t.Errorf("others writing /pub/mine.txt returned %v, want permission denied", err)
+	}
+
+	// removing a folder needs write on the folders below it that have entries
+	createFile(t, sb, path, "/pub/tree/locked/f.txt", "x", root)
+	if err := sb.CheckRemove(path, SplitPath("/pub/tree"), user); !errors.As(err, &denied) || denied.Path != "/pub/tree" {
+		t.Errorf("removing /pub/tree returned %v, want write denied on /pub/tree", err)
+	}
+	if err := sb.CheckRemove(path, SplitPath("/pub/mine.txt"), user); err != nil {
+		t.Errorf("removing /pub/mine.txt returned %v", err)
+	}
+}
@@ -7,8 +7,16 @@ import (
 )
 
 type PointerBlock struct {
-	PPointers [16]int32
-	// Total size of the PointerBlock is 64 bytes
+	PPointers []int32
+	sb        *SuperBlock // locates the checksum table
+	// Total size of the PointerBlock is SBlockSize bytes, SBlockSize/4 pointers
+}
+
+// NewPointerBlock returns a pointer block sized for this filesystem, every pointer is free
+func (sb *SuperBlock) NewPointerBlock() *PointerBlock {
+	block := &PointerBlock{PPointers: make([]int32, sb.SBlockSize/4), sb: sb}
+	block.DefaultValue()
+	return block
 }
 
 func (p *PointerBlock) DefaultValue() {
@@ -27,17 +35,21 @@ func (p *PointerBlock) FindFreePointer() int32 {
 }
 
 func (p *PointerBlock) WritePointerBlock(path string, offset int64, maxSize int64) error {
-	if err := utils.WriteToFile(path, offset, maxSize, p); err != nil {
+	if err := p.sb.copyOnWrite(path, offset); err != nil {
+		return err
+	}
+
+	if err := utils.WriteToFile(path, offset, maxSize, p.PPointers); err != nil {
 		return err
 	}
-	return nil
+	return p.sb.writeBlockChecksum(path, offset, p.PPointers)
 }
 
 func (p *PointerBlock) ReadPointerBlock(path string, offset int64) error {
-	if err := utils.ReadFromFile(path, offset, p); err != nil {
+	if err := utils.ReadFromFile(path, offset, p.PPointers); err != nil {
 		return err
 	}
-	return nil
+	return p.sb.verifyBlockChecksum(path, offset, "pointer block", p.PPointers)
 }
 
 func (p *PointerBlock) GetStringBuilder(nodeName string) string {
@@ -0,0 +1,331 @@
+package structures
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// QuotaFile holds the quota records in the root folder, one line per user or group
+const QuotaFile = "quota.txt"
+
+// ErrQuotaExceeded is returned by the allocator when a hard limit would be passed
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaLimits are the limits of a user or group, 0 means unlimited. Soft limits
+// are only reported, hard limits make allocations fail
+type QuotaLimits struct {
+	InodeSoft int32
+	InodeHard int32
+	BlockSoft int32
+	BlockHard int32
+}
+
+// QuotaRecord assigns limits to a user (Type 'U') or a group (Type 'G')
+type QuotaRecord struct {
+	Type byte
+	ID   int32
+	QuotaLimits
+}
+
+// QuotaUsage counts the inodes and blocks owned by a user or group
+type QuotaUsage struct {
+	Inodes int32
+	Blocks int32
+}
+
+// quotaTarget is a user or group charged while a quota is active
+type quotaTarget struct {
+	QuotaRecord
+	usage QuotaUsage
+}
+
+// name returns how errors refer to the target
+func (t *quotaTarget) name() string {
+	if t.Type == 'U' {
+		return fmt.Sprintf("uid %d", t.ID)
+	}
+	return fmt.Sprintf("gid %d", t.ID)
+}
+
+// ParseQuotaRecords reads the content of the quota file, malformed lines are skipped
+func ParseQuotaRecords(data string) []QuotaRecord {
+	var records []QuotaRecord
+
+	for _, line := range strings.Split(data, "\n") {
+		parts := strings.Split(line, ",")
+		if len(parts) != 6 {
+			continue
+		}
+
+		var values [5]int32
+		valid := true
+		for i, part := range parts[1:] {
+			value, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				valid = false
+				break
+			}
+			values[i] = int32(value)
+		}
+
+		kind := strings.TrimSpace(parts[0])
+		if !valid || (kind != "U" && kind != "G") {
+			continue
+		}
+
+		records = append(records, QuotaRecord{
+			Type:        kind[0],
+			ID:          values[0],
+			QuotaLimits: QuotaLimits{InodeSoft: values[1], InodeHard: values[2], BlockSoft: values[3], BlockHard: values[4]},
+		})
+	}
+
+	return records
+}
+
+// FormatQuotaRecords returns the content of the quota file. Fields are padded to a fixed
+// width so updating a record never makes the file shorter, WriteFile does not truncate
+func FormatQuotaRecords(records []QuotaRecord) string {
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].Type != records[j].Type {
+			return records[i].Type > records[j].Type
+		}
+		return records[i].ID < records[j].ID
+	})
+
+	var sb strings.Builder
+	for _, r := range records {
+		sb.WriteString(fmt.Sprintf("%c,%5d,%10d,%10d,%10d,%10d\n", r.Type, r.ID, r.InodeSoft, r.InodeHard, r.BlockSoft, r.BlockHard))
+	}
+	return sb.String()
+}
+
+// FindQuotaRecord returns the record of the given type and id, or nil
+func FindQuotaRecord(records []QuotaRecord, kind byte, id int32) *QuotaRecord {
+	for i := range records {
+		if records[i].Type == kind && records[i].ID == id {
+			return &records[i]
+		}
+	}
+	return nil
+}
+
+// ReadQuotaRecords returns the records of the quota file, none when it does not exist
+func (sb *SuperBlock) ReadQuotaRecords(path string) []QuotaRecord {
+	if sb.getInodeReference(path, 0, []string{QuotaFile}) == -1 {
+		return nil
+	}
+
+	return ParseQuotaRecords(sb.getFile(path, 0, []string{QuotaFile}))
+}
+
+// WriteQuotaRecords stores records in the quota file, creating it owned by root
+func (sb *SuperBlock) WriteQuotaRecords(path string, records []QuotaRecord) error {
+	if sb.getInodeReference(path, 0, []string{QuotaFile}) == -1 {
+		root := &Credentials{UID: RootUID, GID: 1}
+		if err := sb.CreateNewInode(path, []string{QuotaFile}, 0, true, false, root); err != nil {
+			return err
+		}
+	}
+
+	_, err := sb.writeFile(path, 0, []string{QuotaFile}, FormatQuotaRecords(records))
+	return err
+}
+
+// QuotaUsage returns the inodes and blocks owned by every uid and gid. Blocks are the
+// ones referenced from the inode: data, pointer, attribute and directory index blocks,
+// and for a folder the name blocks of its long names
+func (sb *SuperBlock) QuotaUsage(path string) (map[int32]QuotaUsage, map[int32]QuotaUsage, error) {
+	used, err := sb.GetUsedInodes(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	users := make(map[int32]QuotaUsage)
+	groups := make(map[int32]QuotaUsage)
+
+	for _, index := range used {
+		inode := &Inode{}
+		if err := inode.ReadInode(path, int64(sb.SInodeStart+index*sb.SInodeSize)); err != nil {
+			return nil, nil, err
+		}
+
+		blocks := sb.InodeBlockCount(path, inode)
+		if inode.IType == '0' {
+			for _, entry := range sb.GetFolderEntries(path, inode) {
+				blocks += int32(len(sb.nameBlocks(path, entry)))
+			}
+		}
+
+		user := users[inode.IuId]
+		users[inode.IuId] = QuotaUsage{Inodes: user.Inodes + 1, Blocks: user.Blocks + blocks}
+
+		group := groups[inode.IGid]
+		groups[inode.IGid] = QuotaUsage{Inodes: group.Inodes + 1, Blocks: group.Blocks + blocks}
+	}
+
+	return users, groups, nil
+}
+
+// InodeBlockCount returns the number of blocks referenced from inode
+func (sb *SuperBlock) InodeBlockCount(path string, inode *Inode) int32 {
+	return int32(len(sb.inodeBlocks(path, inode)))
+}
+
+// inodeBlocks returns every block referenced from inode: data, pointer, attribute and
+// directory index blocks
+func (sb *SuperBlock) inodeBlocks(path string, inode *Inode) []int32 {
+	var blocks []int32
+
+	// inline files have no data blocks, IBlock holds their content
+	if !inode.IsInline() {
+		for _, block := range inode.IBlock[:12] {
+			if block != -1 {
+				blocks = append(blocks, block)
+			}
+		}
+
+		for i, block := range inode.IBlock[12:] {
+			if block != -1 {
+				blocks = append(blocks, sb.pointerTreeBlocks(path, block, int32(i))...)
+			}
+		}
+	}
+
+	if inode.IXattr != -1 {
+		blocks = append(blocks, inode.IXattr)
+	}
+
+	if inode.IIndex != -1 {
+		if index, err := sb.dirIndexBlocks(path, inode.IIndex); err == nil {
+			blocks = append(blocks, index...)
+		}
+	}
+
+	return blocks
+}
+
+// pointerTreeBlocks returns a pointer block and the blocks below it, level 0 points to data blocks
+func (sb *SuperBlock) pointerTreeBlocks(path string, blockIndex, level int32) []int32 {
+	blocks := []int32{blockIndex}
+
+	block := sb.NewPointerBlock()
+	if err := block.ReadPointerBlock(path, int64(sb.SBlockStart+blockIndex*sb.SBlockSize)); err != nil {
+		return blocks
+	}
+
+	for _, pointer := range block.PPointers {
+		if pointer == -1 {
+			continue
+		}
+
+		if level == 0 {
+			blocks = append(blocks, pointer)
+		} else {
+			blocks = append(blocks, sb.pointerTreeBlocks(path, pointer, level-1)...)
+		}
+	}
+
+	return blocks
+}
+
+// StartQuota turns the quota on until the returned function is called. What is allocated
+// from now on is charged to the owner of the inode it belongs to, creds unless chargeTo
+// says otherwise. Root has no limits
+func (sb *SuperBlock) StartQuota(path string, creds *Credentials) (func(), error) {
+	release := func() { sb.quota = nil }
+
+	if creds.UID == RootUID {
+		return release, nil
+	}
+
+	records := sb.ReadQuotaRecords(path)
+	if len(records) == 0 {
+		return release, nil
+	}
+
+	users, groups, err := sb.QuotaUsage(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sb.quota = nil
+	for _, record := range records {
+		usage := users[record.ID]
+		if record.Type == 'G' {
+			usage = groups[record.ID]
+		}
+		sb.quota = append(sb.quota, &quotaTarget{QuotaRecord: record, usage: usage})
+	}
+	sb.quotaOwner = *creds
+
+	return release, nil
+}
+
+// chargeTo charges what is allocated or freed from now on to the owner uid and gid
+// until the returned function is called
+func (sb *SuperBlock) chargeTo(uid, gid int32) func() {
+	owner := sb.quotaOwner
+	sb.quotaOwner = Credentials{UID: uid, GID: gid}
+	return func() { sb.quotaOwner = owner }
+}
+
+// quotaTargets returns the user and group the next allocation is charged to, none while
+// SnapshotFile is written: snapshots belong to the filesystem and not to a user
+func (sb *SuperBlock) quotaTargets() []*quotaTarget {
+	if sb.snapshotWriting {
+		return nil
+	}
+
+	var targets []*quotaTarget
+	for _, target := range sb.quota {
+		if (target.Type == 'U' && target.ID == sb.quotaOwner.UID) || (target.Type == 'G' && target.ID == sb.quotaOwner.GID) {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+// checkQuota fails when allocating inodes and blocks more would pass a hard limit
+func (sb *SuperBlock) checkQuota(inodes, blocks int32) error {
+	for _, target := range sb.quotaTargets() {
+		if hard := target.InodeHard; hard > 0 && inodes > 0 && target.usage.Inodes+inodes > hard {
+			return fmt.Errorf("%w: %s reached its hard limit of %d inodes", ErrQuotaExceeded, target.name(), hard)
+		}
+
+		if hard := target.BlockHard; hard > 0 && blocks > 0 && target.usage.Blocks+blocks > hard {
+			return fmt.Errorf("%w: %s reached its hard limit of %d blocks", ErrQuotaExceeded, target.name(), hard)
+		}
+	}
+
+	return nil
+}
+
+// chargeQuota adds allocated (or freed, when negative) inodes and blocks to the active quota
+func (sb *SuperBlock) chargeQuota(inodes, blocks int32) {
+	for _, target := range sb.quotaTargets() {
+		target.usage.Inodes += inodes
+		target.usage.Blocks += blocks
+	}
+}
+
+// CheckFreeInodes fails when n inodes can not be allocated
+func (sb *SuperBlock) CheckFreeInodes(n int32) error {
+	if sb.SFreeInodeCount < n {
+		return fmt.Errorf("no free inodes")
+	}
+
+	return sb.checkQuota(n, 0)
+}
+
+// CheckFreeBlocks fails when n blocks can not be allocated
+func (sb *SuperBlock) CheckFreeBlocks(n int32) error {
+	if sb.SFreeBlockCount < n {
+		return fmt.Errorf("no free blocks")
+	}
+
+	return sb.checkQuota(0, n)
+}
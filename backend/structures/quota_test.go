@@ -0,0 +1,66 @@
+package structures
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestQuotaEnforcement(t *testing.T) {
+	path, sb := formatDisk(t, 200*1024, DefaultFormatOptions())
+
+	createFolder(t, sb, path, "/pub", root)
+	limits := QuotaLimits{InodeHard: 2, BlockSoft: 1, BlockHard: 4}
+	if err := sb.WriteQuotaRecords(path, []QuotaRecord{{Type: 'U', ID: user.UID, QuotaLimits: limits}}); err != nil {
+		t.Fatal(err)
+	}
+
+	release, err := sb.StartQuota(path, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the entry in the folder of root is not charged to the user, soft limits only warn
+	createFile(t, sb, path, "/pub/a.txt", strings.Repeat("a", int(4*sb.SBlockSize)), user)
+	createFile(t, sb, path, "/pub/b.txt", "", user)
+
+	if _, err := sb.WriteFile(path, 0, SplitPath("/pub/b.txt"), "b"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("writing past the block hard limit returned %v, want %v", err, ErrQuotaExceeded)
+	}
+	if err := sb.CreateNewInode(path, SplitPath("/pub/c.txt"), 0, true, true, user); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("creating past the inode hard limit returned %v, want %v", err, ErrQuotaExceeded)
+	}
+	release()
+
+	users, _, err := sb.QuotaUsage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage := users[user.UID]; usage != (QuotaUsage{Inodes: 2, Blocks: 4}) {
+		t.Errorf("user owns %+v, want 2 inodes and 4 blocks", usage)
+	}
+
+	// writes are charged to the owner of the file and not to who writes it
+	other := &Credentials{UID: 3, GID: 3}
+	release, err = sb.StartQuota(path, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sb.WriteFile(path, 0, SplitPath("/pub/b.txt"), "b"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("writing to a file of a user at its limit returned %v, want %v", err, ErrQuotaExceeded)
+	}
+	createFile(t, sb, path, "/pub/c.txt", "c", other)
+	release()
+
+	// root has no limits
+	release, err = sb.StartQuota(path, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sb.WriteFile(path, 0, SplitPath("/pub/b.txt"), "b"); err != nil {
+		t.Errorf("root writing to a file of a user at its limit returned %v", err)
+	}
+	release()
+
+	checkClean(t, sb, path)
+}
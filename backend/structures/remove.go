@@ -0,0 +1,160 @@
+package structures
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RemovePath unlinks the entry at filePath from its folder and releases the inode it
+// pointed to, a folder is removed with everything below it. Symbolic links are not followed
+func (sb *SuperBlock) RemovePath(path string, filePath []string) error {
+	parent, err := sb.removableParent(path, filePath)
+	if err != nil {
+		return err
+	}
+
+	return sb.removeEntry(path, parent, filePath[len(filePath)-1])
+}
+
+// MissingPath returns the part of filePath that does not exist yet, the folders and the
+// file that creating filePath adds. It is empty when filePath already exists
+func (sb *SuperBlock) MissingPath(path string, filePath []string) []string {
+	for i := range filePath {
+		if sb.getInodeReference(path, 0, filePath[:i+1]) == -1 {
+			return filePath[:i+1]
+		}
+	}
+
+	return nil
+}
+
+// UndoCreate removes what a failed command created, missing is the MissingPath of the
+// path it was creating taken before anything was written
+func (sb *SuperBlock) UndoCreate(path string, missing []string) error {
+	if len(missing) == 0 || sb.getInodeReference(path, 0, missing) == -1 {
+		return nil
+	}
+
+	return sb.RemovePath(path, missing)
+}
+
+// removeEntry unlinks name from the folder at parent and releases its inode
+func (sb *SuperBlock) removeEntry(path string, parent int32, name string) error {
+	index, err := sb.removeFolderEntry(path, parent, name)
+	if err != nil {
+		return err
+	}
+
+	return sb.releaseInode(path, index)
+}
+
+// removableParent returns the folder holding filePath, the root folder, the trash and the
+// files the filesystem keeps for itself can not be removed
+func (sb *SuperBlock) removableParent(path string, filePath []string) (int32, error) {
+	if len(filePath) == 0 {
+		return -1, fmt.Errorf("cannot remove /")
+	}
+
+	if filePath[0] == TrashFolder || (len(filePath) == 1 && (filePath[0] == "users.txt" || filePath[0] == QuotaFile || filePath[0] == SnapshotFile)) {
+		return -1, fmt.Errorf("cannot remove /%s", filePath[0])
+	}
+
+	if sb.getInodeReference(path, 0, filePath) == -1 {
+		return -1, fmt.Errorf("path not found: /%s", strings.Join(filePath, "/"))
+	}
+
+	return sb.getInodeReference(path, 0, filePath[:len(filePath)-1]), nil
+}
+
+// removeFolderEntry frees the entry name of the folder at parent together with the
+// blocks of its long name and returns the inode it pointed to, the index of the folder
+// forgets the block for the hash of name once no other name of the block has it
+func (sb *SuperBlock) removeFolderEntry(path string, parent int32, name string) (int32, error) {
+	inode := &Inode{}
+	inodeStart := int64(sb.SInodeStart + parent*sb.SInodeSize)
+	if err := inode.ReadInode(path, inodeStart); err != nil {
+		return -1, err
+	}
+	defer sb.chargeTo(inode.IuId, inode.IGid)()
+
+	for _, blockIndex := range sb.FolderBlocks(path, inode) {
+		block := sb.NewFolderBlock()
+		blockStart := int64(sb.SBlockStart + blockIndex*sb.SBlockSize)
+		if err := block.ReadFolderBlock(path, blockStart); err != nil {
+			return -1, err
+		}
+
+		for i := 2; i < len(block.BContent); i++ {
+			entry := block.BContent[i]
+			if entry.BInode == -1 || sb.EntryName(path, entry) != name {
+				continue
+			}
+
+			for _, nameBlock := range sb.nameBlocks(path, entry) {
+				if err := sb.FreeBlock(path, nameBlock); err != nil {
+					return -1, err
+				}
+			}
+
+			block.BContent[i] = FolderContent{BName: [12]byte{'-'}, BInode: -1}
+			if err := block.WriteFolderBlock(path, blockStart, blockStart+int64(sb.SBlockSize)); err != nil {
+				return -1, err
+			}
+
+			inode.IMTime = Timestamp()
+			if err := inode.WriteInode(path, inodeStart, inodeStart+int64(sb.SInodeSize)); err != nil {
+				return -1, err
+			}
+
+			if inode.IIndex != -1 {
+				if err := sb.unindexFolderEntry(path, parent, inode.IIndex, name, blockIndex, block); err != nil {
+					return -1, err
+				}
+			}
+
+			return entry.BInode, nil
+		}
+	}
+
+	return -1, fmt.Errorf("entry not found: %s", name)
+}
+
+// releaseInode drops a link to the inode at index. A file still linked from another
+// folder only loses a link, otherwise its blocks and the inode are freed and a folder
+// releases its entries first
+func (sb *SuperBlock) releaseInode(path string, index int32) error {
+	inode := &Inode{}
+	inodeStart := int64(sb.SInodeStart + index*sb.SInodeSize)
+	if err := inode.ReadInode(path, inodeStart); err != nil {
+		return err
+	}
+	defer sb.chargeTo(inode.IuId, inode.IGid)()
+
+	if inode.IType != '0' && inode.ILinks > 1 {
+		inode.ILinks--
+		inode.ICTime = Timestamp()
+		return inode.WriteInode(path, inodeStart, inodeStart+int64(sb.SInodeSize))
+	}
+
+	if inode.IType == '0' {
+		for _, entry := range sb.GetFolderEntries(path, inode) {
+			for _, nameBlock := range sb.nameBlocks(path, entry) {
+				if err := sb.FreeBlock(path, nameBlock); err != nil {
+					return err
+				}
+			}
+
+			if err := sb.releaseInode(path, entry.BInode); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, block := range sb.inodeBlocks(path, inode) {
+		if err := sb.FreeBlock(path, block); err != nil {
+			return err
+		}
+	}
+
+	return sb.FreeInode(path, index)
+}
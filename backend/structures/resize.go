@@ -0,0 +1,88 @@
+package structures
+
+import (
+	"backend/utils"
+	"fmt"
+)
+
+// ResizePartition grows the filesystem to fill its partition after the partition was enlarged.
+// Every area moves in place to its position in the layout for the new size, starting from the
+// end so no area is overwritten before it was moved: blocks, checksums, inodes, bitmaps and
+// last the journal, which keeps its start. Inode and block indexes are kept and the space an
+// area gains is cleared once its data was moved, so the new inodes and blocks are free. The
+// caller must write the superblock afterwards
+func (sb *SuperBlock) ResizePartition(path string, partition *Partition) error {
+	oldInodes := sb.InodeCapacity()
+	oldBlocks := sb.BlockCapacity()
+
+	opts := FormatOptions{
+		FsType:    sb.SFilesystemType,
+		Features:  sb.SFeatures,
+		BlockSize: sb.SBlockSize,
+		Ratio:     oldBlocks / oldInodes,
+	}
+
+	n := partition.CalculateN(opts)
+	if n < oldInodes {
+		return fmt.Errorf("partition is smaller than the filesystem, shrinking is not supported")
+	}
+	if n == oldInodes {
+		return fmt.Errorf("filesystem already fills the partition")
+	}
+
+	inodeBitmap, err := sb.ReadInodeBitmap(path)
+	if err != nil {
+		return err
+	}
+
+	blockBitmap, err := sb.ReadBlockBitmap(path)
+	if err != nil {
+		return err
+	}
+
+	resized := &SuperBlock{}
+	resized.CreateSuperBlock(partition.PartStart, n, opts)
+	resized.SMTime = sb.SMTime
+	resized.SUmTime = sb.SUmTime
+	resized.SMntCount = sb.SMntCount
+	resized.SJournalNext = sb.SJournalNext
+
+	areas := []struct {
+		from, to, size, end int32
+	}{
+		{sb.SBlockStart, resized.SBlockStart, sb.BlockEnd() - sb.SBlockStart, resized.BlockEnd()},
+		{sb.SChecksumStart, resized.SChecksumStart, sb.SBlockStart - sb.SChecksumStart, resized.SBlockStart},
+		{sb.SInodeStart, resized.SInodeStart, sb.SChecksumStart - sb.SInodeStart, resized.SChecksumStart},
+	}
+
+	for _, area := range areas {
+		if err := utils.MoveForward(path, int64(area.from), int64(area.to), int64(area.size)); err != nil {
+			return err
+		}
+
+		if err := utils.ZeroFill(path, int64(area.to+area.size), int64(area.end)); err != nil {
+			return err
+		}
+	}
+
+	for i := oldInodes; i < n; i++ {
+		inodeBitmap = append(inodeBitmap, InodeFree)
+	}
+	for i := oldBlocks; i < n*opts.Ratio; i++ {
+		blockBitmap = append(blockBitmap, BlockFree)
+	}
+
+	if err := resized.ReplaceBitmaps(path, inodeBitmap, blockBitmap); err != nil {
+		return err
+	}
+
+	// the journal gets one entry more per inode, they must read as unused
+	if sb.IsJournaling() {
+		if err := utils.ZeroFill(path, int64(sb.SBMInodeStart), int64(resized.SBMInodeStart)); err != nil {
+			return err
+		}
+	}
+
+	sb.SuperBlockData = resized.SuperBlockData
+	return nil
+}
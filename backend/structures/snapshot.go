@@ -0,0 +1,609 @@
+package structures
+
+import (
+	"backend/utils"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+// FeatureSnapshots is set while the partition has snapshots, block writes check it before
+// looking for blocks shared with a snapshot
+const FeatureSnapshots int32 = 1 << 4
+
+// SnapshotFile is the hidden file of the root folder that stores the snapshots
+const SnapshotFile = ".snapshots"
+
+// SnapshotNameSize is the longest snapshot name
+const SnapshotNameSize = 16
+
+// Snapshot freezes the state of the filesystem. It keeps a copy of every inode in use,
+// the root inode included, and shares the blocks in use with the filesystem. A shared
+// block is copied into the snapshot before the filesystem overwrites or frees it, so the
+// snapshot only grows with the blocks changed after it was taken
+type Snapshot struct {
+	ID     int32
+	Name   string
+	Time   int64
+	shared []byte // bitset of the blocks in use when the snapshot was taken
+	inodes map[int32][]byte
+	saved  map[int32]bool // shared blocks already copied
+}
+
+// Inodes returns the number of inodes kept by the snapshot
+func (s *Snapshot) Inodes() int {
+	return len(s.inodes)
+}
+
+// Blocks returns the number of blocks in use when the snapshot was taken
+func (s *Snapshot) Blocks() int {
+	count := 0
+	for _, b := range s.shared {
+		count += bits.OnesCount8(b)
+	}
+	return count
+}
+
+// Saved returns the number of shared blocks copied since the snapshot was taken
+func (s *Snapshot) Saved() int {
+	return len(s.saved)
+}
+
+// shares reports whether block was in use when the snapshot was taken
+func (s *Snapshot) shares(block int32) bool {
+	return int(block/8) < len(s.shared) && s.shared[block/8]&(1<<(block%8)) != 0
+}
+
+// snapshotHeader starts a snapshot in SnapshotFile, it is followed by the bitset of shared
+// blocks and by Inodes pairs of inode index and inode
+type snapshotHeader struct {
+	Kind   byte // 'S'
+	ID     int32
+	Name   [SnapshotNameSize]byte
+	Time   int64
+	Bits   int32
+	Inodes int32
+}
+
+// savedBlockHeader starts a copied block in SnapshotFile, it is followed by the ids of the
+// Owners snapshots that share the copy and by the content of the block
+type savedBlockHeader struct {
+	Kind     byte // 'B'
+	Block    int32
+	Checksum uint32 // entry of the block in the checksum table
+	Owners   int32
+}
+
+type savedBlock struct {
+	savedBlockHeader
+	owners  []int32
+	content []byte
+}
+
+// owned reports whether the copy belongs to the snapshot with the given id
+func (b *savedBlock) owned(id int32) bool {
+	for _, owner := range b.owners {
+		if owner == id {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshotStore is the content of SnapshotFile, a log of snapshots and copied blocks
+type snapshotStore struct {
+	index     int32 // inode of SnapshotFile
+	snapshots []*Snapshot
+	blocks    []*savedBlock
+}
+
+// find returns the position of the snapshot with the given name, or -1
+func (st *snapshotStore) find(name string) int {
+	for i, s := range st.snapshots {
+		if s.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// addBlock adds a copied block, its owners no longer share the block
+func (st *snapshotStore) addBlock(b *savedBlock) {
+	for _, s := range st.snapshots {
+		if b.owned(s.ID) {
+			s.saved[b.Block] = true
+		}
+	}
+	st.blocks = append(st.blocks, b)
+}
+
+// keep drops the snapshots keep rejects and the copies no snapshot owns anymore
+func (st *snapshotStore) keep(keep func(*Snapshot) bool) {
+	ids := make(map[int32]bool)
+	var snapshots []*Snapshot
+	for _, s := range st.snapshots {
+		if keep(s) {
+			snapshots = append(snapshots, s)
+			ids[s.ID] = true
+		}
+	}
+	st.snapshots = snapshots
+
+	var blocks []*savedBlock
+	for _, b := range st.blocks {
+		var owners []int32
+		for _, owner := range b.owners {
+			if ids[owner] {
+				owners = append(owners, owner)
+			}
+		}
+
+		if len(owners) > 0 {
+			b.owners = owners
+			b.Owners = int32(len(owners))
+			blocks = append(blocks, b)
+		}
+	}
+	st.blocks = blocks
+}
+
+// unshare forgets the copies of the snapshot, it shares every block again
+func (st *snapshotStore) unshare(s *Snapshot) {
+	for _, b := range st.blocks {
+		for i, owner := range b.owners {
+			if owner == s.ID {
+				b.owners = append(b.owners[:i:i], b.owners[i+1:]...)
+				b.Owners--
+				break
+			}
+		}
+	}
+	s.saved = make(map[int32]bool)
+	st.keep(func(*Snapshot) bool { return true })
+}
+
+func encodeSnapshot(s *Snapshot) []byte {
+	header := snapshotHeader{Kind: 'S', ID: s.ID, Time: s.Time, Bits: int32(len(s.shared) * 8), Inodes: int32(len(s.inodes))}
+	copy(header.Name[:], s.Name)
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, header)
+	buf.Write(s.shared)
+
+	indexes := make([]int32, 0, len(s.inodes))
+	for index := range s.inodes {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+	for _, index := range indexes {
+		binary.Write(&buf, binary.LittleEndian, index)
+		buf.Write(s.inodes[index])
+	}
+
+	return buf.Bytes()
+}
+
+func encodeSavedBlock(b *savedBlock) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, b.savedBlockHeader)
+	binary.Write(&buf, binary.LittleEndian, b.owners)
+	buf.Write(b.content)
+	return buf.Bytes()
+}
+
+// encode returns the content of SnapshotFile, every copy follows the snapshots that own it
+func (st *snapshotStore) encode() []byte {
+	var buf bytes.Buffer
+	for _, s := range st.snapshots {
+		buf.Write(encodeSnapshot(s))
+	}
+	for _, b := range st.blocks {
+		buf.Write(encodeSavedBlock(b))
+	}
+	return buf.Bytes()
+}
+
+// parseSnapshotStore reads the content of SnapshotFile
+func (sb *SuperBlock) parseSnapshotStore(data []byte) (*snapshotStore, error) {
+	st := &snapshotStore{}
+	reader := bytes.NewReader(data)
+	invalid := fmt.Errorf("%s is corrupted", SnapshotFile)
+
+	for reader.Len() > 0 {
+		kind, _ := reader.ReadByte()
+		reader.UnreadByte()
+
+		switch kind {
+		case 'S':
+			var header snapshotHeader
+			if err := binary.Read(reader, binary.LittleEndian, &header); err != nil || header.Bits < 0 || int((header.Bits+7)/8) > reader.Len() {
+				return nil, invalid
+			}
+
+			s := &Snapshot{
+				ID:     header.ID,
+				Name:   strings.TrimRight(string(header.Name[:]), "\x00"),
+				Time:   header.Time,
+				shared: make([]byte, (header.Bits+7)/8),
+				inodes: make(map[int32][]byte),
+				saved:  make(map[int32]bool),
+			}
+			if _, err := io.ReadFull(reader, s.shared); err != nil {
+				return nil, invalid
+			}
+
+			for i := int32(0); i < header.Inodes; i++ {
+				var index int32
+				inode := make([]byte, sb.SInodeSize)
+				if err := binary.Read(reader, binary.LittleEndian, &index); err != nil {
+					return nil, invalid
+				}
+				if _, err := io.ReadFull(reader, inode); err != nil {
+					return nil, invalid
+				}
+				s.inodes[index] = inode
+			}
+
+			st.snapshots = append(st.snapshots, s)
+		case 'B':
+			b := &savedBlock{}
+			if err := binary.Read(reader, binary.LittleEndian, &b.savedBlockHeader); err != nil || b.Owners < 0 || int(b.Owners) > reader.Len() {
+				return nil, invalid
+			}
+
+			b.owners = make([]int32, b.Owners)
+			b.content = make([]byte, sb.SBlockSize)
+			if err := binary.Read(reader, binary.LittleEndian, b.owners); err != nil {
+				return nil, invalid
+			}
+			if _, err := io.ReadFull(reader, b.content); err != nil {
+				return nil, invalid
+			}
+
+			st.addBlock(b)
+		default:
+			// the last block is zero past the last record
+			if strings.Trim(string(data[len(data)-reader.Len():]), "\x00") != "" {
+				return nil, invalid
+			}
+			return st, nil
+		}
+	}
+
+	return st, nil
+}
+
+// readSnapshotStore returns the snapshots of the partition, nil when it has none. The
+// store is read once and cached on the superblock for the rest of the command
+func (sb *SuperBlock) readSnapshotStore(path string) (*snapshotStore, error) {
+	if sb.snapshotsRead {
+		return sb.snapshots, nil
+	}
+
+	index := sb.getInodeReference(path, 0, []string{SnapshotFile})
+	if index == -1 {
+		return nil, sb.cacheSnapshotStore(nil, nil)
+	}
+
+	inode := &Inode{}
+	if err := inode.ReadInode(path, int64(sb.SInodeStart+index*sb.SInodeSize)); err != nil {
+		return nil, err
+	}
+
+	st, err := sb.parseSnapshotStore([]byte(sb.getFileContent(path, inode)))
+	if err != nil {
+		return nil, err
+	}
+
+	st.index = index
+	return st, sb.cacheSnapshotStore(st, nil)
+}
+
+// cacheSnapshotStore keeps st as the content of SnapshotFile once err shows it was read or
+// written, a failed write drops the cache so the next read goes back to the disk
+func (sb *SuperBlock) cacheSnapshotStore(st *snapshotStore, err error) error {
+	if err != nil {
+		st = nil
+	}
+
+	sb.snapshots = st
+	sb.snapshotsRead = err == nil
+	return err
+}
+
+// writeSnapshotStore runs write with copy on write and the quota turned off, snapshots
+// belong to the filesystem and not to the user of the command. The blocks of SnapshotFile
+// are never shared, they were free or part of SnapshotFile when every snapshot was taken
+func (sb *SuperBlock) writeSnapshotStore(write func() error) error {
+	sb.snapshotWriting = true
+	defer func() { sb.snapshotWriting = false }()
+
+	return write()
+}
+
+// appendSnapshotStore adds data at the end of SnapshotFile, st already holds the record
+// data encodes
+func (sb *SuperBlock) appendSnapshotStore(path string, st *snapshotStore, data []byte) error {
+	return sb.cacheSnapshotStore(st, sb.writeSnapshotStore(func() error {
+		inode := &Inode{}
+		if err := inode.ReadInode(path, int64(sb.SInodeStart+st.index*sb.SInodeSize)); err != nil {
+			return err
+		}
+
+		_, err := sb.writeFileAt(path, inode, st.index, int(inode.ISize), string(data))
+		return err
+	}))
+}
+
+// rewriteSnapshotStore replaces the content of SnapshotFile with st. Its blocks are freed
+// first unless free is false because the bitmaps already mark them free
+func (sb *SuperBlock) rewriteSnapshotStore(path string, st *snapshotStore, free bool) error {
+	return sb.cacheSnapshotStore(st, sb.writeSnapshotStore(func() error {
+		inode := &Inode{}
+		inodeStart := int64(sb.SInodeStart + st.index*sb.SInodeSize)
+		if err := inode.ReadInode(path, inodeStart); err != nil {
+			return err
+		}
+
+		if free {
+			for _, block := range sb.inodeBlocks(path, inode) {
+				if block == inode.IXattr {
+					continue
+				}
+				if err := sb.FreeBlock(path, block); err != nil {
+					return err
+				}
+			}
+		}
+
+		for i := range inode.IBlock {
+			inode.IBlock[i] = -1
+		}
+		inode.IFlags &^= InodeInline
+		inode.ISize = 0
+		inode.IMTime = Timestamp()
+		if err := inode.WriteInode(path, inodeStart, inodeStart+int64(sb.SInodeSize)); err != nil {
+			return err
+		}
+
+		_, err := sb.writeFileAt(path, inode, st.index, 0, string(st.encode()))
+		return err
+	}))
+}
+
+// copyOnWrite is called before the block stored at offset is overwritten or freed, the
+// snapshots that still share the block get a copy of its current content first
+func (sb *SuperBlock) copyOnWrite(path string, offset int64) error {
+	if sb == nil || !sb.HasFeature(FeatureSnapshots) || sb.snapshotWriting {
+		return nil
+	}
+
+	relative := offset - int64(sb.SBlockStart)
+	if relative < 0 || relative%int64(sb.SBlockSize) != 0 || relative/int64(sb.SBlockSize) >= int64(sb.BlockCapacity()) {
+		return nil
+	}
+	block := int32(relative / int64(sb.SBlockSize))
+
+	st, err := sb.readSnapshotStore(path)
+	if err != nil || st == nil {
+		return err
+	}
+
+	saved := &savedBlock{savedBlockHeader: savedBlockHeader{Kind: 'B', Block: block}}
+	for _, s := range st.snapshots {
+		if s.shares(block) && !s.saved[block] {
+			saved.owners = append(saved.owners, s.ID)
+		}
+	}
+	if len(saved.owners) == 0 {
+		return nil
+	}
+	saved.Owners = int32(len(saved.owners))
+
+	saved.content = make([]byte, sb.SBlockSize)
+	if err := utils.ReadFromFile(path, offset, saved.content); err != nil {
+		return err
+	}
+	if err := utils.ReadFromFile(path, int64(sb.SChecksumStart)+int64(block)*4, &saved.Checksum); err != nil {
+		return err
+	}
+
+	st.addBlock(saved)
+	return sb.appendSnapshotStore(path, st, encodeSavedBlock(saved))
+}
+
+// ListSnapshots returns the snapshots of the partition in the order they were taken
+func (sb *SuperBlock) ListSnapshots(path string) ([]*Snapshot, error) {
+	st, err := sb.readSnapshotStore(path)
+	if err != nil || st == nil {
+		return nil, err
+	}
+	return st.snapshots, nil
+}
+
+// CreateSnapshot takes a snapshot of the filesystem, SnapshotFile is created owned by root
+// the first time. Inodes in use are copied, blocks in use are only marked as shared
+func (sb *SuperBlock) CreateSnapshot(path, name string) (*Snapshot, error) {
+	if name == "" || len(name) > SnapshotNameSize || strings.ContainsAny(name, "\x00/") {
+		return nil, fmt.Errorf("invalid snapshot name: %s", name)
+	}
+
+	st, err := sb.readSnapshotStore(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if st == nil {
+		root := &Credentials{UID: RootUID, GID: 1}
+		if err := sb.CreateNewInode(path, []string{SnapshotFile}, 0, true, false, root); err != nil {
+			return nil, err
+		}
+
+		st = &snapshotStore{index: sb.getInodeReference(path, 0, []string{SnapshotFile})}
+		if st.index == -1 {
+			return nil, fmt.Errorf("cannot create /%s", SnapshotFile)
+		}
+
+		inode := &Inode{}
+		inodeStart := int64(sb.SInodeStart + st.index*sb.SInodeSize)
+		if err := inode.ReadInode(path, inodeStart); err != nil {
+			return nil, err
+		}
+
+		inode.IPerm = [3]byte{'6', '0', '0'}
+		if err := inode.WriteInode(path, inodeStart, inodeStart+int64(sb.SInodeSize)); err != nil {
+			return nil, err
+		}
+	}
+
+	if st.find(name) != -1 {
+		return nil, fmt.Errorf("snapshot already exists: %s", name)
+	}
+
+	snapshot := &Snapshot{ID: 1, Name: name, Time: Timestamp(), inodes: make(map[int32][]byte), saved: make(map[int32]bool)}
+	for _, s := range st.snapshots {
+		snapshot.ID = max(snapshot.ID, s.ID+1)
+	}
+
+	inodeBitmap, err := sb.ReadInodeBitmap(path)
+	if err != nil {
+		return nil, err
+	}
+
+	blockBitmap, err := sb.ReadBlockBitmap(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, state := range inodeBitmap {
+		index := int32(i)
+		if state != InodeUsed || index == st.index {
+			continue
+		}
+
+		inode := make([]byte, sb.SInodeSize)
+		if err := utils.ReadFromFile(path, int64(sb.SInodeStart+index*sb.SInodeSize), inode); err != nil {
+			return nil, err
+		}
+		snapshot.inodes[index] = inode
+	}
+
+	store := &Inode{}
+	if err := store.ReadInode(path, int64(sb.SInodeStart+st.index*sb.SInodeSize)); err != nil {
+		return nil, err
+	}
+
+	// blocks of SnapshotFile are never shared, it is not part of any snapshot
+	own := make(map[int32]bool)
+	for _, block := range sb.inodeBlocks(path, store) {
+		own[block] = true
+	}
+
+	snapshot.shared = make([]byte, (len(blockBitmap)+7)/8)
+	for i, state := range blockBitmap {
+		if state == BlockUsed && !own[int32(i)] {
+			snapshot.shared[i/8] |= 1 << (i % 8)
+		}
+	}
+
+	sb.SFeatures |= FeatureSnapshots
+	st.snapshots = append(st.snapshots, snapshot)
+	if err := sb.appendSnapshotStore(path, st, encodeSnapshot(snapshot)); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// RollbackSnapshot brings the filesystem back to the state of the snapshot. The copied
+// blocks and inodes are written back and the bitmaps are the ones of the snapshot, the
+// snapshots taken after it are deleted and it shares every block again
+func (sb *SuperBlock) RollbackSnapshot(path, name string) error {
+	st, err := sb.readSnapshotStore(path)
+	if err != nil {
+		return err
+	}
+
+	position := -1
+	if st != nil {
+		position = st.find(name)
+	}
+	if position == -1 {
+		return fmt.Errorf("snapshot not found: %s", name)
+	}
+	snapshot := st.snapshots[position]
+
+	for _, b := range st.blocks {
+		if !b.owned(snapshot.ID) {
+			continue
+		}
+
+		offset := int64(sb.SBlockStart + b.Block*sb.SBlockSize)
+		if err := utils.WriteToFile(path, offset, offset+int64(sb.SBlockSize), b.content); err != nil {
+			return err
+		}
+
+		at := int64(sb.SChecksumStart) + int64(b.Block)*4
+		if err := utils.WriteToFile(path, at, at+4, b.Checksum); err != nil {
+			return err
+		}
+	}
+
+	for index, inode := range snapshot.inodes {
+		offset := int64(sb.SInodeStart + index*sb.SInodeSize)
+		if err := utils.WriteToFile(path, offset, offset+int64(sb.SInodeSize), inode); err != nil {
+			return err
+		}
+	}
+
+	inodeBitmap := bytes.Repeat([]byte{InodeFree}, int(sb.InodeCapacity()))
+	for index := range snapshot.inodes {
+		inodeBitmap[index] = InodeUsed
+	}
+	inodeBitmap[st.index] = InodeUsed
+
+	blockBitmap := bytes.Repeat([]byte{BlockFree}, int(sb.BlockCapacity()))
+	for i := range blockBitmap {
+		if snapshot.shares(int32(i)) {
+			blockBitmap[i] = BlockUsed
+		}
+	}
+
+	// the blocks of SnapshotFile are free in the bitmaps of the snapshot
+	if err := sb.ReplaceBitmaps(path, inodeBitmap, blockBitmap); err != nil {
+		return err
+	}
+
+	st.keep(func(s *Snapshot) bool { return s.ID <= snapshot.ID })
+	st.unshare(snapshot)
+
+	return sb.rewriteSnapshotStore(path, st, false)
+}
+
+// DeleteSnapshot drops the snapshot and the copies only it owned, SnapshotFile is removed
+// with the last snapshot
+func (sb *SuperBlock) DeleteSnapshot(path, name string) error {
+	st, err := sb.readSnapshotStore(path)
+	if err != nil {
+		return err
+	}
+
+	if st == nil || st.find(name) == -1 {
+		return fmt.Errorf("snapshot not found: %s", name)
+	}
+
+	st.keep(func(s *Snapshot) bool { return s.Name != name })
+	if len(st.snapshots) > 0 {
+		return sb.rewriteSnapshotStore(path, st, true)
+	}
+
+	sb.SFeatures &^= FeatureSnapshots
+	return sb.cacheSnapshotStore(nil, sb.writeSnapshotStore(func() error {
+		return sb.removeEntry(path, 0, SnapshotFile)
+	}))
+}
@@ -0,0 +1,66 @@
+package structures
+
+import (
+	"testing"
+)
+
+func TestSnapshotRollback(t *testing.T) {
+	path, sb := formatDisk(t, 200*1024, DefaultFormatOptions())
+
+	createFile(t, sb, path, "/docs/a.txt", "before", root)
+	createFile(t, sb, path, "/docs/keep.txt", "kept", root)
+
+	if _, err := sb.CreateSnapshot(path, "s1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sb.WriteFile(path, 0, SplitPath("/docs/a.txt"), "after, and longer than a single block of the file"); err != nil {
+		t.Fatal(err)
+	}
+	createFile(t, sb, path, "/docs/new.txt", "new", root)
+	if err := sb.RemovePath(path, SplitPath("/docs/keep.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sb.CreateSnapshot(path, "s2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sb.RollbackSnapshot(path, "s1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if content := sb.GetFile(path, 0, SplitPath("/docs/a.txt")); content != "before" {
+		t.Errorf("/docs/a.txt has %q after the rollback, want %q", content, "before")
+	}
+	if content := sb.GetFile(path, 0, SplitPath("/docs/keep.txt")); content != "kept" {
+		t.Errorf("/docs/keep.txt has %q after the rollback, want %q", content, "kept")
+	}
+	if index := sb.GetInodeReference(path, 0, SplitPath("/docs/new.txt")); index != -1 {
+		t.Errorf("/docs/new.txt is inode %d after the rollback", index)
+	}
+
+	// the snapshots taken after s1 are gone
+	snapshots, err := sb.ListSnapshots(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Name != "s1" {
+		t.Errorf("%d snapshots left after the rollback, want s1 only", len(snapshots))
+	}
+
+	checkClean(t, sb, path)
+
+	// s1 still holds the state it was taken in
+	if _, err := sb.WriteFile(path, 0, SplitPath("/docs/a.txt"), "again"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sb.RollbackSnapshot(path, "s1"); err != nil {
+		t.Fatal(err)
+	}
+	if content := sb.GetFile(path, 0, SplitPath("/docs/a.txt")); content != "before" {
+		t.Errorf("/docs/a.txt has %q after the second rollback, want %q", content, "before")
+	}
+
+	checkClean(t, sb, path)
+}
@@ -3,19 +3,37 @@ package structures
 import (
 	"backend/utils"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 )
 
+// SuperBlock is the superblock of a partition together with the state of the command
+// that uses it, only SuperBlockData is stored on disk
 type SuperBlock struct {
+	SuperBlockData
+
+	// quota is charged by UpdateBitmapInode and UpdateBitmapBlock, StartQuota sets it
+	// for the duration of a command. quotaOwner is the uid and gid charged, see chargeTo
+	quota      []*quotaTarget
+	quotaOwner Credentials
+	// snapshotWriting turns copy on write and the quota off while writeSnapshotStore runs
+	snapshotWriting bool
+	// snapshots caches SnapshotFile once read, copy on write looks at it before every block
+	// write or free. snapshotsRead tells a partition without snapshots from an unread cache
+	snapshots     *snapshotStore
+	snapshotsRead bool
+}
+
+type SuperBlockData struct {
 	SFilesystemType int32
 	SInodesCount    int32
 	SBlocksCount    int32
 	SFreeInodeCount int32
 	SFreeBlockCount int32
-	SMTime          float32
-	SUmTime         float32
+	SMTime          int64
+	SUmTime         int64
 	SMntCount       int32
 	SMagic          int32
 	SInodeSize      int32
@@ -26,53 +44,164 @@ type SuperBlock struct {
 	SBMInodeStart   int32
 	SInodeStart     int32
 	SBlockStart     int32
-	// Total size of the SuperBlock is 68 bytes
+	SFeatures       int32
+	SRevision       int32
+	SChecksumStart  int32 // table with the checksum of every metadata block
+	SJournalNext    int32 // slot of the next journal entry
+	SChecksum       uint32
+	// Total size of the SuperBlockData is 96 bytes
+}
+
+// CurrentRevision is the on-disk format written by mkfs. Revision 0 is the original
+// layout, revision 1 stores times as int64 nanoseconds and adds link counts, feature
+// flags, directory indexes, extended attributes, inode flags, checksums and journal
+// entries that keep their lengths
+const CurrentRevision int32 = 1
+
+// ErrLegacyFormat is returned by ReadSuperBlock for partitions that need migrate
+var ErrLegacyFormat = errors.New("partition uses an older format revision, run migrate first")
+
+// FeatureLongNames allows folder entries with names longer than 12 bytes
+const FeatureLongNames int32 = 1 << 0
+
+// FeatureDirIndex gives big folders a hashed index for name lookups
+const FeatureDirIndex int32 = 1 << 1
+
+// FeatureInlineData stores files up to InlineDataSize bytes in their inode
+const FeatureInlineData int32 = 1 << 2
+
+// FormatOptions are the layout choices made when a partition is formatted
+type FormatOptions struct {
+	FsType    int32
+	Features  int32
+	BlockSize int32
+	Ratio     int32 // blocks per inode
 }
 
-func (sb *SuperBlock) CreateSuperBlock(partitionStart int32, n int32) {
+// DefaultFormatOptions returns the classic layout: EXT2, 64-byte blocks, 3 blocks per inode
+func DefaultFormatOptions() FormatOptions {
+	return FormatOptions{FsType: 2, BlockSize: 64, Ratio: 3}
+}
+
+func (sb *SuperBlock) CreateSuperBlock(partitionStart int32, n int32, opts FormatOptions) {
+	//Journal
+	journalSize := int32(0)
+	if opts.FsType == 3 {
+		journalSize = n * int32(binary.Size(Journal{}))
+	}
+
 	//Bitmaps
-	bmInodeStart := partitionStart + int32(binary.Size(sb))
+	bmInodeStart := partitionStart + sb.Size() + journalSize
 	bmBlockStart := bmInodeStart + n
 
 	//Inodes
-	inodeStart := bmBlockStart + (3 * n)
+	inodeStart := bmBlockStart + (opts.Ratio * n)
+
+	//Checksums
+	checksumStart := inodeStart + (int32(binary.Size(Inode{})) * n)
 
 	//Blocks
-	blockStart := inodeStart + (int32(binary.Size(Inode{})) * n)
+	blockStart := checksumStart + (4 * opts.Ratio * n)
 
-	sb.SFilesystemType = 2
+	sb.SFilesystemType = opts.FsType
 	sb.SInodesCount = 0
 	sb.SBlocksCount = 0
 	sb.SFreeInodeCount = n
-	sb.SFreeBlockCount = n * 3
-	sb.SMTime = float32(time.Now().Unix())
-	sb.SUmTime = float32(time.Now().Unix())
+	sb.SFreeBlockCount = n * opts.Ratio
+	sb.SMTime = Timestamp()
+	sb.SUmTime = Timestamp()
 	sb.SMntCount = 1
 	sb.SMagic = 0xEF53
 	sb.SInodeSize = int32(binary.Size(Inode{}))
-	sb.SBlockSize = int32(binary.Size(FileBlock{}))
+	sb.SBlockSize = opts.BlockSize
 	sb.SFirstIno = inodeStart
 	sb.SFirstBlo = blockStart
 	sb.SBMInodeStart = bmInodeStart
 	sb.SBMBlockStart = bmBlockStart
 	sb.SInodeStart = inodeStart
 	sb.SBlockStart = blockStart
+	sb.SFeatures = opts.Features
+	sb.SRevision = CurrentRevision
+	sb.SChecksumStart = checksumStart
+}
+
+// HasFeature reports whether the filesystem was formatted with the given feature
+func (sb *SuperBlock) HasFeature(feature int32) bool {
+	return sb.SFeatures&feature != 0
+}
+
+// InodeCapacity returns the total number of inodes, one per byte of the inode bitmap
+func (sb *SuperBlock) InodeCapacity() int32 {
+	return sb.SBMBlockStart - sb.SBMInodeStart
+}
+
+// BlockCapacity returns the total number of blocks, one per byte of the block bitmap
+func (sb *SuperBlock) BlockCapacity() int32 {
+	return sb.SInodeStart - sb.SBMBlockStart
+}
+
+// BlockEnd returns the offset right after the last block of the filesystem
+func (sb *SuperBlock) BlockEnd() int32 {
+	return sb.SBlockStart + sb.BlockCapacity()*sb.SBlockSize
+}
+
+// Size returns the space the superblock takes on disk
+func (sb *SuperBlock) Size() int32 {
+	return int32(binary.Size(sb.SuperBlockData))
 }
 
 func (sb *SuperBlock) WriteSuperBlock(path string, offset int64, maxSize int64) error {
-	if err := utils.WriteToFile(path, offset, maxSize, sb); err != nil {
+	sb.SChecksum = sb.checksum()
+	if err := utils.WriteToFile(path, offset, maxSize, &sb.SuperBlockData); err != nil {
 		return err
 	}
 	return nil
 }
 
 func (sb *SuperBlock) ReadSuperBlock(path string, offset int64) error {
-	if err := utils.ReadFromFile(path, offset, sb); err != nil {
+	if err := utils.ReadFromFile(path, offset, &sb.SuperBlockData); err != nil {
 		return err
 	}
+
+	if sb.SMagic != 0xEF53 && isLegacySuperBlock(path, offset) {
+		return ErrLegacyFormat
+	}
+
+	if sb.SMagic == 0xEF53 && sb.SChecksum != sb.checksum() {
+		return &CorruptionError{Structure: "superblock", Offset: offset}
+	}
 	return nil
 }
 
+// Reinitialize clears bitmaps, inode table and blocks and recreates root and users.txt,
+// the superblock layout and the journal are kept
+func (sb *SuperBlock) Reinitialize(path string) error {
+	sb.SInodesCount = 0
+	sb.SBlocksCount = 0
+	sb.SFreeInodeCount = sb.InodeCapacity()
+	sb.SFreeBlockCount = sb.BlockCapacity()
+	sb.SFirstIno = sb.SInodeStart
+	sb.SFirstBlo = sb.SBlockStart
+
+	if err := utils.ZeroFill(path, int64(sb.SInodeStart), int64(sb.BlockEnd())); err != nil {
+		return err
+	}
+	// the cleared partition has no snapshots
+	sb.cacheSnapshotStore(nil, nil)
+
+	if err := sb.CreateBitMaps(path); err != nil {
+		return err
+	}
+
+	return sb.CreateUserFile(path)
+}
+
+// SimulateLoss zero-fills both bitmaps, the inode table and the blocks,
+// the superblock and the journal are left untouched
+func (sb *SuperBlock) SimulateLoss(path string) error {
+	return utils.ZeroFill(path, int64(sb.SBMInodeStart), int64(sb.BlockEnd()))
+}
+
 func (sb *SuperBlock) CreateUserFile(path string) error {
 	if err := sb.createRootInodeAndBlock(path); err != nil {
 		return err
@@ -87,7 +216,7 @@ func (sb *SuperBlock) CreateUserFile(path string) error {
 
 func (sb *SuperBlock) createRootInodeAndBlock(path string) error {
 	rootInode := &Inode{}
-	rootInode.DefaultValue(sb.SBlocksCount)
+	rootInode.DefaultValue(sb.NextBlockIndex())
 
 	if err := rootInode.WriteInode(path, int64(sb.SFirstIno), int64(sb.SFirstIno+sb.SInodeSize)); err != nil {
 		return err
@@ -97,8 +226,7 @@ func (sb *SuperBlock) createRootInodeAndBlock(path string) error {
 		return err
 	}
 
-	rootBlock := &FolderBlock{}
-	rootBlock.DefaultValue()
+	rootBlock := sb.NewFolderBlock()
 
 	if err := rootBlock.WriteFolderBlock(path, int64(sb.SFirstBlo), int64(sb.SFirstBlo+sb.SBlockSize)); err != nil {
 		return err
@@ -118,35 +246,40 @@ func (sb *SuperBlock) createRootInodeAndBlock(path string) error {
 }
 
 func (sb *SuperBlock) createUsersFile(path string) error {
-	usersText := "1,G,root\n1,U,root,root,123\n"
+	usersText := "1,G,root\n1,U,root,root,123,1\n"
 
 	rootInode := &Inode{}
 	if err := rootInode.ReadInode(path, int64(sb.SInodeStart+0)); err != nil {
 		return err
 	}
 
-	rootInode.IAtime = float32(time.Now().Unix())
+	rootInode.IAtime = Timestamp()
 
 	if err := rootInode.WriteInode(path, int64(sb.SInodeStart+0), int64(sb.SInodeStart+sb.SInodeSize)); err != nil {
 		return err
 	}
 
-	rootBlock := &FolderBlock{}
+	rootBlock := sb.NewFolderBlock()
 	if err := rootBlock.ReadFolderBlock(path, int64(sb.SBlockStart+0)); err != nil {
 		return err
 	}
 
-	rootBlock.BContent[2] = FolderContent{BName: [12]byte{'u', 's', 'e', 'r', 's', '.', 't', 'x', 't'}, BInode: sb.SInodesCount}
+	rootBlock.BContent[2] = FolderContent{BName: [12]byte{'u', 's', 'e', 'r', 's', '.', 't', 'x', 't'}, BInode: sb.NextInodeIndex()}
 
 	if err := rootBlock.WriteFolderBlock(path, int64(sb.SBlockStart+0), int64(sb.SBlockStart+sb.SBlockSize)); err != nil {
 		return err
 	}
 
 	usersInode := &Inode{}
-	usersInode.DefaultValue(sb.SBlocksCount)
+	usersInode.DefaultValue(sb.NextBlockIndex())
 	usersInode.ISize = int32(len(usersText))
 	usersInode.IType = '1'
 
+	inline := sb.HasFeature(FeatureInlineData) && len(usersText) <= InlineDataSize
+	if inline {
+		usersInode.SetInlineData([]byte(usersText))
+	}
+
 	if err := usersInode.WriteInode(path, int64(sb.SFirstIno), int64(sb.SFirstIno+sb.SInodeSize)); err != nil {
 		return err
 	}
@@ -155,8 +288,12 @@ func (sb *SuperBlock) createUsersFile(path string) error {
 		return err
 	}
 
-	usersBlock := &FileBlock{}
-	copy(usersBlock.BContent[:], usersText)
+	if inline {
+		return nil
+	}
+
+	usersBlock := sb.NewFileBlock()
+	copy(usersBlock.BContent, usersText)
 
 	if err := usersBlock.WriteFileBlock(path, int64(sb.SFirstBlo), int64(sb.SFirstBlo+sb.SBlockSize)); err != nil {
 		return err
@@ -175,8 +312,8 @@ func (sb *SuperBlock) Print() {
 	fmt.Printf("SBlocksCount: %d\n", sb.SBlocksCount)
 	fmt.Printf("SFreeInodeCount: %d\n", sb.SFreeInodeCount)
 	fmt.Printf("SFreeBlockCount: %d\n", sb.SFreeBlockCount)
-	fmt.Printf("SMTime: %s\n", time.Unix(int64(sb.SMTime), 0))
-	fmt.Printf("SUMTime: %s\n", time.Unix(int64(sb.SUmTime), 0))
+	fmt.Printf("SMTime: %s\n", time.Unix(0, sb.SMTime))
+	fmt.Printf("SUMTime: %s\n", time.Unix(0, sb.SUmTime))
 	fmt.Printf("SMntCount: %d\n", sb.SMntCount)
 	fmt.Printf("SMagic: %d\n", sb.SMagic)
 	fmt.Printf("SInodeSize: %d\n", sb.SInodeSize)
@@ -187,6 +324,11 @@ func (sb *SuperBlock) Print() {
 	fmt.Printf("SBMInodeStart: %d\n", sb.SBMInodeStart)
 	fmt.Printf("SInodeStart: %d\n", sb.SInodeStart)
 	fmt.Printf("SBlockStart: %d\n", sb.SBlockStart)
+	fmt.Printf("SFeatures: %d\n", sb.SFeatures)
+	fmt.Printf("SRevision: %d\n", sb.SRevision)
+	fmt.Printf("SChecksumStart: %d\n", sb.SChecksumStart)
+	fmt.Printf("SJournalNext: %d\n", sb.SJournalNext)
+	fmt.Printf("SChecksum: %08x\n", sb.SChecksum)
 }
 
 func (sb *SuperBlock) GetStringBuilder() string {
@@ -201,8 +343,8 @@ func (sb *SuperBlock) GetStringBuilder() string {
 	stringB.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">Blocks Count</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%d</TD></TR>\n", "#DDDDDD", "#DDDDDD", sb.SBlocksCount))
 	stringB.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">Free Inode Count</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%d</TD></TR>\n", "#FFFFFF", "#FFFFFF", sb.SFreeInodeCount))
 	stringB.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">Free Block Count</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%d</TD></TR>\n", "#DDDDDD", "#DDDDDD", sb.SFreeBlockCount))
-	stringB.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">MTime</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%s</TD></TR>\n", "#FFFFFF", "#FFFFFF", time.Unix(int64(sb.SMTime), 0).Format("02-Jan-2006 03:04 PM")))
-	stringB.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">UMTime</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%s</TD></TR>\n", "#DDDDDD", "#DDDDDD", time.Unix(int64(sb.SUmTime), 0).Format("02-Jan-2006 03:04 PM")))
+	stringB.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">MTime</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%s</TD></TR>\n", "#FFFFFF", "#FFFFFF", time.Unix(0, sb.SMTime).Format("02-Jan-2006 03:04 PM")))
+	stringB.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">UMTime</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%s</TD></TR>\n", "#DDDDDD", "#DDDDDD", time.Unix(0, sb.SUmTime).Format("02-Jan-2006 03:04 PM")))
 	stringB.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">MntCount</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%d</TD></TR>\n", "#FFFFFF", "#FFFFFF", sb.SMntCount))
 	stringB.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">Magic</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%d</TD></TR>\n", "#DDDDDD", "#DDDDDD", sb.SMagic))
 	stringB.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">Inode Size</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%d</TD></TR>\n", "#FFFFFF", "#FFFFFF", sb.SInodeSize))
@@ -213,6 +355,11 @@ func (sb *SuperBlock) GetStringBuilder() string {
 	stringB.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">BMInode Start</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%d</TD></TR>\n", "#DDDDDD", "#DDDDDD", sb.SBMInodeStart))
 	stringB.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">Inode Start</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%d</TD></TR>\n", "#FFFFFF", "#FFFFFF", sb.SInodeStart))
 	stringB.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">Block Start</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%d</TD></TR>\n", "#DDDDDD", "#DDDDDD", sb.SBlockStart))
+	stringB.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">Features</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%d</TD></TR>\n", "#FFFFFF", "#FFFFFF", sb.SFeatures))
+	stringB.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">Revision</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%d</TD></TR>\n", "#DDDDDD", "#DDDDDD", sb.SRevision))
+	stringB.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">Checksum Start</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%d</TD></TR>\n", "#FFFFFF", "#FFFFFF", sb.SChecksumStart))
+	stringB.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">Journal Next</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%d</TD></TR>\n", "#DDDDDD", "#DDDDDD", sb.SJournalNext))
+	stringB.WriteString(fmt.Sprintf("<TR><TD WIDTH=\"150\" BGCOLOR=\"%s\">Checksum</TD><TD WIDTH=\"250\" BGCOLOR=\"%s\">%08x</TD></TR>\n", "#FFFFFF", "#FFFFFF", sb.SChecksum))
 
 	return stringB.String()
 }
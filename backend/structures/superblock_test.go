@@ -0,0 +1,133 @@
+package structures
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// root and user are the credentials tests create files with, user is in a group of its own
+var (
+	root = &Credentials{UID: RootUID, GID: 1}
+	user = &Credentials{UID: 2, GID: 2}
+)
+
+// formatDisk creates a disk of size bytes with one partition filling it and formats the
+// partition with opts the way mkfs does, it returns the disk path and the superblock
+func formatDisk(t *testing.T, size int32, opts FormatOptions) (string, *SuperBlock) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "disk.mia")
+	if err := os.WriteFile(path, make([]byte, size), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	mbr := &MBR{}
+	if err := mbr.CreateMBR(int(size), "F"); err != nil {
+		t.Fatal(err)
+	}
+
+	start := int32(binary.Size(mbr))
+	partition := &mbr.MbrPartition[0]
+	partition.SetPartition("P", "W", start, size-start, "P1")
+	if err := mbr.WriteMBR(path); err != nil {
+		t.Fatal(err)
+	}
+
+	sb := &SuperBlock{}
+	sb.CreateSuperBlock(partition.PartStart, partition.CalculateN(opts), opts)
+
+	if err := sb.CreateJournal(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := sb.CreateBitMaps(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := sb.CreateUserFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := sb.WriteSuperBlock(path, int64(start), int64(start+sb.Size())); err != nil {
+		t.Fatal(err)
+	}
+
+	return path, sb
+}
+
+// createFile creates the file name with the missing folders above it, owned by owner,
+// and writes content to it
+func createFile(t *testing.T, sb *SuperBlock, path, name, content string, owner *Credentials) {
+	t.Helper()
+
+	if err := sb.CreateNewInode(path, SplitPath(name), 0, true, true, owner); err != nil {
+		t.Fatalf("create %s: %v", name, err)
+	}
+
+	if content == "" {
+		return
+	}
+
+	if _, err := sb.WriteFile(path, 0, SplitPath(name), content); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+}
+
+// createFolder creates the folder name with the missing folders above it, owned by owner
+func createFolder(t *testing.T, sb *SuperBlock, path, name string, owner *Credentials) {
+	t.Helper()
+
+	if err := sb.CreateNewInode(path, SplitPath(name), 0, false, true, owner); err != nil {
+		t.Fatalf("create %s: %v", name, err)
+	}
+}
+
+// readInode returns the inode at name, failing the test when it does not exist
+func readInode(t *testing.T, sb *SuperBlock, path, name string) (int32, *Inode) {
+	t.Helper()
+
+	index := sb.GetInodeReference(path, 0, SplitPath(name))
+	if index == -1 {
+		t.Fatalf("%s not found", name)
+	}
+
+	inode := &Inode{}
+	if err := inode.ReadInode(path, int64(sb.SInodeStart+index*sb.SInodeSize)); err != nil {
+		t.Fatal(err)
+	}
+	return index, inode
+}
+
+// checkClean fails the test when fsck finds a problem
+func checkClean(t *testing.T, sb *SuperBlock, path string) {
+	t.Helper()
+
+	report, err := sb.CheckFilesystem(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, problem := range report.Problems {
+		t.Errorf("fsck: %s", problem)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	path, sb := formatDisk(t, 200*1024, FormatOptions{FsType: 3, BlockSize: 64, Ratio: 3})
+
+	read := &SuperBlock{}
+	if err := read.ReadSuperBlock(path, int64(sb.journalStart()-sb.Size())); err != nil {
+		t.Fatal(err)
+	}
+	if read.SuperBlockData != sb.SuperBlockData {
+		t.Errorf("superblock read back differs from the one written")
+	}
+
+	if users := sb.GetFile(path, 0, []string{"users.txt"}); users != "1,G,root\n1,U,root,root,123,1\n" {
+		t.Errorf("users.txt is %q", users)
+	}
+
+	if journals, err := sb.GetJournals(path); err != nil || len(journals) != 0 {
+		t.Errorf("new journal has %d entries (%v)", len(journals), err)
+	}
+
+	checkClean(t, sb, path)
+}
@@ -0,0 +1,280 @@
+package structures
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FeatureTrash moves removed entries into TrashFolder instead of freeing them
+const FeatureTrash int32 = 1 << 3
+
+// TrashFolder is the hidden folder of the root folder that holds removed entries,
+// every entry is named after the id of its record
+const TrashFolder = ".trash"
+
+// TrashIndex holds the trash records inside TrashFolder, one line per removed entry
+const TrashIndex = "index.txt"
+
+// TrashRecord remembers where a removed entry was, who removed it and when.
+// Records taken out of the trash keep their line with ID 0
+type TrashRecord struct {
+	ID   int32
+	UID  int32
+	Time int64
+	Path string
+}
+
+// ParseTrashRecords reads the content of the trash index, malformed lines are skipped
+func ParseTrashRecords(data string) []TrashRecord {
+	var records []TrashRecord
+
+	for _, line := range strings.Split(data, "\n") {
+		parts := strings.SplitN(line, ",", 4)
+		if len(parts) != 4 {
+			continue
+		}
+
+		id, err1 := strconv.Atoi(strings.TrimSpace(parts[0]))
+		uid, err2 := strconv.Atoi(strings.TrimSpace(parts[1]))
+		at, err3 := strconv.ParseInt(strings.TrimSpace(parts[2]), 10, 64)
+		if err1 != nil || err2 != nil || err3 != nil || parts[3] == "" {
+			continue
+		}
+
+		records = append(records, TrashRecord{ID: int32(id), UID: int32(uid), Time: at, Path: parts[3]})
+	}
+
+	return records
+}
+
+// FormatTrashRecords returns the content of the trash index. Lines keep their width when
+// a record is cleared so the file never gets shorter, WriteFile does not truncate
+func FormatTrashRecords(records []TrashRecord) string {
+	var sb strings.Builder
+	for _, r := range records {
+		sb.WriteString(fmt.Sprintf("%5d,%5d,%d,%s\n", r.ID, r.UID, r.Time, r.Path))
+	}
+	return sb.String()
+}
+
+// ReadTrash returns the entries currently in the trash ordered by id
+func (sb *SuperBlock) ReadTrash(path string) []TrashRecord {
+	var live []TrashRecord
+	for _, record := range sb.readTrashRecords(path) {
+		if record.ID != 0 {
+			live = append(live, record)
+		}
+	}
+
+	sort.Slice(live, func(i, j int) bool { return live[i].ID < live[j].ID })
+	return live
+}
+
+func (sb *SuperBlock) readTrashRecords(path string) []TrashRecord {
+	index := []string{TrashFolder, TrashIndex}
+	if sb.getInodeReference(path, 0, index) == -1 {
+		return nil
+	}
+
+	return ParseTrashRecords(sb.getFile(path, 0, index))
+}
+
+// writeTrashRecords stores records in the trash index, the index is removed once
+// every record was cleared so an emptied trash does not keep growing
+func (sb *SuperBlock) writeTrashRecords(path string, records []TrashRecord) error {
+	index := []string{TrashFolder, TrashIndex}
+	exists := sb.getInodeReference(path, 0, index) != -1
+
+	live := false
+	for _, record := range records {
+		live = live || record.ID != 0
+	}
+
+	if !live {
+		if exists {
+			return sb.removeEntry(path, sb.getInodeReference(path, 0, []string{TrashFolder}), TrashIndex)
+		}
+		return nil
+	}
+
+	if !exists {
+		root := &Credentials{UID: RootUID, GID: 1}
+		if err := sb.CreateNewInode(path, index, 0, true, false, root); err != nil {
+			return err
+		}
+	}
+
+	_, err := sb.writeFile(path, 0, index, FormatTrashRecords(records))
+	return err
+}
+
+// trashFolder returns the inode of the trash folder, creating it owned by root and
+// only accessible to root, entries are listed and restored through their records
+func (sb *SuperBlock) trashFolder(path string) (int32, error) {
+	if index := sb.getInodeReference(path, 0, []string{TrashFolder}); index != -1 {
+		return index, nil
+	}
+
+	root := &Credentials{UID: RootUID, GID: 1}
+	if err := sb.CreateNewInode(path, []string{TrashFolder}, 0, false, false, root); err != nil {
+		return -1, err
+	}
+
+	index := sb.getInodeReference(path, 0, []string{TrashFolder})
+	if index == -1 {
+		return -1, fmt.Errorf("cannot create /%s", TrashFolder)
+	}
+
+	inode := &Inode{}
+	inodeStart := int64(sb.SInodeStart + index*sb.SInodeSize)
+	if err := inode.ReadInode(path, inodeStart); err != nil {
+		return -1, err
+	}
+
+	inode.IPerm = [3]byte{'7', '0', '0'}
+	if err := inode.WriteInode(path, inodeStart, inodeStart+int64(sb.SInodeSize)); err != nil {
+		return -1, err
+	}
+
+	return index, nil
+}
+
+// TrashPath moves the entry at filePath into the trash and records it as removed by uid,
+// the entry keeps its inode so hard links and ownership survive a restore
+func (sb *SuperBlock) TrashPath(path string, filePath []string, uid int32) (TrashRecord, error) {
+	parent, err := sb.removableParent(path, filePath)
+	if err != nil {
+		return TrashRecord{}, err
+	}
+
+	target := sb.getInodeReference(path, 0, filePath)
+
+	trash, err := sb.trashFolder(path)
+	if err != nil {
+		return TrashRecord{}, err
+	}
+
+	records := sb.readTrashRecords(path)
+	record := TrashRecord{ID: 1, UID: uid, Time: Timestamp(), Path: "/" + strings.Join(filePath, "/")}
+	for _, r := range records {
+		record.ID = max(record.ID, r.ID+1)
+	}
+
+	// the entry is linked into the trash before it leaves its folder so a failure
+	// never leaves it unreachable
+	if err := sb.AddFolderEntry(path, trash, strconv.Itoa(int(record.ID)), target); err != nil {
+		return TrashRecord{}, err
+	}
+
+	if err := sb.writeTrashRecords(path, append(records, record)); err != nil {
+		return TrashRecord{}, err
+	}
+
+	if _, err := sb.removeFolderEntry(path, parent, filePath[len(filePath)-1]); err != nil {
+		return TrashRecord{}, err
+	}
+
+	return record, nil
+}
+
+// FindTrashRecord returns the record with the given id, or the latest one removed from
+// the given path when ref is a path
+func (sb *SuperBlock) FindTrashRecord(path, ref string) (TrashRecord, error) {
+	records := sb.ReadTrash(path)
+
+	id, err := strconv.Atoi(ref)
+	for i := len(records) - 1; i >= 0; i-- {
+		if (err == nil && records[i].ID == int32(id)) || (err != nil && records[i].Path == "/"+strings.Join(SplitPath(ref), "/")) {
+			return records[i], nil
+		}
+	}
+
+	return TrashRecord{}, fmt.Errorf("not in trash: %s", ref)
+}
+
+// RestoreTrash moves the entry of the record with the given id back to its original path,
+// the folder it was removed from must still exist and the name must be free
+func (sb *SuperBlock) RestoreTrash(path string, id int32) error {
+	records := sb.readTrashRecords(path)
+	position := -1
+	for i, record := range records {
+		if record.ID == id {
+			position = i
+		}
+	}
+	if position == -1 || id == 0 {
+		return fmt.Errorf("not in trash: %d", id)
+	}
+
+	name := strconv.Itoa(int(id))
+	trash := sb.getInodeReference(path, 0, []string{TrashFolder})
+	target := sb.getInodeReference(path, 0, []string{TrashFolder, name})
+	if target == -1 {
+		return fmt.Errorf("not in trash: %d", id)
+	}
+
+	original := SplitPath(records[position].Path)
+	parent, err := sb.linkParent(path, original)
+	if err != nil {
+		return err
+	}
+
+	if err := sb.AddFolderEntry(path, parent, original[len(original)-1], target); err != nil {
+		return err
+	}
+
+	if _, err := sb.removeFolderEntry(path, trash, name); err != nil {
+		return err
+	}
+
+	records[position].ID = 0
+	return sb.writeTrashRecords(path, records)
+}
+
+// EmptyTrash frees the entries of the records with the given ids for good. creds must be
+// allowed to remove every entry with what is below it, otherwise nothing is freed
+func (sb *SuperBlock) EmptyTrash(path string, ids []int32, creds *Credentials) error {
+	records := sb.readTrashRecords(path)
+	trash := sb.getInodeReference(path, 0, []string{TrashFolder})
+
+	for _, id := range ids {
+		name := strconv.Itoa(int(id))
+		index := sb.getInodeReference(path, 0, []string{TrashFolder, name})
+		if id == 0 || index == -1 {
+			continue
+		}
+
+		for _, record := range records {
+			if record.ID != id {
+				continue
+			}
+			if err := sb.checkRemoveTree(path, index, record.Path, creds); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, id := range ids {
+		for i := range records {
+			if records[i].ID != id || id == 0 {
+				continue
+			}
+
+			name := strconv.Itoa(int(id))
+			if sb.getInodeReference(path, 0, []string{TrashFolder, name}) != -1 {
+				if err := sb.removeEntry(path, trash, name); err != nil {
+					return err
+				}
+			}
+			records[i].ID = 0
+		}
+	}
+
+	if trash == -1 {
+		return nil
+	}
+
+	return sb.writeTrashRecords(path, records)
+}
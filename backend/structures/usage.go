@@ -0,0 +1,116 @@
+package structures
+
+import "strings"
+
+// FsUsage is the space of a filesystem as counted by the superblock
+type FsUsage struct {
+	Id         string  `json:"id"`
+	BlockSize  int32   `json:"blockSize"`
+	Blocks     int32   `json:"blocks"`
+	UsedBlocks int32   `json:"usedBlocks"`
+	FreeBlocks int32   `json:"freeBlocks"`
+	Bytes      int64   `json:"bytes"`
+	UsedBytes  int64   `json:"usedBytes"`
+	FreeBytes  int64   `json:"freeBytes"`
+	BlockUse   float64 `json:"blockUse"` // percent of blocks in use
+	Inodes     int32   `json:"inodes"`
+	UsedInodes int32   `json:"usedInodes"`
+	FreeInodes int32   `json:"freeInodes"`
+	InodeUse   float64 `json:"inodeUse"` // percent of inodes in use
+}
+
+// DiskUsage is the space allocated below a path, Size is the logical size of the files
+// which is smaller than Bytes for compressed files and larger for sparse ones
+type DiskUsage struct {
+	Path   string `json:"path"`
+	Blocks int32  `json:"blocks"`
+	Bytes  int64  `json:"bytes"`
+	Size   int64  `json:"size"`
+}
+
+// Usage returns the capacity and the free counters of the superblock
+func (sb *SuperBlock) Usage(id string) FsUsage {
+	usage := FsUsage{
+		Id:         id,
+		BlockSize:  sb.SBlockSize,
+		Blocks:     sb.BlockCapacity(),
+		FreeBlocks: sb.SFreeBlockCount,
+		Inodes:     sb.InodeCapacity(),
+		FreeInodes: sb.SFreeInodeCount,
+	}
+
+	usage.UsedBlocks = usage.Blocks - usage.FreeBlocks
+	usage.UsedInodes = usage.Inodes - usage.FreeInodes
+
+	usage.Bytes = int64(usage.Blocks) * int64(sb.SBlockSize)
+	usage.UsedBytes = int64(usage.UsedBlocks) * int64(sb.SBlockSize)
+	usage.FreeBytes = int64(usage.FreeBlocks) * int64(sb.SBlockSize)
+
+	if usage.Blocks > 0 {
+		usage.BlockUse = 100 * float64(usage.UsedBlocks) / float64(usage.Blocks)
+	}
+	if usage.Inodes > 0 {
+		usage.InodeUse = 100 * float64(usage.UsedInodes) / float64(usage.Inodes)
+	}
+
+	return usage
+}
+
+// DiskUsage sums the blocks allocated to the inode at index and everything below it,
+// pointer, index, attribute and long name blocks included, along with the size of the
+// files. Folders up to depth levels below name get their own entry, children come
+// before their parent and the total is last. Hard linked inodes are counted once and
+// folders creds can not read are counted without their content
+func (sb *SuperBlock) DiskUsage(path string, index int32, name string, depth int, creds *Credentials) ([]DiskUsage, error) {
+	var usage []DiskUsage
+	total, err := sb.diskUsage(path, index, name, depth, creds, make(map[int32]bool), &usage)
+	if err != nil {
+		return nil, err
+	}
+
+	// a file given as the path still gets its line
+	if len(usage) == 0 || usage[len(usage)-1].Path != name {
+		usage = append(usage, total)
+	}
+
+	return usage, nil
+}
+
+func (sb *SuperBlock) diskUsage(path string, index int32, name string, depth int, creds *Credentials, seen map[int32]bool, usage *[]DiskUsage) (DiskUsage, error) {
+	total := DiskUsage{Path: name}
+	if seen[index] {
+		return total, nil
+	}
+	seen[index] = true
+
+	inode := &Inode{}
+	if err := inode.ReadInode(path, int64(sb.SInodeStart+index*sb.SInodeSize)); err != nil {
+		return total, err
+	}
+
+	total.Blocks = sb.InodeBlockCount(path, inode)
+	if inode.IType == '1' {
+		total.Size = int64(inode.ISize)
+	}
+
+	if inode.IType == '0' && inode.HasPermission(creds, PermRead|PermExec) {
+		for _, entry := range sb.GetFolderEntries(path, inode) {
+			total.Blocks += int32(len(sb.nameBlocks(path, entry)))
+
+			childName := strings.TrimRight(name, "/") + "/" + sb.EntryName(path, entry)
+			child, err := sb.diskUsage(path, entry.BInode, childName, depth-1, creds, seen, usage)
+			if err != nil {
+				return total, err
+			}
+			total.Blocks += child.Blocks
+			total.Size += child.Size
+		}
+	}
+
+	total.Bytes = int64(total.Blocks) * int64(sb.SBlockSize)
+	if inode.IType == '0' && depth >= 0 {
+		*usage = append(*usage, total)
+	}
+
+	return total, nil
+}
@@ -0,0 +1,264 @@
+package structures
+
+import (
+	"backend/utils"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxXattrNameLength is the longest attribute name, its length is stored in one byte
+const MaxXattrNameLength = 255
+
+// ErrXattrNotFound is returned when an inode has no attribute with the requested name
+var ErrXattrNotFound = errors.New("attribute not found")
+
+// Xattr is an extended attribute of an inode
+type Xattr struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// XattrBlock keeps every attribute of an inode. Each attribute is stored as the
+// name length (1 byte), the value length (2 bytes), the name and the value,
+// a zero name length ends the list
+type XattrBlock struct {
+	XData []byte
+	sb    *SuperBlock // locates the checksum table
+	// Total size of the XattrBlock is SBlockSize bytes
+}
+
+// NewXattrBlock returns an empty attribute block sized for this filesystem
+func (sb *SuperBlock) NewXattrBlock() *XattrBlock {
+	return &XattrBlock{XData: make([]byte, sb.SBlockSize), sb: sb}
+}
+
+func (x *XattrBlock) WriteXattrBlock(path string, offset int64, maxSize int64) error {
+	if err := x.sb.copyOnWrite(path, offset); err != nil {
+		return err
+	}
+
+	if err := utils.WriteToFile(path, offset, maxSize, x.XData); err != nil {
+		return err
+	}
+	return x.sb.writeBlockChecksum(path, offset, x.XData)
+}
+
+func (x *XattrBlock) ReadXattrBlock(path string, offset int64) error {
+	if err := utils.ReadFromFile(path, offset, x.XData); err != nil {
+		return err
+	}
+	return x.sb.verifyBlockChecksum(path, offset, "attribute block", x.XData)
+}
+
+// Attributes decodes the block, a truncated attribute ends the list
+func (x *XattrBlock) Attributes() []Xattr {
+	var attrs []Xattr
+
+	for pos := 0; pos+3 <= len(x.XData) && x.XData[pos] != 0; {
+		nameLength := int(x.XData[pos])
+		valueLength := int(binary.LittleEndian.Uint16(x.XData[pos+1:]))
+		pos += 3
+
+		if pos+nameLength+valueLength > len(x.XData) {
+			break
+		}
+
+		attrs = append(attrs, Xattr{
+			Name:  string(x.XData[pos : pos+nameLength]),
+			Value: string(x.XData[pos+nameLength : pos+nameLength+valueLength]),
+		})
+		pos += nameLength + valueLength
+	}
+
+	return attrs
+}
+
+// SetAttributes encodes attrs sorted by name, it fails when they do not fit in the block
+func (x *XattrBlock) SetAttributes(attrs []Xattr) error {
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Name < attrs[j].Name })
+
+	data := make([]byte, 0, len(x.XData))
+	for _, attr := range attrs {
+		data = append(data, byte(len(attr.Name)))
+		data = binary.LittleEndian.AppendUint16(data, uint16(len(attr.Value)))
+		data = append(data, attr.Name...)
+		data = append(data, attr.Value...)
+	}
+
+	if len(data) > len(x.XData) {
+		return fmt.Errorf("attributes too large: %d bytes, the limit is %d", len(data), len(x.XData))
+	}
+
+	clear(x.XData)
+	copy(x.XData, data)
+	return nil
+}
+
+// ValidateXattrName checks that name can be stored as an attribute name
+func ValidateXattrName(name string) error {
+	if name == "" {
+		return fmt.Errorf("invalid attribute name: empty name")
+	}
+
+	if !utf8.ValidString(name) {
+		return fmt.Errorf("invalid attribute name: %q is not valid UTF-8", name)
+	}
+
+	if strings.Contains(name, "=") {
+		return fmt.Errorf("invalid attribute name: %s contains '='", name)
+	}
+
+	if len(name) > MaxXattrNameLength {
+		return fmt.Errorf("invalid attribute name: %s (max %d bytes)", name, MaxXattrNameLength)
+	}
+
+	return nil
+}
+
+// ListXattrs returns the extended attributes of the inode at index sorted by name
+func (sb *SuperBlock) ListXattrs(path string, index int32) ([]Xattr, error) {
+	inode := &Inode{}
+	if err := inode.ReadInode(path, int64(sb.SInodeStart+index*sb.SInodeSize)); err != nil {
+		return nil, err
+	}
+
+	if inode.IXattr == -1 {
+		return nil, nil
+	}
+
+	block := sb.NewXattrBlock()
+	if err := block.ReadXattrBlock(path, int64(sb.SBlockStart+inode.IXattr*sb.SBlockSize)); err != nil {
+		return nil, err
+	}
+
+	return block.Attributes(), nil
+}
+
+// GetXattr returns the value of the attribute name of the inode at index
+func (sb *SuperBlock) GetXattr(path string, index int32, name string) (string, error) {
+	attrs, err := sb.ListXattrs(path, index)
+	if err != nil {
+		return "", err
+	}
+
+	for _, attr := range attrs {
+		if attr.Name == name {
+			return attr.Value, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrXattrNotFound, name)
+}
+
+// SetXattr creates or replaces the attribute name of the inode at index,
+// the attribute block is allocated with the first attribute
+func (sb *SuperBlock) SetXattr(path string, index int32, name, value string) error {
+	attrs, err := sb.mergeXattr(path, index, name, value)
+	if err != nil {
+		return err
+	}
+
+	return sb.writeXattrs(path, index, attrs)
+}
+
+// CheckXattr reports whether SetXattr would accept the attribute without changing anything
+func (sb *SuperBlock) CheckXattr(path string, index int32, name, value string) error {
+	_, err := sb.mergeXattr(path, index, name, value)
+	return err
+}
+
+// mergeXattr returns the attributes of the inode at index with name set to value,
+// checking that the name is valid and that everything fits in one block
+func (sb *SuperBlock) mergeXattr(path string, index int32, name, value string) ([]Xattr, error) {
+	if err := ValidateXattrName(name); err != nil {
+		return nil, err
+	}
+
+	attrs, err := sb.ListXattrs(path, index)
+	if err != nil {
+		return nil, err
+	}
+
+	replaced := false
+	for i := range attrs {
+		if attrs[i].Name == name {
+			attrs[i].Value = value
+			replaced = true
+		}
+	}
+	if !replaced {
+		attrs = append(attrs, Xattr{Name: name, Value: value})
+	}
+
+	if err := sb.NewXattrBlock().SetAttributes(attrs); err != nil {
+		return nil, err
+	}
+
+	return attrs, nil
+}
+
+// RemoveXattr deletes the attribute name of the inode at index, the attribute
+// block is freed with the last attribute
+func (sb *SuperBlock) RemoveXattr(path string, index int32, name string) error {
+	attrs, err := sb.ListXattrs(path, index)
+	if err != nil {
+		return err
+	}
+
+	for i, attr := range attrs {
+		if attr.Name == name {
+			return sb.writeXattrs(path, index, append(attrs[:i], attrs[i+1:]...))
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrXattrNotFound, name)
+}
+
+// writeXattrs stores attrs in the attribute block of the inode at index
+func (sb *SuperBlock) writeXattrs(path string, index int32, attrs []Xattr) error {
+	inode := &Inode{}
+	inodeStart := int64(sb.SInodeStart + index*sb.SInodeSize)
+	if err := inode.ReadInode(path, inodeStart); err != nil {
+		return err
+	}
+	defer sb.chargeTo(inode.IuId, inode.IGid)()
+
+	if len(attrs) == 0 {
+		if inode.IXattr != -1 {
+			if err := sb.FreeBlock(path, inode.IXattr); err != nil {
+				return err
+			}
+			inode.IXattr = -1
+		}
+		inode.ICTime = Timestamp()
+		return inode.WriteInode(path, inodeStart, inodeStart+int64(sb.SInodeSize))
+	}
+
+	block := sb.NewXattrBlock()
+	if err := block.SetAttributes(attrs); err != nil {
+		return err
+	}
+
+	if inode.IXattr == -1 {
+		if err := sb.CheckFreeBlocks(1); err != nil {
+			return err
+		}
+
+		inode.IXattr = sb.NextBlockIndex()
+		if err := sb.UpdateBitmapBlock(path); err != nil {
+			return err
+		}
+	}
+
+	blockStart := int64(sb.SBlockStart + inode.IXattr*sb.SBlockSize)
+	if err := block.WriteXattrBlock(path, blockStart, blockStart+int64(sb.SBlockSize)); err != nil {
+		return err
+	}
+
+	inode.ICTime = Timestamp()
+	return inode.WriteInode(path, inodeStart, inodeStart+int64(sb.SInodeSize))
+}
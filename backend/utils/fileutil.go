@@ -79,6 +79,82 @@ func ReadFromFile(path string, offset int64, data interface{}) error {
 	return nil
 }
 
+// ZeroFill writes zeros in the range [start, end) of the file
+func ZeroFill(path string, start int64, end int64) error {
+	if end < start {
+		return fmt.Errorf("end must be greater than start")
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %v", err)
+	}
+
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(file)
+
+	if _, err = file.Seek(start, 0); err != nil {
+		return fmt.Errorf("failed to seek file: %v", err)
+	}
+
+	buffer := make([]byte, min(end-start, 1024*1024))
+	for remaining := end - start; remaining > 0; remaining -= int64(len(buffer)) {
+		if remaining < int64(len(buffer)) {
+			buffer = buffer[:remaining]
+		}
+
+		if _, err = file.Write(buffer); err != nil {
+			return fmt.Errorf("failed to write to file: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// MoveForward copies size bytes from offset from to offset to, with to >= from. The ranges
+// may overlap, the copy runs from the end so no byte is overwritten before it is read
+func MoveForward(path string, from int64, to int64, size int64) error {
+	if to < from {
+		return fmt.Errorf("destination must not be before the source")
+	}
+
+	if to == from || size == 0 {
+		return nil
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0666)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %v", err)
+	}
+
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(file)
+
+	buffer := make([]byte, min(size, 1024*1024))
+	for end := size; end > 0; end -= int64(len(buffer)) {
+		chunk := buffer[:min(end, int64(len(buffer)))]
+		start := end - int64(len(chunk))
+
+		if _, err = file.ReadAt(chunk, from+start); err != nil {
+			return fmt.Errorf("failed to read from file: %v", err)
+		}
+
+		if _, err = file.WriteAt(chunk, to+start); err != nil {
+			return fmt.Errorf("failed to write to file: %v", err)
+		}
+	}
+
+	return nil
+}
+
 func ReadFromBitMap(path string, offset int64, end int64) (string, error) {
 	if end <= offset {
 		return "", fmt.Errorf("end must be greater than offset")